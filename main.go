@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
 	"io"
@@ -9,8 +10,10 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gin-contrib/static"
@@ -24,14 +27,15 @@ import (
 
 func main() {
 	// Config
-	debug := true
-	protocol := "http"
-	if !debug {
-		protocol = "https"
-	}
+	debug := src.Debug()
 	host := "localhost"
+	bindHost := "127.0.0.1"
 	port := 42607
-	address := fmt.Sprintf("%s://%s:%d", protocol, host, port)
+	tlsPort := 42608
+	address := fmt.Sprintf("http://%s:%d", host, port)
+	if !debug {
+		address = fmt.Sprintf("https://%s:%d", host, tlsPort)
+	}
 	openErr := ""
 	if len(os.Args) > 1 {
 		notebookPath := os.Args[1]
@@ -84,19 +88,26 @@ func main() {
 	// Force Gin's console colors
 	gin.ForceConsoleColor()
 
+	// Generate the token the webview uses to authenticate with the API
+	apiToken, err := src.NewAPIToken()
+	util.CheckError(err)
+
 	// Set up routing
 	router := gin.Default()
 	router.LoadHTMLGlob("web/index.html")
-	src.LoadRoutes(router, "api")
+	src.LoadRoutes(router, "api", src.RequireAPIToken(apiToken))
 	router.Use(static.Serve("/", static.LocalFile("web", true)))
 	router.NoRoute(func(c *gin.Context) {
 		c.HTML(http.StatusOK, "index.html", nil)
 	})
 
-	// Set up HTTP server
+	// Set up HTTP server, which only redirects to the HTTPS server when not in debug mode
+	handler := src.CheckHost(src.ForceSSL(router, tlsPort),
+		fmt.Sprintf("%s:%d", host, port), fmt.Sprintf("%s:%d", bindHost, port),
+		fmt.Sprintf("%s:%d", host, tlsPort), fmt.Sprintf("%s:%d", bindHost, tlsPort))
 	server := &http.Server{
-		Addr:    fmt.Sprintf(":%d", port),
-		Handler: src.ForceSSL(router),
+		Addr:    fmt.Sprintf("%s:%d", bindHost, port),
+		Handler: handler,
 	}
 
 	// Start HTTP server
@@ -106,19 +117,68 @@ func main() {
 		}
 	}()
 
+	// Set up and start HTTPS server
+	var tlsServer *http.Server
+	if !debug {
+		certificate, certificatePem, err := src.LoadTLSCertificate(host, bindHost)
+		util.CheckError(err)
+
+		err = src.TrustCertificate(certificatePem, host)
+		if err != nil {
+			log.Printf("Error occurred trusting the TLS certificate in the webview, it must be trusted by the system instead: %s", err)
+		}
+
+		tlsServer = &http.Server{
+			Addr:    fmt.Sprintf("%s:%d", bindHost, tlsPort),
+			Handler: handler,
+			TLSConfig: &tls.Config{
+				Certificates: []tls.Certificate{*certificate},
+				MinVersion: tls.VersionTLS12,
+			},
+		}
+
+		go func() {
+			if err := tlsServer.ListenAndServeTLS("", ""); err != nil && err != http.ErrServerClosed {
+				panic(err)
+			}
+		}()
+	}
+
 	// Set up webview window
 	w := webview.New(debug)
 	defer w.Destroy()
 	services.WindowHandle = w
 	w.SetTitle("Encrypted Notebook")
 	w.SetSize(800, 600, webview.HintNone)
+	w.Init(fmt.Sprintf("window.enoApiToken = %q;", apiToken))
 	w.Navigate(address)
+
+	// Close the window on interrupt so that unlocked notebooks still get saved
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		w.Dispatch(w.Terminate)
+	}()
+
 	w.Run()
 
-	// Kill HTTP server
+	// Kill HTTP servers
 	ctx, cancel := context.WithTimeout(context.Background(), 5 * time.Second)
 	defer cancel()
-	if err := server.Shutdown(ctx); err != nil {
-		panic(err)
+	shutdownErr := server.Shutdown(ctx)
+	if tlsServer != nil {
+		if err := tlsServer.Shutdown(ctx); err != nil && shutdownErr == nil {
+			shutdownErr = err
+		}
+	}
+
+	// Save unlocked notebooks
+	if err := services.FlushNotebooks(); err != nil {
+		log.Printf("Error occurred saving unlocked notebooks on exit: %s", err)
+	}
+
+	if shutdownErr != nil {
+		panic(shutdownErr)
 	}
 }
@@ -0,0 +1,83 @@
+package src
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"eno/src/services"
+)
+
+const (
+	apiTokenLength = 32
+	authorizationHeader = "Authorization"
+	bearerPrefix = "Bearer "
+	originHeader = "Origin"
+)
+
+// NewAPIToken generates the random token the webview has to present to use the API, which changes every launch.
+func NewAPIToken() (string, error) {
+	token := make([]byte, apiTokenLength)
+	_, err := io.ReadFull(rand.Reader, token)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+/*
+CheckHost only lets requests through that are addressed to one of the app's own hosts, and that come from one of its
+own origins if they come from a browser page. Checking the Host header stops other sites from reaching the server by
+pointing their own domain at the loopback address, and checking the Origin header stops them from sending requests
+to it from their pages.
+
+	next:    the handler requests are passed to.
+	hosts:   the hosts the app is served from, with their ports.
+
+	returns: the handler.
+*/
+func CheckHost(next http.Handler, hosts ...string) http.Handler {
+	allowedHosts := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		allowedHosts[strings.ToLower(host)] = true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !allowedHosts[strings.ToLower(r.Host)] {
+			http.Error(w, "Host not allowed", http.StatusForbidden)
+			return
+		}
+
+		if origin := r.Header.Get(originHeader); origin != "" {
+			originURL, err := url.Parse(origin)
+			if err != nil || (originURL.Scheme != "http" && originURL.Scheme != "https") || !allowedHosts[strings.ToLower(originURL.Host)] {
+				http.Error(w, "Origin not allowed", http.StatusForbidden)
+				return
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireAPIToken rejects API requests that do not carry the launch's API token as a bearer token
+func RequireAPIToken(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authorization := c.GetHeader(authorizationHeader)
+		if !strings.HasPrefix(authorization, bearerPrefix) ||
+			subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(authorization, bearerPrefix)), []byte(token)) != 1 {
+			services.JSONUnauthorized(c, "a valid API token is required")
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -1,24 +1,33 @@
 package src
 
 import (
+	"net"
 	"net/http"
 	"os"
+	"strconv"
 )
 
 const (
-	xForwardedProtoHeader = "x-forwarded-proto"
-	debugEnv              = "DEBUG"
+	debugEnv = "DEBUG"
 )
 
-// ForceSSL enforces HTTPS when not in debug mode
-func ForceSSL(next http.Handler) http.Handler {
+// Debug reports whether the app runs in debug mode, which it does unless the DEBUG environment variable is false.
+func Debug() bool {
+	return os.Getenv(debugEnv) != "false"
+}
+
+// ForceSSL enforces HTTPS when not in debug mode, redirecting requests that did not arrive over TLS to the TLS port
+func ForceSSL(next http.Handler, tlsPort int) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if os.Getenv(debugEnv) == "false" {
-			if r.Header.Get(xForwardedProtoHeader) != "https" {
-				sslURL := "https://" + r.Host + r.RequestURI
-				http.Redirect(w, r, sslURL, http.StatusTemporaryRedirect)
-				return
+		if !Debug() && r.TLS == nil {
+			host, _, err := net.SplitHostPort(r.Host)
+			if err != nil {
+				host = r.Host
 			}
+
+			sslURL := "https://" + net.JoinHostPort(host, strconv.Itoa(tlsPort)) + r.RequestURI
+			http.Redirect(w, r, sslURL, http.StatusTemporaryRedirect)
+			return
 		}
 
 		next.ServeHTTP(w, r)
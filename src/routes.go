@@ -6,31 +6,67 @@ import (
 	"eno/src/routes"
 )
 
-// LoadRoutes creates all routes
-func LoadRoutes(router *gin.Engine, path string) {
+// LoadRoutes creates all routes, behind any middleware given
+func LoadRoutes(router *gin.Engine, path string, middleware ...gin.HandlerFunc) {
 	// Create the route group
-	group := router.Group(path)
+	group := router.Group(path, middleware...)
 
 	// Load notebook routes
 	notebookGroup := group.Group("notebook")
-	notebookGroup.POST(  "",            routes.CreateNotebook)
-	notebookGroup.GET(   "all",         routes.ListNotebooks)
-	notebookGroup.GET(   "details",     routes.GetNotebookDetails)
-	notebookGroup.GET(   "",            routes.OpenNotebook)
-	notebookGroup.PATCH( "name",        routes.SetNotebookName)
-	notebookGroup.PATCH( "description", routes.SetNotebookDescription)
-	notebookGroup.PATCH( "key",         routes.SetNotebookKey)
-	notebookGroup.DELETE("",            routes.DeleteNotebook)
+	notebookGroup.POST(  "",              routes.CreateNotebook)
+	notebookGroup.GET(   "all",           routes.ListNotebooks)
+	notebookGroup.GET(   "details",       routes.GetNotebookDetails)
+	notebookGroup.GET(   "",              routes.OpenNotebook)
+	notebookGroup.POST(  "unlock",        routes.UnlockNotebook)
+	notebookGroup.POST(  "lock",          routes.LockNotebook)
+	notebookGroup.POST(  "lock/all",      routes.LockAllNotebooks)
+	notebookGroup.PATCH( "name",          routes.SetNotebookName)
+	notebookGroup.PATCH( "description",   routes.SetNotebookDescription)
+	notebookGroup.PATCH( "key",           routes.SetNotebookKey)
+	notebookGroup.GET(   "keys",          routes.ListNotebookKeySlots)
+	notebookGroup.POST(  "keys",          routes.AddNotebookKeySlot)
+	notebookGroup.POST(  "keys/recovery", routes.AddNotebookRecoveryKey)
+	notebookGroup.DELETE("keys",          routes.RevokeNotebookKeySlot)
+	notebookGroup.DELETE("",              routes.DeleteNotebook)
+	notebookGroup.GET(   "trash",         routes.ListTrashedNotebooks)
+	notebookGroup.PATCH( "trash/restore", routes.RestoreTrashedNotebook)
+	notebookGroup.DELETE("trash",         routes.EmptyNotebookTrash)
 
 	// Load entry routes
 	entryGroup := group.Group("entry")
-	entryGroup.POST(  "",        routes.CreateNotebookEntry)
-	entryGroup.GET(   "all",     routes.ListNotebookEntries)
-	entryGroup.GET(   "",        routes.GetNotebookEntry)
-	entryGroup.PATCH( "name",    routes.SetNotebookEntryName)
-	entryGroup.PATCH( "content", routes.SetNotebookEntryContent)
-	entryGroup.GET(   "search",  routes.SearchNotebookEntries)
-	entryGroup.DELETE("",        routes.DeleteNotebookEntry)
+	entryGroup.POST(  "",                  routes.CreateNotebookEntry)
+	entryGroup.GET(   "all",               routes.ListNotebookEntries)
+	entryGroup.GET(   "",                  routes.GetNotebookEntry)
+	entryGroup.PATCH( "name",              routes.SetNotebookEntryName)
+	entryGroup.PATCH( "content",           routes.SetNotebookEntryContent)
+	entryGroup.GET(   "search",            routes.SearchNotebookEntries)
+	entryGroup.DELETE("",                  routes.DeleteNotebookEntry)
+	entryGroup.GET(   "revisions",         routes.ListNotebookEntryRevisions)
+	entryGroup.GET(   "revisions/diff",    routes.DiffNotebookEntryRevisions)
+	entryGroup.PATCH( "revisions/restore", routes.RestoreNotebookEntryRevision)
+	entryGroup.GET(   "trash",             routes.ListTrashedNotebookEntries)
+	entryGroup.PATCH( "trash/restore",     routes.RestoreTrashedNotebookEntry)
+	entryGroup.DELETE("trash",             routes.EmptyNotebookEntryTrash)
+	entryGroup.GET(   "tree",              routes.GetNotebookEntryTree)
+	entryGroup.PATCH( "folder",            routes.MoveNotebookEntry)
+	entryGroup.PATCH( "tags/add",          routes.AddNotebookEntryTags)
+	entryGroup.PATCH( "tags/remove",       routes.RemoveNotebookEntryTags)
+	entryGroup.GET(   "tags",              routes.ListNotebookTags)
+	entryGroup.PATCH( "tags/name",         routes.SetNotebookTagName)
+
+	// Load attachment routes
+	attachmentGroup := group.Group("attachment")
+	attachmentGroup.POST(  "",    routes.CreateNotebookEntryAttachment)
+	attachmentGroup.GET(   "all", routes.ListNotebookEntryAttachments)
+	attachmentGroup.GET(   "",    routes.GetNotebookEntryAttachment)
+	attachmentGroup.DELETE("",    routes.DeleteNotebookEntryAttachment)
+
+	// Load folder routes
+	folderGroup := group.Group("folder")
+	folderGroup.POST(  "",     routes.CreateNotebookFolder)
+	folderGroup.PATCH( "name", routes.SetNotebookFolderName)
+	folderGroup.PATCH( "path", routes.MoveNotebookFolder)
+	folderGroup.DELETE("",     routes.DeleteNotebookFolder)
 
 	// Load settings routes
 	settingsGroup := group.Group("settings")
@@ -0,0 +1,188 @@
+package routes
+
+import (
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"eno/src/services"
+)
+
+// attachmentUploadOverhead allows for the multipart headers sent along with an attachment's data.
+const attachmentUploadOverhead = 64 * 1024
+
+type CreateNotebookEntryAttachmentParams struct {
+	NotebookName *string `form:"notebookName" binding:"required"`
+	NotebookKey  *string `form:"notebookKey"`
+	KeyfilePath  *string `form:"keyfilePath"`
+	SessionToken *string `form:"sessionToken"`
+	EntryID      *string `form:"entryId"      binding:"required"`
+}
+
+type ListNotebookEntryAttachmentsParams struct {
+	NotebookName *string `form:"notebookName" binding:"required"`
+	NotebookKey  *string `form:"notebookKey"`
+	KeyfilePath  *string `form:"keyfilePath"`
+	SessionToken *string `form:"sessionToken"`
+	EntryID      *string `form:"entryId"      binding:"required"`
+}
+
+type GetNotebookEntryAttachmentParams struct {
+	NotebookName *string `form:"notebookName" binding:"required"`
+	NotebookKey  *string `form:"notebookKey"`
+	KeyfilePath  *string `form:"keyfilePath"`
+	SessionToken *string `form:"sessionToken"`
+	AttachmentID *string `form:"attachmentId" binding:"required"`
+}
+
+type DeleteNotebookEntryAttachmentParams struct {
+	NotebookName *string `form:"notebookName" binding:"required"`
+	NotebookKey  *string `form:"notebookKey"`
+	KeyfilePath  *string `form:"keyfilePath"`
+	SessionToken *string `form:"sessionToken"`
+	AttachmentID *string `form:"attachmentId" binding:"required"`
+}
+
+// CreateNotebookEntryAttachment attaches an uploaded file to an entry in a notebook.
+func CreateNotebookEntryAttachment(c *gin.Context) {
+	var params CreateNotebookEntryAttachmentParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, services.AttachmentMaxSize + attachmentUploadOverhead)
+
+	// The multipart body is read a part at a time, so the file is never buffered in memory or spilled to an
+	// unencrypted temporary file
+	multipartReader, err := c.Request.MultipartReader()
+	if err != nil {
+		services.JSONError(c, "attachments must be uploaded as multipart form data")
+		return
+	}
+
+	// The body can only be read once, so a keyfile uploaded to unlock the notebook has to come before the file and is
+	// hashed here, where requestNotebookCredentials finds it
+	keyfiles := make(map[string][]byte)
+	c.Set(keyfilesContextKey, keyfiles)
+
+	var part *multipart.Part
+	for {
+		part, err = multipartReader.NextPart()
+		if err != nil {
+			services.JSONError(c, "attachments must be uploaded as a 'file' form field")
+			return
+		}
+		if part.FormName() == "file" {
+			break
+		}
+
+		if part.FormName() == keyfileField {
+			keyfiles[keyfileField], err = services.HashKeyfile(part)
+			if err != nil {
+				part.Close()
+				services.JSONError(c, err.Error())
+				return
+			}
+		}
+		part.Close()
+	}
+	defer part.Close()
+
+	credentials, ok := requestNotebookCredentials(c, params.NotebookKey, params.KeyfilePath, params.SessionToken)
+	if !ok {
+		return
+	}
+
+	attachment, err := services.CreateNotebookEntryAttachment(*params.NotebookName, credentials, *params.EntryID, part.FileName(), part.Header.Get("Content-Type"), part)
+	if err != nil {
+		jsonServiceError(c, err)
+		return
+	}
+
+	services.JSONResponse(c, attachment)
+}
+
+// ListNotebookEntryAttachments lists the files attached to an entry in a notebook.
+func ListNotebookEntryAttachments(c *gin.Context) {
+	var params ListNotebookEntryAttachmentsParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	credentials, ok := requestNotebookCredentials(c, params.NotebookKey, params.KeyfilePath, params.SessionToken)
+	if !ok {
+		return
+	}
+
+	attachments, err := services.ListNotebookEntryAttachments(*params.NotebookName, credentials, *params.EntryID)
+	if err != nil {
+		jsonServiceError(c, err)
+		return
+	}
+
+	services.JSONResponse(c, attachments)
+}
+
+// GetNotebookEntryAttachment downloads a file attached to an entry in a notebook.
+func GetNotebookEntryAttachment(c *gin.Context) {
+	var params GetNotebookEntryAttachmentParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	credentials, ok := requestNotebookCredentials(c, params.NotebookKey, params.KeyfilePath, params.SessionToken)
+	if !ok {
+		return
+	}
+
+	attachment, reader, err := services.OpenNotebookEntryAttachment(*params.NotebookName, credentials, *params.AttachmentID)
+	if err != nil {
+		jsonServiceError(c, err)
+		return
+	}
+	defer reader.Close()
+
+	c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name}))
+	c.Header("Content-Length", strconv.Itoa(attachment.Size))
+	c.Header("Content-Type", attachment.MediaType)
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Status(http.StatusOK)
+
+	// Once streaming has started the status cannot change, so a file that fails to decrypt part way is cut short,
+	// which the client sees as a body shorter than its length
+	_, err = io.Copy(c.Writer, reader)
+	if err != nil {
+		log.Printf("Error occurred sending attachment '%s': %s", attachment.ID, err)
+		c.Abort()
+	}
+}
+
+// DeleteNotebookEntryAttachment permanently removes a file attached to an entry in a notebook.
+func DeleteNotebookEntryAttachment(c *gin.Context) {
+	var params DeleteNotebookEntryAttachmentParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	credentials, ok := requestNotebookCredentials(c, params.NotebookKey, params.KeyfilePath, params.SessionToken)
+	if !ok {
+		return
+	}
+
+	err := services.DeleteNotebookEntryAttachment(*params.NotebookName, credentials, *params.AttachmentID)
+	if err != nil {
+		jsonServiceError(c, err)
+		return
+	}
+
+	services.JSONResponse(c, nil)
+}
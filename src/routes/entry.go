@@ -8,46 +8,133 @@ import (
 
 type CreateNotebookEntryParams struct {
 	NotebookName *string `form:"notebookName" binding:"required"`
-	NotebookKey  *string `form:"notebookKey"  binding:"required"`
+	NotebookKey  *string `form:"notebookKey"`
+	KeyfilePath  *string `form:"keyfilePath"`
+	SessionToken *string `form:"sessionToken"`
 	EntryName    *string `form:"entryName"    binding:"required"`
+	Folder       *string `form:"folder"`
 }
 
 type ListNotebookEntriesParams struct {
-	NotebookName *string `form:"notebookName" binding:"required"`
-	NotebookKey  *string `form:"notebookKey"  binding:"required"`
+	NotebookName *string  `form:"notebookName" binding:"required"`
+	NotebookKey  *string  `form:"notebookKey"`
+	KeyfilePath  *string  `form:"keyfilePath"`
+	SessionToken *string  `form:"sessionToken"`
+	Tags         []string `form:"tags"`
 }
 
 type GetNotebookEntryParams struct {
 	NotebookName *string `form:"notebookName" binding:"required"`
-	NotebookKey  *string `form:"notebookKey"  binding:"required"`
-	EntryName    *string `form:"entryName"    binding:"required"`
+	NotebookKey  *string `form:"notebookKey"`
+	KeyfilePath  *string `form:"keyfilePath"`
+	SessionToken *string `form:"sessionToken"`
+	EntryID      *string `form:"entryId"      binding:"required"`
 }
 
 type SetNotebookEntryNameParams struct {
-	NotebookName *string `form:"notebookName" binding:"required"`
-	NotebookKey  *string `form:"notebookKey"  binding:"required"`
-	EntryName    *string `form:"entryName"    binding:"required"`
-	NewEntryName *string `form:"newEntryName" binding:"required"`
+	NotebookName     *string `form:"notebookName"     binding:"required"`
+	NotebookKey      *string `form:"notebookKey"`
+	KeyfilePath      *string `form:"keyfilePath"`
+	SessionToken     *string `form:"sessionToken"`
+	EntryID          *string `form:"entryId"          binding:"required"`
+	NewEntryName     *string `form:"newEntryName"     binding:"required"`
+	ExpectedRevision *int    `form:"expectedRevision"`
 }
 
 type SetNotebookEntryContentParams struct {
-	NotebookName *string `form:"notebookName" binding:"required"`
-	NotebookKey  *string `form:"notebookKey"  binding:"required"`
-	EntryName    *string `form:"entryName"    binding:"required"`
-	NewContent   *string `form:"newContent"   binding:"required"`
+	NotebookName     *string `form:"notebookName"     binding:"required"`
+	NotebookKey      *string `form:"notebookKey"`
+	KeyfilePath      *string `form:"keyfilePath"`
+	SessionToken     *string `form:"sessionToken"`
+	EntryID          *string `form:"entryId"          binding:"required"`
+	NewContent       *string `form:"newContent"       binding:"required"`
+	ExpectedRevision *int    `form:"expectedRevision"`
 }
 
 type SearchNotebookEntriesParams struct {
-	NotebookName *string `form:"notebookName" binding:"required"`
-	NotebookKey  *string `form:"notebookKey"  binding:"required"`
-	Query        *string `form:"query"        binding:"required"`
-	RegexSearch  *bool  `form:"regexSearch"   binding:"required"`
+	NotebookName *string  `form:"notebookName" binding:"required"`
+	NotebookKey  *string  `form:"notebookKey"`
+	KeyfilePath  *string  `form:"keyfilePath"`
+	SessionToken *string  `form:"sessionToken"`
+	Query        *string  `form:"query"        binding:"required"`
+	RegexSearch  *bool   `form:"regexSearch"   binding:"required"`
+	Tags         []string `form:"tags"`
 }
 
 type DeleteNotebookEntryParams struct {
+	NotebookName     *string `form:"notebookName"     binding:"required"`
+	NotebookKey      *string `form:"notebookKey"`
+	KeyfilePath      *string `form:"keyfilePath"`
+	SessionToken     *string `form:"sessionToken"`
+	EntryID          *string `form:"entryId"          binding:"required"`
+	ExpectedRevision *int    `form:"expectedRevision"`
+}
+
+type GetNotebookEntryTreeParams struct {
 	NotebookName *string `form:"notebookName" binding:"required"`
-	NotebookKey  *string `form:"notebookKey"  binding:"required"`
-	EntryName    *string `form:"entryName"    binding:"required"`
+	NotebookKey  *string `form:"notebookKey"`
+	KeyfilePath  *string `form:"keyfilePath"`
+	SessionToken *string `form:"sessionToken"`
+}
+
+type MoveNotebookEntryParams struct {
+	NotebookName     *string `form:"notebookName"     binding:"required"`
+	NotebookKey      *string `form:"notebookKey"`
+	KeyfilePath      *string `form:"keyfilePath"`
+	SessionToken     *string `form:"sessionToken"`
+	EntryID          *string `form:"entryId"          binding:"required"`
+	Folder           *string `form:"folder"           binding:"required"`
+	ExpectedRevision *int    `form:"expectedRevision"`
+}
+
+type ListNotebookEntryRevisionsParams struct {
+	NotebookName *string `form:"notebookName" binding:"required"`
+	NotebookKey  *string `form:"notebookKey"`
+	KeyfilePath  *string `form:"keyfilePath"`
+	SessionToken *string `form:"sessionToken"`
+	EntryID      *string `form:"entryId"      binding:"required"`
+}
+
+type DiffNotebookEntryRevisionsParams struct {
+	NotebookName *string `form:"notebookName" binding:"required"`
+	NotebookKey  *string `form:"notebookKey"`
+	KeyfilePath  *string `form:"keyfilePath"`
+	SessionToken *string `form:"sessionToken"`
+	EntryID      *string `form:"entryId"      binding:"required"`
+	FromRevision *int    `form:"fromRevision" binding:"required"`
+	ToRevision   *int    `form:"toRevision"   binding:"required"`
+}
+
+type RestoreNotebookEntryRevisionParams struct {
+	NotebookName     *string `form:"notebookName"     binding:"required"`
+	NotebookKey      *string `form:"notebookKey"`
+	KeyfilePath      *string `form:"keyfilePath"`
+	SessionToken     *string `form:"sessionToken"`
+	EntryID          *string `form:"entryId"          binding:"required"`
+	Revision         *int    `form:"revision"         binding:"required"`
+	ExpectedRevision *int    `form:"expectedRevision"`
+}
+
+type ListTrashedNotebookEntriesParams struct {
+	NotebookName *string `form:"notebookName" binding:"required"`
+	NotebookKey  *string `form:"notebookKey"`
+	KeyfilePath  *string `form:"keyfilePath"`
+	SessionToken *string `form:"sessionToken"`
+}
+
+type RestoreTrashedNotebookEntryParams struct {
+	NotebookName *string `form:"notebookName" binding:"required"`
+	NotebookKey  *string `form:"notebookKey"`
+	KeyfilePath  *string `form:"keyfilePath"`
+	SessionToken *string `form:"sessionToken"`
+	TrashID      *string `form:"trashId"      binding:"required"`
+}
+
+type EmptyNotebookEntryTrashParams struct {
+	NotebookName *string `form:"notebookName" binding:"required"`
+	NotebookKey  *string `form:"notebookKey"`
+	KeyfilePath  *string `form:"keyfilePath"`
+	SessionToken *string `form:"sessionToken"`
 }
 
 // CreateNotebookEntry creates an entry in a notebook.
@@ -58,12 +145,23 @@ func CreateNotebookEntry(c *gin.Context) {
 		return
 	}
 
-	entry, err := services.CreateNotebookEntry(*params.NotebookName, *params.NotebookKey, *params.EntryName)
+	folder := ""
+	if params.Folder != nil {
+		folder = *params.Folder
+	}
+
+	credentials, ok := requestNotebookCredentials(c, params.NotebookKey, params.KeyfilePath, params.SessionToken)
+	if !ok {
+		return
+	}
+
+	entry, err := services.CreateNotebookEntry(*params.NotebookName, credentials, *params.EntryName, folder)
 	if err != nil {
-		services.JSONError(c, err.Error())
+		jsonServiceError(c, err)
 		return
 	}
 
+	setETag(c, entry.Revision)
 	services.JSONResponse(c, entry)
 }
 
@@ -75,9 +173,14 @@ func ListNotebookEntries(c *gin.Context) {
 		return
 	}
 
-	entries, err := services.ListNotebookEntries(*params.NotebookName, *params.NotebookKey)
+	credentials, ok := requestNotebookCredentials(c, params.NotebookKey, params.KeyfilePath, params.SessionToken)
+	if !ok {
+		return
+	}
+
+	entries, err := services.ListNotebookEntries(*params.NotebookName, credentials, params.Tags)
 	if err != nil {
-		services.JSONError(c, err.Error())
+		jsonServiceError(c, err)
 		return
 	}
 
@@ -92,12 +195,18 @@ func GetNotebookEntry(c *gin.Context) {
 		return
 	}
 
-	entry, err := services.GetNotebookEntry(*params.NotebookName, *params.NotebookKey, *params.EntryName)
+	credentials, ok := requestNotebookCredentials(c, params.NotebookKey, params.KeyfilePath, params.SessionToken)
+	if !ok {
+		return
+	}
+
+	entry, err := services.GetNotebookEntry(*params.NotebookName, credentials, *params.EntryID)
 	if err != nil {
-		services.JSONError(c, err.Error())
+		jsonServiceError(c, err)
 		return
 	}
 
+	setETag(c, entry.Revision)
 	services.JSONResponse(c, entry)
 }
 
@@ -109,12 +218,24 @@ func SetNotebookEntryName(c *gin.Context) {
 		return
 	}
 
-	entry, err := services.SetNotebookEntryName(*params.NotebookName, *params.NotebookKey, *params.EntryName, *params.NewEntryName)
+	revision, err := expectedRevision(c, params.ExpectedRevision)
 	if err != nil {
 		services.JSONError(c, err.Error())
 		return
 	}
 
+	credentials, ok := requestNotebookCredentials(c, params.NotebookKey, params.KeyfilePath, params.SessionToken)
+	if !ok {
+		return
+	}
+
+	entry, err := services.SetNotebookEntryName(*params.NotebookName, credentials, *params.EntryID, *params.NewEntryName, revision)
+	if err != nil {
+		jsonServiceError(c, err)
+		return
+	}
+
+	setETag(c, entry.Revision)
 	services.JSONResponse(c, entry)
 }
 
@@ -126,12 +247,24 @@ func SetNotebookEntryContent(c *gin.Context) {
 		return
 	}
 
-	entry, err := services.SetNotebookEntryContent(*params.NotebookName, *params.NotebookKey, *params.EntryName, *params.NewContent)
+	revision, err := expectedRevision(c, params.ExpectedRevision)
 	if err != nil {
 		services.JSONError(c, err.Error())
 		return
 	}
 
+	credentials, ok := requestNotebookCredentials(c, params.NotebookKey, params.KeyfilePath, params.SessionToken)
+	if !ok {
+		return
+	}
+
+	entry, err := services.SetNotebookEntryContent(*params.NotebookName, credentials, *params.EntryID, *params.NewContent, revision)
+	if err != nil {
+		jsonServiceError(c, err)
+		return
+	}
+
+	setETag(c, entry.Revision)
 	services.JSONResponse(c, entry)
 }
 
@@ -143,9 +276,14 @@ func SearchNotebookEntries(c *gin.Context) {
 		return
 	}
 
-	entries, err := services.SearchNotebookEntries(*params.NotebookName, *params.NotebookKey, *params.Query, *params.RegexSearch)
+	credentials, ok := requestNotebookCredentials(c, params.NotebookKey, params.KeyfilePath, params.SessionToken)
+	if !ok {
+		return
+	}
+
+	entries, err := services.SearchNotebookEntries(*params.NotebookName, credentials, *params.Query, *params.RegexSearch, params.Tags)
 	if err != nil {
-		services.JSONError(c, err.Error())
+		jsonServiceError(c, err)
 		return
 	}
 
@@ -160,11 +298,213 @@ func DeleteNotebookEntry(c *gin.Context) {
 		return
 	}
 
-	err := services.DeleteNotebookEntry(*params.NotebookName, *params.NotebookKey, *params.EntryName)
+	revision, err := expectedRevision(c, params.ExpectedRevision)
+	if err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	credentials, ok := requestNotebookCredentials(c, params.NotebookKey, params.KeyfilePath, params.SessionToken)
+	if !ok {
+		return
+	}
+
+	err = services.DeleteNotebookEntry(*params.NotebookName, credentials, *params.EntryID, revision)
+	if err != nil {
+		jsonServiceError(c, err)
+		return
+	}
+
+	services.JSONResponse(c, nil)
+}
+
+// ListNotebookEntryRevisions lists the versions of an entry's content kept in its notebook's history.
+func ListNotebookEntryRevisions(c *gin.Context) {
+	var params ListNotebookEntryRevisionsParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	credentials, ok := requestNotebookCredentials(c, params.NotebookKey, params.KeyfilePath, params.SessionToken)
+	if !ok {
+		return
+	}
+
+	revisions, err := services.ListNotebookEntryRevisions(*params.NotebookName, credentials, *params.EntryID)
+	if err != nil {
+		jsonServiceError(c, err)
+		return
+	}
+
+	services.JSONResponse(c, revisions)
+}
+
+// DiffNotebookEntryRevisions shows the differences between two versions of an entry's content.
+func DiffNotebookEntryRevisions(c *gin.Context) {
+	var params DiffNotebookEntryRevisionsParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	credentials, ok := requestNotebookCredentials(c, params.NotebookKey, params.KeyfilePath, params.SessionToken)
+	if !ok {
+		return
+	}
+
+	diff, err := services.DiffNotebookEntryRevisions(*params.NotebookName, credentials, *params.EntryID, *params.FromRevision, *params.ToRevision)
+	if err != nil {
+		jsonServiceError(c, err)
+		return
+	}
+
+	services.JSONResponse(c, diff)
+}
+
+// RestoreNotebookEntryRevision makes an old version of an entry's content its current content.
+func RestoreNotebookEntryRevision(c *gin.Context) {
+	var params RestoreNotebookEntryRevisionParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	revision, err := expectedRevision(c, params.ExpectedRevision)
 	if err != nil {
 		services.JSONError(c, err.Error())
 		return
 	}
 
+	credentials, ok := requestNotebookCredentials(c, params.NotebookKey, params.KeyfilePath, params.SessionToken)
+	if !ok {
+		return
+	}
+
+	entry, err := services.RestoreNotebookEntryRevision(*params.NotebookName, credentials, *params.EntryID, *params.Revision, revision)
+	if err != nil {
+		jsonServiceError(c, err)
+		return
+	}
+
+	setETag(c, entry.Revision)
+	services.JSONResponse(c, entry)
+}
+
+// ListTrashedNotebookEntries lists the entries in a notebook's trash.
+func ListTrashedNotebookEntries(c *gin.Context) {
+	var params ListTrashedNotebookEntriesParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	credentials, ok := requestNotebookCredentials(c, params.NotebookKey, params.KeyfilePath, params.SessionToken)
+	if !ok {
+		return
+	}
+
+	trashedEntries, err := services.ListTrashedNotebookEntries(*params.NotebookName, credentials)
+	if err != nil {
+		jsonServiceError(c, err)
+		return
+	}
+
+	services.JSONResponse(c, trashedEntries)
+}
+
+// RestoreTrashedNotebookEntry moves an entry out of a notebook's trash.
+func RestoreTrashedNotebookEntry(c *gin.Context) {
+	var params RestoreTrashedNotebookEntryParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	credentials, ok := requestNotebookCredentials(c, params.NotebookKey, params.KeyfilePath, params.SessionToken)
+	if !ok {
+		return
+	}
+
+	entry, err := services.RestoreTrashedNotebookEntry(*params.NotebookName, credentials, *params.TrashID)
+	if err != nil {
+		jsonServiceError(c, err)
+		return
+	}
+
+	setETag(c, entry.Revision)
+	services.JSONResponse(c, entry)
+}
+
+// EmptyNotebookEntryTrash permanently removes every entry in a notebook's trash.
+func EmptyNotebookEntryTrash(c *gin.Context) {
+	var params EmptyNotebookEntryTrashParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	credentials, ok := requestNotebookCredentials(c, params.NotebookKey, params.KeyfilePath, params.SessionToken)
+	if !ok {
+		return
+	}
+
+	err := services.EmptyNotebookEntryTrash(*params.NotebookName, credentials)
+	if err != nil {
+		jsonServiceError(c, err)
+		return
+	}
+
 	services.JSONResponse(c, nil)
 }
+
+// GetNotebookEntryTree lists a notebook's folders and entries as a tree.
+func GetNotebookEntryTree(c *gin.Context) {
+	var params GetNotebookEntryTreeParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	credentials, ok := requestNotebookCredentials(c, params.NotebookKey, params.KeyfilePath, params.SessionToken)
+	if !ok {
+		return
+	}
+
+	tree, err := services.GetNotebookEntryTree(*params.NotebookName, credentials)
+	if err != nil {
+		jsonServiceError(c, err)
+		return
+	}
+
+	services.JSONResponse(c, tree)
+}
+
+// MoveNotebookEntry moves an entry into a folder in a notebook.
+func MoveNotebookEntry(c *gin.Context) {
+	var params MoveNotebookEntryParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	revision, err := expectedRevision(c, params.ExpectedRevision)
+	if err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	credentials, ok := requestNotebookCredentials(c, params.NotebookKey, params.KeyfilePath, params.SessionToken)
+	if !ok {
+		return
+	}
+
+	entry, err := services.MoveNotebookEntry(*params.NotebookName, credentials, *params.EntryID, *params.Folder, revision)
+	if err != nil {
+		jsonServiceError(c, err)
+		return
+	}
+
+	setETag(c, entry.Revision)
+	services.JSONResponse(c, entry)
+}
@@ -0,0 +1,129 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"eno/src/services"
+)
+
+type CreateNotebookFolderParams struct {
+	NotebookName *string `form:"notebookName" binding:"required"`
+	NotebookKey  *string `form:"notebookKey"`
+	KeyfilePath  *string `form:"keyfilePath"`
+	SessionToken *string `form:"sessionToken"`
+	Folder       *string `form:"folder"       binding:"required"`
+}
+
+type SetNotebookFolderNameParams struct {
+	NotebookName  *string `form:"notebookName"  binding:"required"`
+	NotebookKey   *string `form:"notebookKey"`
+	KeyfilePath   *string `form:"keyfilePath"`
+	SessionToken  *string `form:"sessionToken"`
+	Folder        *string `form:"folder"        binding:"required"`
+	NewFolderName *string `form:"newFolderName" binding:"required"`
+}
+
+type MoveNotebookFolderParams struct {
+	NotebookName *string `form:"notebookName" binding:"required"`
+	NotebookKey  *string `form:"notebookKey"`
+	KeyfilePath  *string `form:"keyfilePath"`
+	SessionToken *string `form:"sessionToken"`
+	Folder       *string `form:"folder"       binding:"required"`
+	NewFolder    *string `form:"newFolder"    binding:"required"`
+}
+
+type DeleteNotebookFolderParams struct {
+	NotebookName *string `form:"notebookName" binding:"required"`
+	NotebookKey  *string `form:"notebookKey"`
+	KeyfilePath  *string `form:"keyfilePath"`
+	SessionToken *string `form:"sessionToken"`
+	Folder       *string `form:"folder"       binding:"required"`
+}
+
+// CreateNotebookFolder creates a folder in a notebook.
+func CreateNotebookFolder(c *gin.Context) {
+	var params CreateNotebookFolderParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	credentials, ok := requestNotebookCredentials(c, params.NotebookKey, params.KeyfilePath, params.SessionToken)
+	if !ok {
+		return
+	}
+
+	folder, err := services.CreateNotebookFolder(*params.NotebookName, credentials, *params.Folder)
+	if err != nil {
+		jsonServiceError(c, err)
+		return
+	}
+
+	services.JSONResponse(c, folder)
+}
+
+// SetNotebookFolderName renames a folder in a notebook.
+func SetNotebookFolderName(c *gin.Context) {
+	var params SetNotebookFolderNameParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	credentials, ok := requestNotebookCredentials(c, params.NotebookKey, params.KeyfilePath, params.SessionToken)
+	if !ok {
+		return
+	}
+
+	folder, err := services.SetNotebookFolderName(*params.NotebookName, credentials, *params.Folder, *params.NewFolderName)
+	if err != nil {
+		jsonServiceError(c, err)
+		return
+	}
+
+	services.JSONResponse(c, folder)
+}
+
+// MoveNotebookFolder moves a folder to a new path in a notebook.
+func MoveNotebookFolder(c *gin.Context) {
+	var params MoveNotebookFolderParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	credentials, ok := requestNotebookCredentials(c, params.NotebookKey, params.KeyfilePath, params.SessionToken)
+	if !ok {
+		return
+	}
+
+	folder, err := services.MoveNotebookFolder(*params.NotebookName, credentials, *params.Folder, *params.NewFolder)
+	if err != nil {
+		jsonServiceError(c, err)
+		return
+	}
+
+	services.JSONResponse(c, folder)
+}
+
+// DeleteNotebookFolder deletes a folder in a notebook, moving its entries to the trash.
+func DeleteNotebookFolder(c *gin.Context) {
+	var params DeleteNotebookFolderParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	credentials, ok := requestNotebookCredentials(c, params.NotebookKey, params.KeyfilePath, params.SessionToken)
+	if !ok {
+		return
+	}
+
+	err := services.DeleteNotebookFolder(*params.NotebookName, credentials, *params.Folder)
+	if err != nil {
+		jsonServiceError(c, err)
+		return
+	}
+
+	services.JSONResponse(c, nil)
+}
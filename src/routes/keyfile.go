@@ -0,0 +1,147 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"eno/src/services"
+)
+
+const (
+	keyfileField = "keyfile"
+	newKeyfileField = "newKeyfile"
+	keyfileUploadOverhead = 64 * 1024
+	keyfilesContextKey = "keyfiles"
+)
+
+// uploadedKeyfiles hashes the keyfiles uploaded as multipart form data, by their form field. Each part is hashed as it
+// is read, so a keyfile is never held in memory or written to a temporary file. The body can only be read once, so the
+// hashes are kept with the request for any later calls. Requests without a multipart body have no uploaded keyfiles.
+func uploadedKeyfiles(c *gin.Context) (map[string][]byte, error) {
+	if keyfiles, ok := c.Get(keyfilesContextKey); ok {
+		return keyfiles.(map[string][]byte), nil
+	}
+
+	keyfiles := make(map[string][]byte)
+	c.Set(keyfilesContextKey, keyfiles)
+
+	if c.ContentType() != gin.MIMEMultipartPOSTForm {
+		return keyfiles, nil
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, 2 * services.KeyfileMaxSize + keyfileUploadOverhead)
+
+	multipartReader, err := c.Request.MultipartReader()
+	if err != nil {
+		return nil, fmt.Errorf("keyfiles must be uploaded as multipart form data")
+	}
+
+	for {
+		part, err := multipartReader.NextPart()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("keyfiles must be uploaded as multipart form data")
+		}
+
+		name := part.FormName()
+		if name == keyfileField || name == newKeyfileField {
+			keyfiles[name], err = services.HashKeyfile(part)
+		}
+		part.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return keyfiles, nil
+}
+
+/*
+notebookKey gets a notebook key from a request's typed key and keyfile, either of which may be left out, but not both.
+
+	key:         the typed key, which is used as the passphrase if there is also a keyfile.
+	keyfilePath: the path to a keyfile.
+	keyfileHash: the hash of an uploaded keyfile.
+
+	returns:     the notebook key, or an error.
+*/
+func notebookKey(key *string, keyfilePath *string, keyfileHash []byte) (string, error) {
+	if keyfilePath != nil {
+		if keyfileHash != nil {
+			return "", fmt.Errorf("a keyfile cannot be both uploaded and given by path")
+		}
+
+		var err error
+		keyfileHash, err = services.HashKeyfileAt(*keyfilePath)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if keyfileHash == nil {
+		if key == nil {
+			return "", fmt.Errorf("a notebook key or keyfile is required")
+		}
+
+		return *key, nil
+	}
+
+	passphrase := ""
+	if key != nil {
+		passphrase = *key
+	}
+
+	return services.NotebookKeyWithKeyfile(passphrase, keyfileHash), nil
+}
+
+/*
+requestNotebookKey gets a notebook key from a request's typed key, keyfile path or uploaded keyfile, reporting any
+error to the client.
+
+	c:            the request context.
+	key:          the typed key.
+	keyfilePath:  the path to a keyfile.
+	keyfileField: the form field a keyfile may be uploaded in.
+
+	returns:      the notebook key, and false if an error was reported.
+*/
+func requestNotebookKey(c *gin.Context, key *string, keyfilePath *string, keyfileField string) (string, bool) {
+	keyfiles, err := uploadedKeyfiles(c)
+	if err != nil {
+		services.JSONError(c, err.Error())
+		return "", false
+	}
+
+	notebookKey, err := notebookKey(key, keyfilePath, keyfiles[keyfileField])
+	if err != nil {
+		services.JSONError(c, err.Error())
+		return "", false
+	}
+
+	return notebookKey, true
+}
+
+// requestNotebookCredentials gets the session token a request gives, or otherwise its notebook key, reporting any error
+// to the client. It returns false if an error was reported.
+func requestNotebookCredentials(c *gin.Context, key *string, keyfilePath *string, sessionToken *string) (services.NotebookCredentials, bool) {
+	if sessionToken != nil {
+		return services.NotebookCredentials{
+			SessionToken: *sessionToken,
+		}, true
+	}
+
+	notebookKey, ok := requestNotebookKey(c, key, keyfilePath, keyfileField)
+	if !ok {
+		return services.NotebookCredentials{}, false
+	}
+
+	return services.NotebookCredentials{
+		Key: notebookKey,
+	}, true
+}
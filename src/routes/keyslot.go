@@ -0,0 +1,129 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"eno/src/services"
+)
+
+type ListNotebookKeySlotsParams struct {
+	Name        *string `form:"name"        binding:"required"`
+	Key         *string `form:"key"`
+	KeyfilePath *string `form:"keyfilePath"`
+}
+
+type AddNotebookKeySlotParams struct {
+	Name           *string `form:"name"           binding:"required"`
+	Key            *string `form:"key"`
+	KeyfilePath    *string `form:"keyfilePath"`
+	Label          *string `form:"label"          binding:"required"`
+	NewKey         *string `form:"newKey"`
+	NewKeyfilePath *string `form:"newKeyfilePath"`
+}
+
+type AddNotebookRecoveryKeyParams struct {
+	Name        *string `form:"name"        binding:"required"`
+	Key         *string `form:"key"`
+	KeyfilePath *string `form:"keyfilePath"`
+	Label       *string `form:"label"       binding:"required"`
+}
+
+type RevokeNotebookKeySlotParams struct {
+	Name        *string `form:"name"        binding:"required"`
+	Key         *string `form:"key"`
+	KeyfilePath *string `form:"keyfilePath"`
+	SlotID      *string `form:"slotId"      binding:"required"`
+}
+
+// ListNotebookKeySlots lists the key slots that can unlock a notebook.
+func ListNotebookKeySlots(c *gin.Context) {
+	var params ListNotebookKeySlotsParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	key, ok := requestNotebookKey(c, params.Key, params.KeyfilePath, keyfileField)
+	if !ok {
+		return
+	}
+
+	slots, err := services.ListNotebookKeySlots(*params.Name, key)
+	if err != nil {
+		jsonServiceError(c, err)
+		return
+	}
+
+	services.JSONResponse(c, slots)
+}
+
+// AddNotebookKeySlot adds a key slot so a notebook can also be unlocked with another key.
+func AddNotebookKeySlot(c *gin.Context) {
+	var params AddNotebookKeySlotParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	key, ok := requestNotebookKey(c, params.Key, params.KeyfilePath, keyfileField)
+	if !ok {
+		return
+	}
+
+	newKey, ok := requestNotebookKey(c, params.NewKey, params.NewKeyfilePath, newKeyfileField)
+	if !ok {
+		return
+	}
+
+	slot, err := services.AddNotebookKeySlot(*params.Name, key, *params.Label, newKey)
+	if err != nil {
+		jsonServiceError(c, err)
+		return
+	}
+
+	services.JSONResponse(c, slot)
+}
+
+// AddNotebookRecoveryKey generates a recovery key for a notebook and returns it once.
+func AddNotebookRecoveryKey(c *gin.Context) {
+	var params AddNotebookRecoveryKeyParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	key, ok := requestNotebookKey(c, params.Key, params.KeyfilePath, keyfileField)
+	if !ok {
+		return
+	}
+
+	recoveryKey, err := services.AddNotebookRecoveryKey(*params.Name, key, *params.Label)
+	if err != nil {
+		jsonServiceError(c, err)
+		return
+	}
+
+	services.JSONResponse(c, recoveryKey)
+}
+
+// RevokeNotebookKeySlot revokes one of a notebook's key slots.
+func RevokeNotebookKeySlot(c *gin.Context) {
+	var params RevokeNotebookKeySlotParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	key, ok := requestNotebookKey(c, params.Key, params.KeyfilePath, keyfileField)
+	if !ok {
+		return
+	}
+
+	err := services.RevokeNotebookKeySlot(*params.Name, key, *params.SlotID)
+	if err != nil {
+		jsonServiceError(c, err)
+		return
+	}
+
+	services.JSONResponse(c, nil)
+}
@@ -9,7 +9,9 @@ import (
 type CreateNotebookParams struct {
 	Name        *string `form:"name"        binding:"required"`
 	Description *string `form:"description" binding:"required"`
-	Key         *string `form:"key"         binding:"required"`
+	Key         *string `form:"key"`
+	KeyfilePath *string `form:"keyfilePath"`
+	Hidden      *bool   `form:"hidden"`
 }
 
 type GetNotebookDetailsParams struct {
@@ -17,29 +19,59 @@ type GetNotebookDetailsParams struct {
 }
 
 type OpenNotebookParams struct {
-	Name *string `form:"name" binding:"required"`
-	Key  *string `form:"key"  binding:"required"`
+	Name         *string `form:"name"         binding:"required"`
+	Key          *string `form:"key"`
+	KeyfilePath  *string `form:"keyfilePath"`
+	SessionToken *string `form:"sessionToken"`
+}
+
+type UnlockNotebookParams struct {
+	Name        *string `form:"name"        binding:"required"`
+	Key         *string `form:"key"`
+	KeyfilePath *string `form:"keyfilePath"`
+}
+
+type LockNotebookParams struct {
+	SessionToken *string `form:"sessionToken" binding:"required"`
 }
 
 type SetNotebookNameParams struct {
-	Name    *string `form:"name"    binding:"required"`
-	NewName *string `form:"newName" binding:"required"`
+	Name             *string `form:"name"             binding:"required"`
+	Key              *string `form:"key"`
+	KeyfilePath      *string `form:"keyfilePath"`
+	SessionToken     *string `form:"sessionToken"`
+	NewName          *string `form:"newName"          binding:"required"`
+	ExpectedRevision *int    `form:"expectedRevision"`
 }
 
 type SetNotebookDescriptionParams struct {
-	Name           *string `form:"name"           binding:"required"`
-	NewDescription *string `form:"newDescription" binding:"required"`
+	Name             *string `form:"name"             binding:"required"`
+	Key              *string `form:"key"`
+	KeyfilePath      *string `form:"keyfilePath"`
+	SessionToken     *string `form:"sessionToken"`
+	NewDescription   *string `form:"newDescription"   binding:"required"`
+	ExpectedRevision *int    `form:"expectedRevision"`
 }
 
 type SetNotebookKeyParams struct {
-	Name   *string `form:"name"   binding:"required"`
-	Key    *string `form:"key"    binding:"required"`
-	NewKey *string `form:"newKey" binding:"required"`
+	Name             *string `form:"name"             binding:"required"`
+	Key              *string `form:"key"`
+	KeyfilePath      *string `form:"keyfilePath"`
+	NewKey           *string `form:"newKey"`
+	NewKeyfilePath   *string `form:"newKeyfilePath"`
+	ExpectedRevision *int    `form:"expectedRevision"`
 }
 
 type DeleteNotebookParams struct {
-	Name *string `form:"name" binding:"required"`
-	Key  *string `form:"key"  bindign:"required"`
+	Name             *string `form:"name"             binding:"required"`
+	Key              *string `form:"key"`
+	KeyfilePath      *string `form:"keyfilePath"`
+	SessionToken     *string `form:"sessionToken"`
+	ExpectedRevision *int    `form:"expectedRevision"`
+}
+
+type RestoreTrashedNotebookParams struct {
+	TrashID *string `form:"trashId" binding:"required"`
 }
 
 // CreateNotebook creates a new notebook.
@@ -50,7 +82,14 @@ func CreateNotebook(c *gin.Context) {
 		return
 	}
 
-	notebook, err := services.CreateNotebook(*params.Name, *params.Description, *params.Key)
+	key, ok := requestNotebookKey(c, params.Key, params.KeyfilePath, keyfileField)
+	if !ok {
+		return
+	}
+
+	hidden := params.Hidden != nil && *params.Hidden
+
+	notebook, err := services.CreateNotebook(*params.Name, *params.Description, key, hidden)
 	if err != nil {
 		services.JSONError(c, err.Error())
 		return
@@ -84,6 +123,7 @@ func GetNotebookDetails(c *gin.Context) {
 		return
 	}
 
+	setETag(c, notebookDetails.Revision)
 	services.JSONResponse(c, notebookDetails)
 }
 
@@ -95,15 +135,70 @@ func OpenNotebook(c *gin.Context) {
 		return
 	}
 
-	notebook, err := services.OpenNotebook(*params.Name, *params.Key)
+	credentials, ok := requestNotebookCredentials(c, params.Key, params.KeyfilePath, params.SessionToken)
+	if !ok {
+		return
+	}
+
+	notebook, err := services.OpenNotebook(*params.Name, credentials)
 	if err != nil {
-		services.JSONError(c, err.Error())
+		jsonServiceError(c, err)
 		return
 	}
 
 	services.JSONResponse(c, notebook)
 }
 
+// UnlockNotebook unlocks a notebook and starts a session for it.
+func UnlockNotebook(c *gin.Context) {
+	var params UnlockNotebookParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	key, ok := requestNotebookKey(c, params.Key, params.KeyfilePath, keyfileField)
+	if !ok {
+		return
+	}
+
+	session, err := services.UnlockNotebook(*params.Name, key)
+	if err != nil {
+		jsonServiceError(c, err)
+		return
+	}
+
+	services.JSONResponse(c, session)
+}
+
+// LockNotebook ends a notebook session.
+func LockNotebook(c *gin.Context) {
+	var params LockNotebookParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	err := services.LockNotebook(*params.SessionToken)
+	if err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	services.JSONResponse(c, nil)
+}
+
+// LockAllNotebooks ends every notebook session.
+func LockAllNotebooks(c *gin.Context) {
+	err := services.LockAllNotebooks()
+	if err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	services.JSONResponse(c, nil)
+}
+
 // SetNotebookName changes a notebook's name.
 func SetNotebookName(c *gin.Context) {
 	var params SetNotebookNameParams
@@ -112,12 +207,23 @@ func SetNotebookName(c *gin.Context) {
 		return
 	}
 
-	notebook, err := services.SetNotebookName(*params.Name, *params.NewName)
+	revision, err := expectedRevision(c, params.ExpectedRevision)
 	if err != nil {
 		services.JSONError(c, err.Error())
 		return
 	}
 
+	credentials, ok := requestNotebookCredentials(c, params.Key, params.KeyfilePath, params.SessionToken)
+	if !ok {
+		return
+	}
+
+	notebook, err := services.SetNotebookName(*params.Name, credentials, *params.NewName, revision)
+	if err != nil {
+		jsonServiceError(c, err)
+		return
+	}
+
 	services.JSONResponse(c, notebook)
 }
 
@@ -129,12 +235,23 @@ func SetNotebookDescription(c *gin.Context) {
 		return
 	}
 
-	notebook, err := services.SetNotebookDescription(*params.Name, *params.NewDescription)
+	revision, err := expectedRevision(c, params.ExpectedRevision)
 	if err != nil {
 		services.JSONError(c, err.Error())
 		return
 	}
 
+	credentials, ok := requestNotebookCredentials(c, params.Key, params.KeyfilePath, params.SessionToken)
+	if !ok {
+		return
+	}
+
+	notebook, err := services.SetNotebookDescription(*params.Name, credentials, *params.NewDescription, revision)
+	if err != nil {
+		jsonServiceError(c, err)
+		return
+	}
+
 	services.JSONResponse(c, notebook)
 }
 
@@ -146,12 +263,28 @@ func SetNotebookKey(c *gin.Context) {
 		return
 	}
 
-	err := services.SetNotebookKey(*params.Name, *params.Key, *params.NewKey)
+	revision, err := expectedRevision(c, params.ExpectedRevision)
 	if err != nil {
 		services.JSONError(c, err.Error())
 		return
 	}
 
+	key, ok := requestNotebookKey(c, params.Key, params.KeyfilePath, keyfileField)
+	if !ok {
+		return
+	}
+
+	newKey, ok := requestNotebookKey(c, params.NewKey, params.NewKeyfilePath, newKeyfileField)
+	if !ok {
+		return
+	}
+
+	err = services.SetNotebookKey(*params.Name, key, newKey, revision)
+	if err != nil {
+		jsonServiceError(c, err)
+		return
+	}
+
 	services.JSONResponse(c, nil)
 }
 
@@ -163,7 +296,57 @@ func DeleteNotebook(c *gin.Context) {
 		return
 	}
 
-	err := services.DeleteNotebook(*params.Name, *params.Key)
+	revision, err := expectedRevision(c, params.ExpectedRevision)
+	if err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	credentials, ok := requestNotebookCredentials(c, params.Key, params.KeyfilePath, params.SessionToken)
+	if !ok {
+		return
+	}
+
+	err = services.DeleteNotebook(*params.Name, credentials, revision)
+	if err != nil {
+		jsonServiceError(c, err)
+		return
+	}
+
+	services.JSONResponse(c, nil)
+}
+
+// ListTrashedNotebooks lists the notebooks in the trash.
+func ListTrashedNotebooks(c *gin.Context) {
+	trashedNotebooks, err := services.ListTrashedNotebooks()
+	if err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	services.JSONResponse(c, trashedNotebooks)
+}
+
+// RestoreTrashedNotebook moves a notebook out of the trash.
+func RestoreTrashedNotebook(c *gin.Context) {
+	var params RestoreTrashedNotebookParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	notebookID, err := services.RestoreTrashedNotebook(*params.TrashID)
+	if err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	services.JSONResponse(c, notebookID)
+}
+
+// EmptyNotebookTrash permanently removes every notebook in the trash.
+func EmptyNotebookTrash(c *gin.Context) {
+	err := services.EmptyNotebookTrash()
 	if err != nil {
 		services.JSONError(c, err.Error())
 		return
@@ -0,0 +1,60 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"eno/src/services"
+)
+
+// expectedRevision gets the revision a client expects to be changing, from the expectedRevision parameter or else
+// from the If-Match header. Neither being sent, or an If-Match of "*", means the change is not checked.
+func expectedRevision(c *gin.Context, param *int) (*int, error) {
+	if param != nil {
+		return param, nil
+	}
+
+	ifMatch := strings.TrimSpace(c.GetHeader("If-Match"))
+	if ifMatch == "" || ifMatch == "*" {
+		return nil, nil
+	}
+
+	revision, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(ifMatch, "W/"), `"`))
+	if err != nil {
+		return nil, fmt.Errorf("If-Match must be a revision number")
+	}
+
+	return &revision, nil
+}
+
+// setETag sends a notebook or entry's revision as the response's ETag.
+func setETag(c *gin.Context, revision int) {
+	c.Header("ETag", fmt.Sprintf(`"%d"`, revision))
+}
+
+// jsonServiceError sends an error returned by a service, as a conflict if a revision check failed, as locked if the
+// session used has ended, or as too many requests if a notebook key has been tried too often.
+func jsonServiceError(c *gin.Context, err error) {
+	var conflict *services.RevisionConflictError
+	if errors.As(err, &conflict) {
+		services.JSONConflict(c, conflict.Error(), conflict.Current)
+		return
+	}
+
+	var tooManyAttempts *services.TooManyAttemptsError
+	if errors.As(err, &tooManyAttempts) {
+		services.JSONTooManyRequests(c, tooManyAttempts.Error(), tooManyAttempts.RetryAfter)
+		return
+	}
+
+	if errors.Is(err, services.ErrNotebookLocked) {
+		services.JSONLocked(c, err.Error())
+		return
+	}
+
+	services.JSONError(c, err.Error())
+}
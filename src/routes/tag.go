@@ -0,0 +1,145 @@
+package routes
+
+import (
+	"github.com/gin-gonic/gin"
+
+	"eno/src/services"
+)
+
+type AddNotebookEntryTagsParams struct {
+	NotebookName     *string  `form:"notebookName"     binding:"required"`
+	NotebookKey      *string  `form:"notebookKey"`
+	KeyfilePath      *string  `form:"keyfilePath"`
+	SessionToken     *string  `form:"sessionToken"`
+	EntryID          *string  `form:"entryId"          binding:"required"`
+	Tags             []string `form:"tags"             binding:"required"`
+	ExpectedRevision *int     `form:"expectedRevision"`
+}
+
+type RemoveNotebookEntryTagsParams struct {
+	NotebookName     *string  `form:"notebookName"     binding:"required"`
+	NotebookKey      *string  `form:"notebookKey"`
+	KeyfilePath      *string  `form:"keyfilePath"`
+	SessionToken     *string  `form:"sessionToken"`
+	EntryID          *string  `form:"entryId"          binding:"required"`
+	Tags             []string `form:"tags"             binding:"required"`
+	ExpectedRevision *int     `form:"expectedRevision"`
+}
+
+type ListNotebookTagsParams struct {
+	NotebookName *string `form:"notebookName" binding:"required"`
+	NotebookKey  *string `form:"notebookKey"`
+	KeyfilePath  *string `form:"keyfilePath"`
+	SessionToken *string `form:"sessionToken"`
+}
+
+type SetNotebookTagNameParams struct {
+	NotebookName *string `form:"notebookName" binding:"required"`
+	NotebookKey  *string `form:"notebookKey"`
+	KeyfilePath  *string `form:"keyfilePath"`
+	SessionToken *string `form:"sessionToken"`
+	Tag          *string `form:"tag"          binding:"required"`
+	NewTag       *string `form:"newTag"       binding:"required"`
+}
+
+// AddNotebookEntryTags tags an entry in a notebook.
+func AddNotebookEntryTags(c *gin.Context) {
+	var params AddNotebookEntryTagsParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	revision, err := expectedRevision(c, params.ExpectedRevision)
+	if err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	credentials, ok := requestNotebookCredentials(c, params.NotebookKey, params.KeyfilePath, params.SessionToken)
+	if !ok {
+		return
+	}
+
+	entry, err := services.AddNotebookEntryTags(*params.NotebookName, credentials, *params.EntryID, params.Tags, revision)
+	if err != nil {
+		jsonServiceError(c, err)
+		return
+	}
+
+	setETag(c, entry.Revision)
+	services.JSONResponse(c, entry)
+}
+
+// RemoveNotebookEntryTags removes tags from an entry in a notebook.
+func RemoveNotebookEntryTags(c *gin.Context) {
+	var params RemoveNotebookEntryTagsParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	revision, err := expectedRevision(c, params.ExpectedRevision)
+	if err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	credentials, ok := requestNotebookCredentials(c, params.NotebookKey, params.KeyfilePath, params.SessionToken)
+	if !ok {
+		return
+	}
+
+	entry, err := services.RemoveNotebookEntryTags(*params.NotebookName, credentials, *params.EntryID, params.Tags, revision)
+	if err != nil {
+		jsonServiceError(c, err)
+		return
+	}
+
+	setETag(c, entry.Revision)
+	services.JSONResponse(c, entry)
+}
+
+// ListNotebookTags lists every tag used in a notebook.
+func ListNotebookTags(c *gin.Context) {
+	var params ListNotebookTagsParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	credentials, ok := requestNotebookCredentials(c, params.NotebookKey, params.KeyfilePath, params.SessionToken)
+	if !ok {
+		return
+	}
+
+	tags, err := services.ListNotebookTags(*params.NotebookName, credentials)
+	if err != nil {
+		jsonServiceError(c, err)
+		return
+	}
+
+	services.JSONResponse(c, tags)
+}
+
+// SetNotebookTagName renames or merges a tag across a notebook.
+func SetNotebookTagName(c *gin.Context) {
+	var params SetNotebookTagNameParams
+	if err := c.ShouldBindQuery(&params); err != nil {
+		services.JSONError(c, err.Error())
+		return
+	}
+
+	credentials, ok := requestNotebookCredentials(c, params.NotebookKey, params.KeyfilePath, params.SessionToken)
+	if !ok {
+		return
+	}
+
+	tag, err := services.SetNotebookTagName(*params.NotebookName, credentials, *params.Tag, *params.NewTag)
+	if err != nil {
+		jsonServiceError(c, err)
+		return
+	}
+
+	services.JSONResponse(c, tag)
+}
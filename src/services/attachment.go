@@ -0,0 +1,425 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	notebookAttachmentsExt = ".attachments"
+	attachmentFileExt = ".enoa"
+	attachmentKeyLength = 32
+	attachmentNameMinLength = 1
+	attachmentNameMaxLength = 256
+	attachmentAdditionalDataLabel = "eno attachment "
+	attachmentSniffLength = 512
+	AttachmentMaxSize = 256 * 1024 * 1024
+)
+
+// NotebookAttachment represents a file attached to a notebook entry. The file's data is encrypted separately from the
+// notebook, under a key that is kept in the notebook's encrypted content.
+type NotebookAttachment struct {
+	ID         string    `json:"id"`
+	EntryID    string    `json:"entryId"`
+	Name       string    `json:"name"`
+	MediaType  string    `json:"mediaType"`
+	Size       int       `json:"size"`
+	CreateTime time.Time `json:"createTime"`
+	Streamed   bool      `json:"streamed,omitempty"`
+	Key        []byte    `json:"key,omitempty"`
+}
+
+// attachmentReader reads an attachment's decrypted data, wiping it and closing its file once done.
+type attachmentReader struct {
+	io.Reader
+	destroy func()
+	file    io.Closer
+}
+
+// Close wipes the attachment's decrypted data and closes its file, if it is still open.
+func (r attachmentReader) Close() error {
+	r.destroy()
+	if r.file == nil {
+		return nil
+	}
+
+	return r.file.Close()
+}
+
+// attachmentDetails gets a copy of an attachment that is safe to return from the API, without its key.
+func attachmentDetails(attachment *NotebookAttachment) *NotebookAttachment {
+	attachmentCopy := *attachment
+	attachmentCopy.Key = nil
+	return &attachmentCopy
+}
+
+// notebookAttachmentsDir gets the path to the directory holding a notebook's attachments from the notebook's ID.
+func notebookAttachmentsDir(notebookID string) string {
+	return fmt.Sprintf("%s/%s%s", notebooksDir, notebookID, notebookAttachmentsExt)
+}
+
+// trashedNotebookAttachmentsDir gets the path to the directory holding a trashed notebook's attachments from its trash ID.
+func trashedNotebookAttachmentsDir(trashID string) string {
+	return fmt.Sprintf("%s/%s%s", notebookTrashDir, trashID, notebookAttachmentsExt)
+}
+
+// attachmentFilepath gets the path to an attachment's encrypted data.
+func attachmentFilepath(notebookID string, attachmentID string) string {
+	return fmt.Sprintf("%s/%s%s", notebookAttachmentsDir(notebookID), attachmentID, attachmentFileExt)
+}
+
+// attachmentAdditionalData gets the data authenticated along with an attachment, which binds its data to its ID so
+// attachment files cannot be swapped around.
+func attachmentAdditionalData(attachment *NotebookAttachment) []byte {
+	return []byte(attachmentAdditionalDataLabel + attachment.ID)
+}
+
+// openInlineAttachment decrypts an attachment written before attachments were streamed, which was sealed in a single
+// piece, into a secure buffer.
+func openInlineAttachment(attachment *NotebookAttachment, blob []byte) (*secureBuffer, error) {
+	block, err := aes.NewCipher(attachment.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	aesgcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := aesgcm.NonceSize()
+	if len(blob) < nonceSize + aesgcm.Overhead() {
+		return nil, fmt.Errorf("attachment data is shorter than the nonce and tag")
+	}
+
+	data := newSecureBuffer(len(blob) - nonceSize - aesgcm.Overhead())
+	_, err = aesgcm.Open(data.Bytes()[:0], blob[:nonceSize], blob[nonceSize:], attachmentAdditionalData(attachment))
+	if err != nil {
+		data.Destroy()
+		return nil, err
+	}
+
+	return data, nil
+}
+
+/*
+writeAttachmentFile encrypts an attachment's data into a temporary file as it is read, so the data never needs to be
+held in memory all at once.
+
+	attachment: the attachment, which has its size set once the data has been written.
+	data:       the attachment's data.
+
+	returns:    the temporary file's path, or an error.
+*/
+func writeAttachmentFile(attachment *NotebookAttachment, data io.Reader) (string, error) {
+	tempFile, err := os.CreateTemp(notebooksDir, "."+attachment.ID+attachmentFileExt+".*"+tempFileExt)
+	if err != nil {
+		return "", err
+	}
+	tempPath := tempFile.Name()
+
+	buffered := bufio.NewWriter(tempFile)
+	stream, err := newStreamWriter(buffered, attachment.Key, attachmentAdditionalData(attachment))
+	if err == nil {
+		defer stream.Destroy()
+
+		var size int64
+		size, err = io.Copy(stream, io.LimitReader(data, AttachmentMaxSize + 1))
+		if err == nil && size > AttachmentMaxSize {
+			err = fmt.Errorf("attachments cannot be larger than %d MiB", AttachmentMaxSize / (1024 * 1024))
+		}
+		attachment.Size = int(size)
+	}
+	if err == nil {
+		err = stream.Close()
+	}
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err == nil {
+		err = tempFile.Sync()
+	}
+	closeErr := tempFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return "", err
+	}
+
+	return tempPath, nil
+}
+
+// deleteNotebookAttachment removes an attachment from a notebook. Its encrypted data is left in place until the
+// notebook has been saved without it, so an update that fails or is never saved leaves the attachment intact.
+func deleteNotebookAttachment(notebook *DecryptedNotebook, attachmentID string) {
+	delete(notebook.Content.Attachments, attachmentID)
+	notebook.deletedAttachments = append(notebook.deletedAttachments, attachmentID)
+}
+
+// deleteEntryAttachments removes every attachment on an entry from a notebook, like deleteNotebookAttachment.
+func deleteEntryAttachments(notebook *DecryptedNotebook, entryID string) {
+	for attachmentID, attachment := range notebook.Content.Attachments {
+		if attachment.EntryID == entryID {
+			deleteNotebookAttachment(notebook, attachmentID)
+		}
+	}
+}
+
+// removeDeletedAttachmentFiles deletes the encrypted data of attachments that have been deleted from a notebook. It is
+// only called once the notebook has been written without them.
+func removeDeletedAttachmentFiles(notebook *DecryptedNotebook, notebookID string) {
+	for _, attachmentID := range notebook.deletedAttachments {
+		filepath := attachmentFilepath(notebookID, attachmentID)
+
+		err := os.Remove(filepath)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Error occurred deleting attachment file (%s): %s", filepath, err)
+		}
+	}
+
+	notebook.deletedAttachments = nil
+}
+
+/*
+CreateNotebookEntryAttachment attaches a file to an entry in a notebook. The file's data is encrypted as it is read
+and written next to the notebook's file rather than inside it, so the notebook stays small however much is attached.
+
+	notebookName: the notebook's name.
+	credentials:  the notebook key or session token used to encrypt/decrypt the notebook.
+	entryID:      the ID of the entry.
+	name:         the attachment's file name.
+	mediaType:    the attachment's media type, or empty to detect it from the data.
+	data:         the attachment's data.
+
+	returns:      the new attachment, or an error.
+*/
+func CreateNotebookEntryAttachment(notebookName string, credentials NotebookCredentials, entryID string, name string, mediaType string, data io.Reader) (*NotebookAttachment, error) {
+	if len(name) < attachmentNameMinLength || len(name) > attachmentNameMaxLength {
+		return nil, fmt.Errorf("attachment name must be between %d and %d characters in length", attachmentNameMinLength, attachmentNameMaxLength)
+	}
+
+	buffered := bufio.NewReaderSize(data, attachmentSniffLength)
+	if mediaType == "" {
+		head, _ := buffered.Peek(attachmentSniffLength)
+		mediaType = http.DetectContentType(head)
+	}
+
+	attachmentID, err := newUUID()
+	if err != nil {
+		log.Printf("Error occurred generating ID for attachment in notebook '%s': %s", notebookName, err)
+		return nil, fmt.Errorf("an unexpected error occurred while attaching the file, check the logs for more details")
+	}
+
+	key := make([]byte, attachmentKeyLength)
+	_, err = io.ReadFull(rand.Reader, key)
+	if err != nil {
+		log.Printf("Error occurred generating key for attachment in notebook '%s': %s", notebookName, err)
+		return nil, fmt.Errorf("an unexpected error occurred while attaching the file, check the logs for more details")
+	}
+
+	attachment := &NotebookAttachment{
+		ID: attachmentID,
+		EntryID: entryID,
+		Name: name,
+		MediaType: mediaType,
+		CreateTime: time.Now(),
+		Streamed: true,
+		Key: key,
+	}
+
+	// The data is encrypted before the notebook is locked, so a slow upload does not hold up other changes to it
+	tempPath, err := writeAttachmentFile(attachment, buffered)
+	if err != nil {
+		log.Printf("Error occurred encrypting attachment in notebook '%s': %s", notebookName, err)
+		if attachment.Size > AttachmentMaxSize {
+			return nil, err
+		}
+		return nil, fmt.Errorf("an unexpected error occurred while attaching the file, check the logs for more details")
+	}
+	defer os.Remove(tempPath)
+
+	var filepath string
+
+	err = updateNotebook(notebookName, credentials, func(notebook *DecryptedNotebook) error {
+		if _, ok := notebook.Content.Entries[entryID]; !ok {
+			return fmt.Errorf("an entry with the specified ID does not exist in this notebook")
+		}
+
+		dir := notebookAttachmentsDir(notebook.ID)
+		err := os.MkdirAll(dir, 0700)
+		if err != nil {
+			log.Printf("Error occurred creating attachments directory (%s): %s", dir, err)
+			return fmt.Errorf("an unexpected error occurred while attaching the file, check the logs for more details")
+		}
+
+		filepath = attachmentFilepath(notebook.ID, attachmentID)
+		err = os.Rename(tempPath, filepath)
+		if err == nil {
+			err = syncDir(dir)
+		}
+		if err != nil {
+			log.Printf("Error occurred moving attachment file into place (%s): %s", filepath, err)
+			return fmt.Errorf("an unexpected error occurred while attaching the file, check the logs for more details")
+		}
+
+		if notebook.Content.Attachments == nil {
+			notebook.Content.Attachments = make(map[string]*NotebookAttachment)
+		}
+		notebook.Content.Attachments[attachmentID] = attachment
+		updateNotebookEditTime(notebook)
+
+		return nil
+	})
+	if err != nil {
+		if filepath != "" {
+			os.Remove(filepath)
+		}
+		return nil, err
+	}
+
+	return attachmentDetails(attachment), nil
+}
+
+/*
+ListNotebookEntryAttachments lists the files attached to an entry in a notebook.
+
+	notebookName: the notebook's name.
+	credentials:  the notebook key or session token used to encrypt/decrypt the notebook.
+	entryID:      the ID of the entry.
+
+	returns:      the entry's attachments from oldest to newest, or an error.
+*/
+func ListNotebookEntryAttachments(notebookName string, credentials NotebookCredentials, entryID string) ([]*NotebookAttachment, error) {
+	attachments := make([]*NotebookAttachment, 0)
+
+	err := viewNotebook(notebookName, credentials, func(notebook *DecryptedNotebook) error {
+		if _, ok := notebook.Content.Entries[entryID]; !ok {
+			return fmt.Errorf("an entry with the specified ID does not exist in this notebook")
+		}
+
+		for _, attachment := range notebook.Content.Attachments {
+			if attachment.EntryID == entryID {
+				attachments = append(attachments, attachmentDetails(attachment))
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(attachments, func(i, j int) bool {
+		return attachments[i].CreateTime.Before(attachments[j].CreateTime)
+	})
+
+	return attachments, nil
+}
+
+/*
+OpenNotebookEntryAttachment opens a file attached to an entry in a notebook, ready for its data to be decrypted as it
+is read. Streamed data is only returned once the segment it is in has been authenticated, but a truncated or tampered
+file is only noticed when that part of it is reached, so the reader's errors must be checked.
+
+	notebookName: the notebook's name.
+	credentials:  the notebook key or session token used to encrypt/decrypt the notebook.
+	attachmentID: the ID of the attachment.
+
+	returns:      the attachment and a reader for its decrypted data, which must be closed, or an error.
+*/
+func OpenNotebookEntryAttachment(notebookName string, credentials NotebookCredentials, attachmentID string) (*NotebookAttachment, io.ReadCloser, error) {
+	var attachment *NotebookAttachment
+	var reader io.ReadCloser
+
+	err := viewNotebook(notebookName, credentials, func(notebook *DecryptedNotebook) error {
+		var ok bool
+		if attachment, ok = notebook.Content.Attachments[attachmentID]; !ok {
+			return fmt.Errorf("an attachment with the specified ID does not exist in this notebook")
+		}
+
+		filepath := attachmentFilepath(notebook.ID, attachmentID)
+		file, err := os.Open(filepath)
+		if err != nil {
+			log.Printf("Error occurred opening attachment file (%s): %s", filepath, err)
+			return fmt.Errorf("an unexpected error occurred while opening the attachment, check the logs for more details")
+		}
+
+		if !attachment.Streamed {
+			defer file.Close()
+
+			blob, err := io.ReadAll(file)
+			if err != nil {
+				log.Printf("Error occurred reading attachment file (%s): %s", filepath, err)
+				return fmt.Errorf("an unexpected error occurred while opening the attachment, check the logs for more details")
+			}
+
+			data, err := openInlineAttachment(attachment, blob)
+			if err != nil {
+				log.Printf("Error occurred decrypting attachment (%s): %s", filepath, err)
+				return fmt.Errorf("the attachment's data has been tampered with or is corrupted")
+			}
+
+			reader = attachmentReader{
+				Reader: bytes.NewReader(data.Bytes()),
+				destroy: data.Destroy,
+			}
+			return nil
+		}
+
+		stream, err := newStreamReader(bufio.NewReader(file), attachment.Key, attachmentAdditionalData(attachment))
+		if err != nil {
+			file.Close()
+			log.Printf("Error occurred decrypting attachment (%s): %s", filepath, err)
+			return fmt.Errorf("the attachment's data has been tampered with or is corrupted")
+		}
+
+		reader = attachmentReader{
+			Reader: stream,
+			destroy: stream.Destroy,
+			file: file,
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return attachmentDetails(attachment), reader, nil
+}
+
+/*
+DeleteNotebookEntryAttachment permanently removes a file attached to an entry in a notebook.
+
+	notebookName: the notebook's name.
+	credentials:  the notebook key or session token used to encrypt/decrypt the notebook.
+	attachmentID: the ID of the attachment.
+
+	returns:      an error, if one occurs.
+*/
+func DeleteNotebookEntryAttachment(notebookName string, credentials NotebookCredentials, attachmentID string) error {
+	return updateNotebook(notebookName, credentials, func(notebook *DecryptedNotebook) error {
+		if _, ok := notebook.Content.Attachments[attachmentID]; !ok {
+			return fmt.Errorf("an attachment with the specified ID does not exist in this notebook")
+		}
+
+		deleteNotebookAttachment(notebook, attachmentID)
+		updateNotebookEditTime(notebook)
+
+		return nil
+	})
+}
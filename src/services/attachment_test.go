@@ -0,0 +1,72 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestDeletedAttachmentFilesKeptUntilSaved checks that a deleted attachment's data is only removed once the notebook
+// has been saved without it, rather than while the delayed save is still pending.
+func TestDeletedAttachmentFilesKeptUntilSaved(t *testing.T) {
+	tests := []struct {
+		name   string
+		delete func(notebookName string, credentials NotebookCredentials, entryID string, attachmentID string) error
+	}{
+		{"delete attachment", func(notebookName string, credentials NotebookCredentials, entryID string, attachmentID string) error {
+			return DeleteNotebookEntryAttachment(notebookName, credentials, attachmentID)
+		}},
+		{"empty entry trash", func(notebookName string, credentials NotebookCredentials, entryID string, attachmentID string) error {
+			err := DeleteNotebookEntry(notebookName, credentials, entryID, nil)
+			if err != nil {
+				return err
+			}
+
+			return EmptyNotebookEntryTrash(notebookName, credentials)
+		}},
+	}
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			notebookName := fmt.Sprintf("Attachment Delete Test %d", i)
+			credentials := unlockTestNotebook(t, notebookName, "attachment-delete-test-key")
+
+			entry, err := CreateNotebookEntry(notebookName, credentials, "entry", "")
+			if err != nil {
+				t.Fatalf("creating entry: %s", err)
+			}
+			attachment, err := CreateNotebookEntryAttachment(notebookName, credentials, entry.ID, "file.txt", "text/plain", strings.NewReader("attached"))
+			if err != nil {
+				t.Fatalf("creating attachment: %s", err)
+			}
+
+			notebookID := cleanFileName(notebookName)
+			err = flushCachedNotebook(notebookID)
+			if err != nil {
+				t.Fatalf("saving notebook: %s", err)
+			}
+
+			err = test.delete(notebookName, credentials, entry.ID, attachment.ID)
+			if err != nil {
+				t.Fatalf("deleting attachment: %s", err)
+			}
+
+			filepath := attachmentFilepath(notebookID, attachment.ID)
+			if _, err := os.Stat(filepath); err != nil {
+				t.Fatalf("expected the attachment's data to be kept until the notebook is saved, got %v", err)
+			}
+
+			err = flushCachedNotebook(notebookID)
+			if err != nil {
+				t.Fatalf("saving notebook: %s", err)
+			}
+
+			if _, err := os.Stat(filepath); !errors.Is(err, fs.ErrNotExist) {
+				t.Errorf("expected the attachment's data to be removed once the notebook is saved, got %v", err)
+			}
+		})
+	}
+}
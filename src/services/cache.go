@@ -0,0 +1,441 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	notebookSaveDelay = 2 * time.Second
+	keyDigestSecretSize = 32
+)
+
+// cachedNotebook represents an unlocked notebook held decrypted in memory.
+type cachedNotebook struct {
+	notebook     *DecryptedNotebook
+	key          *notebookKeyMaterial
+	verifiedKeys []*verifiedNotebookKey
+	dirty        bool
+	saveTimer    *time.Timer
+}
+
+// verifiedNotebookKey represents a notebook key that has already been checked against a cached notebook. Only a digest
+// of the key is kept, along with the key material derived from it, so using the key again skips the key derivation.
+type verifiedNotebookKey struct {
+	digest []byte
+	key    *notebookKeyMaterial
+}
+
+var (
+	notebookCache = make(map[string]*cachedNotebook)
+	notebookCacheMutex sync.Mutex
+
+	// keyDigestSecret keys the digests of verified notebook keys. It is generated when first needed and never leaves
+	// the process, so the digests cannot be checked against guessed keys elsewhere
+	keyDigestSecret *secureBuffer
+)
+
+// copyNotebook makes a deep copy of a decrypted notebook so callers never share the cached one.
+func copyNotebook(notebook *DecryptedNotebook) *DecryptedNotebook {
+	notebookCopy := *notebook
+	notebookCopy.Content.Entries = make(map[string]*NotebookEntry, len(notebook.Content.Entries))
+
+	for entryID, entry := range notebook.Content.Entries {
+		entryCopy := *entry
+		entryCopy.Tags = append([]string(nil), entry.Tags...)
+		notebookCopy.Content.Entries[entryID] = &entryCopy
+	}
+
+	// Revisions are never changed once recorded, so only the lists holding them need copying
+	if notebook.Content.History != nil {
+		notebookCopy.Content.History = make(map[string][]*NotebookEntryRevision, len(notebook.Content.History))
+		for entryID, history := range notebook.Content.History {
+			notebookCopy.Content.History[entryID] = append([]*NotebookEntryRevision(nil), history...)
+		}
+	}
+
+	if notebook.Content.Folders != nil {
+		notebookCopy.Content.Folders = make(map[string]*NotebookFolder, len(notebook.Content.Folders))
+		for path, folder := range notebook.Content.Folders {
+			folderCopy := *folder
+			notebookCopy.Content.Folders[path] = &folderCopy
+		}
+	}
+
+	if notebook.Content.Trash != nil {
+		notebookCopy.Content.Trash = make(map[string]*TrashedNotebookEntry, len(notebook.Content.Trash))
+		for trashID, trashed := range notebook.Content.Trash {
+			trashedCopy := *trashed
+			entryCopy := *trashed.Entry
+			entryCopy.Tags = append([]string(nil), trashed.Entry.Tags...)
+			trashedCopy.Entry = &entryCopy
+			notebookCopy.Content.Trash[trashID] = &trashedCopy
+		}
+	}
+
+	// Attachment keys are never changed once generated, so they can be shared between copies
+	if notebook.Content.Attachments != nil {
+		notebookCopy.Content.Attachments = make(map[string]*NotebookAttachment, len(notebook.Content.Attachments))
+		for attachmentID, attachment := range notebook.Content.Attachments {
+			attachmentCopy := *attachment
+			notebookCopy.Content.Attachments[attachmentID] = &attachmentCopy
+		}
+	}
+
+	copyKeySlots(notebook, &notebookCopy)
+	notebookCopy.entryFiles = copyEntryFiles(notebook.entryFiles)
+	notebookCopy.deletedAttachments = append([]string(nil), notebook.deletedAttachments...)
+	notebookCopy.dataKey = nil
+
+	return &notebookCopy
+}
+
+// copyKeyMaterial makes a copy of key material that can be wiped independently of the original.
+func copyKeyMaterial(key *notebookKeyMaterial) *notebookKeyMaterial {
+	return &notebookKeyMaterial{
+		kdf: key.kdf,
+		key: key.key.Copy(),
+		slotID: key.slotID,
+		recovery: key.recovery,
+		dataKey: key.dataKey.Copy(),
+	}
+}
+
+// notebookKeyDigest computes the digest a verified notebook key is recognized by. The cache mutex must be held.
+func notebookKeyDigest(key string) ([]byte, error) {
+	if keyDigestSecret == nil {
+		secret := newSecureBuffer(keyDigestSecretSize)
+		_, err := rand.Read(secret.Bytes())
+		if err != nil {
+			secret.Destroy()
+			return nil, err
+		}
+		keyDigestSecret = secret
+	}
+
+	mac := hmac.New(sha256.New, keyDigestSecret.Bytes())
+	mac.Write([]byte(key))
+
+	return mac.Sum(nil), nil
+}
+
+/*
+cachedNotebookForKey gets a decrypted copy of a cached notebook if the key has already been verified against it,
+without deriving key material from the key again.
+
+	notebookName: the notebook's name.
+	key:          the notebook key.
+
+	returns:      the decrypted notebook and the key material derived from the key, or false if the key has not been
+	              verified against the notebook or it is not cached.
+*/
+func cachedNotebookForKey(notebookName string, key string) (*DecryptedNotebook, *notebookKeyMaterial, bool) {
+	notebookCacheMutex.Lock()
+	defer notebookCacheMutex.Unlock()
+
+	cached, ok := notebookCache[cleanFileName(notebookName)]
+	if !ok || len(cached.verifiedKeys) == 0 {
+		return nil, nil, false
+	}
+
+	digest, err := notebookKeyDigest(key)
+	if err != nil {
+		log.Printf("Error occurred generating notebook key digest secret: %s", err)
+		return nil, nil, false
+	}
+
+	for _, verified := range cached.verifiedKeys {
+		if hmac.Equal(digest, verified.digest) {
+			return copyNotebook(cached.notebook), copyKeyMaterial(verified.key), true
+		}
+	}
+
+	return nil, nil, false
+}
+
+// rememberVerifiedKey records that a key has been checked against a cached notebook, so cachedNotebookForKey can
+// recognize it. The cache mutex must be held.
+func rememberVerifiedKey(cached *cachedNotebook, key string, keyMaterial *notebookKeyMaterial) {
+	digest, err := notebookKeyDigest(key)
+	if err != nil {
+		log.Printf("Error occurred generating notebook key digest secret: %s", err)
+		return
+	}
+
+	for _, verified := range cached.verifiedKeys {
+		if hmac.Equal(digest, verified.digest) {
+			return
+		}
+	}
+
+	cached.verifiedKeys = append(cached.verifiedKeys, &verifiedNotebookKey{
+		digest: digest,
+		key: copyKeyMaterial(keyMaterial),
+	})
+}
+
+// rememberNotebookKey records that a key has been checked against a notebook, if the notebook is cached.
+func rememberNotebookKey(notebookID string, key string, keyMaterial *notebookKeyMaterial) {
+	notebookCacheMutex.Lock()
+	defer notebookCacheMutex.Unlock()
+
+	if cached, ok := notebookCache[notebookID]; ok {
+		rememberVerifiedKey(cached, key, keyMaterial)
+	}
+}
+
+// cacheNotebook keeps a decrypted copy of an unlocked notebook in memory, unless it is already cached.
+func cacheNotebook(notebook *DecryptedNotebook, key *notebookKeyMaterial) {
+	notebookCacheMutex.Lock()
+	defer notebookCacheMutex.Unlock()
+
+	if _, ok := notebookCache[notebook.ID]; ok {
+		return
+	}
+
+	notebookCache[notebook.ID] = &cachedNotebook{
+		notebook: copyNotebook(notebook),
+		key: copyKeyMaterial(key),
+	}
+}
+
+// saveCachedNotebook encrypts and writes a cached notebook if it has unsaved changes. The notebook's lock must be held
+// for writing, which keeps the cached copy from changing while it is written without holding up the rest of the cache.
+func saveCachedNotebook(cached *cachedNotebook) error {
+	if cached.saveTimer != nil {
+		cached.saveTimer.Stop()
+		cached.saveTimer = nil
+	}
+
+	if !cached.dirty {
+		return nil
+	}
+
+	err := saveNotebook(cached.notebook, cached.key)
+	if err != nil {
+		return err
+	}
+
+	cached.dirty = false
+
+	return nil
+}
+
+// cachedNotebookDetails gets a notebook's details including its pending changes, if it is cached.
+func cachedNotebookDetails(notebookID string) (*NotebookDetails, bool) {
+	notebookCacheMutex.Lock()
+	defer notebookCacheMutex.Unlock()
+
+	cached, ok := notebookCache[notebookID]
+	if !ok {
+		return nil, false
+	}
+
+	return &NotebookDetails{
+		ID: notebookID,
+		Hidden: cached.notebook.Hidden,
+		Name: cached.notebook.Name,
+		Description: cached.notebook.Description,
+		CreateTime: cached.notebook.CreateTime,
+		EditTime: cached.notebook.EditTime,
+		Revision: cached.notebook.Revision,
+	}, true
+}
+
+// flushCachedNotebook writes a cached notebook's pending changes to disk, if it is cached. The notebook's lock must be
+// held for writing.
+func flushCachedNotebook(notebookID string) error {
+	notebookCacheMutex.Lock()
+	cached, ok := notebookCache[notebookID]
+	notebookCacheMutex.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	return saveCachedNotebook(cached)
+}
+
+// evictCachedNotebook drops a notebook from the cache without saving it and wipes its key.
+func evictCachedNotebook(notebookID string) {
+	notebookCacheMutex.Lock()
+	defer notebookCacheMutex.Unlock()
+
+	if cached, ok := notebookCache[notebookID]; ok {
+		if cached.saveTimer != nil {
+			cached.saveTimer.Stop()
+		}
+		wipeKeyMaterial(cached.key)
+		for _, verified := range cached.verifiedKeys {
+			wipeKeyMaterial(verified.key)
+		}
+		delete(notebookCache, notebookID)
+	}
+}
+
+// releaseCachedNotebook saves a notebook's pending changes and then drops it from the cache. The notebook is dropped
+// and its keys wiped even if it cannot be saved, so a locked notebook is never left in memory. The notebook's lock must
+// be held for writing.
+func releaseCachedNotebook(notebookID string) error {
+	err := flushCachedNotebook(notebookID)
+	evictCachedNotebook(notebookID)
+
+	return err
+}
+
+/*
+loadNotebook gets a decrypted copy of a notebook, from the cache if it is unlocked or from disk otherwise. The
+notebook's lock must be held.
+
+	notebookName: the notebook's name.
+	credentials:  the notebook key or session token.
+
+	returns:      the decrypted notebook and its key material, or an error.
+*/
+func loadNotebook(notebookName string, credentials NotebookCredentials) (*DecryptedNotebook, *notebookKeyMaterial, error) {
+	if credentials.SessionToken != "" {
+		notebookID, key, err := sessionNotebookKey(notebookName, credentials.SessionToken)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		notebookCacheMutex.Lock()
+		cached, ok := notebookCache[notebookID]
+		if ok {
+			notebook := copyNotebook(cached.notebook)
+			notebookCacheMutex.Unlock()
+			return notebook, key, nil
+		}
+		notebookCacheMutex.Unlock()
+
+		encryptedNotebook, err := readNotebook(notebookName)
+		if err != nil {
+			wipeKeyMaterial(key)
+			return nil, nil, err
+		}
+
+		notebook, err := decryptNotebook(encryptedNotebook, key)
+		if err != nil {
+			wipeKeyMaterial(key)
+			return nil, nil, err
+		}
+
+		cacheNotebook(notebook, key)
+
+		return notebook, key, nil
+	}
+
+	if credentials.Key == "" {
+		return nil, nil, fmt.Errorf("a notebook key or session token is required")
+	}
+
+	// Deriving key material is deliberately slow, so it is skipped for keys that have already unlocked the cached copy
+	if notebook, key, ok := cachedNotebookForKey(notebookName, credentials.Key); ok {
+		return notebook, key, nil
+	}
+
+	encryptedNotebook, key, err := readNotebookWithKey(notebookName, credentials.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	notebookCacheMutex.Lock()
+	cached, ok := notebookCache[encryptedNotebook.ID]
+	if ok {
+		defer notebookCacheMutex.Unlock()
+
+		// Matching a key slot's key check only shows the key was derived for that slot, so the cached notebook is
+		// only handed out once the slot has also unwrapped the same data key
+		err = unwrapNotebookDataKey(encryptedNotebook, key)
+		if err != nil || !hmac.Equal(key.dataKey.Bytes(), cached.key.dataKey.Bytes()) {
+			wipeKeyMaterial(key)
+			return nil, nil, errIncorrectNotebookKey
+		}
+		rememberVerifiedKey(cached, credentials.Key, key)
+
+		return copyNotebook(cached.notebook), key, nil
+	}
+	notebookCacheMutex.Unlock()
+
+	notebook, err := decryptNotebook(encryptedNotebook, key)
+	if err != nil {
+		wipeKeyMaterial(key)
+		return nil, nil, err
+	}
+
+	return notebook, key, nil
+}
+
+/*
+storeNotebook saves a notebook. Unlocked notebooks are updated in memory and written to disk after a short delay,
+so that bursts of edits are coalesced into a single encrypted save. The notebook's lock must be held for writing.
+
+	notebook: the decrypted notebook.
+	key:      the notebook's key material.
+
+	returns:  an error, if one occurs.
+*/
+func storeNotebook(notebook *DecryptedNotebook, key *notebookKeyMaterial) error {
+	notebookCacheMutex.Lock()
+	cached, ok := notebookCache[notebook.ID]
+	if ok {
+		defer notebookCacheMutex.Unlock()
+
+		cached.notebook = copyNotebook(notebook)
+		cached.dirty = true
+
+		if cached.saveTimer != nil {
+			cached.saveTimer.Stop()
+		}
+		notebookID := notebook.ID
+		cached.saveTimer = time.AfterFunc(notebookSaveDelay, func() {
+			unlock := lockNotebookForWrite(notebookID)
+			defer unlock()
+
+			err := flushCachedNotebook(notebookID)
+			if err != nil {
+				log.Printf("Error occurred saving unlocked notebook in the background (%s): %s", notebookFilepath(notebookID), err)
+			}
+		})
+
+		return nil
+	}
+	notebookCacheMutex.Unlock()
+
+	return saveNotebook(notebook, key)
+}
+
+/*
+FlushNotebooks writes every unlocked notebook's pending changes to disk and clears the cache. It should be called
+before the app exits.
+
+	returns: an error, if any notebook could not be saved. Every notebook is dropped from the cache regardless.
+*/
+func FlushNotebooks() error {
+	notebookCacheMutex.Lock()
+	notebookIDs := make([]string, 0, len(notebookCache))
+	for notebookID := range notebookCache {
+		notebookIDs = append(notebookIDs, notebookID)
+	}
+	notebookCacheMutex.Unlock()
+
+	var flushErr error
+
+	for _, notebookID := range notebookIDs {
+		unlock := lockNotebookForWrite(notebookID)
+		err := releaseCachedNotebook(notebookID)
+		unlock()
+
+		if err != nil {
+			log.Printf("Error occurred saving unlocked notebook on shutdown (%s): %s", notebookFilepath(notebookID), err)
+			flushErr = fmt.Errorf("an unexpected error occurred while saving unlocked notebooks, check the logs for more details")
+		}
+	}
+
+	return flushErr
+}
@@ -17,56 +17,65 @@ const (
 	entryQueryMaxLength = 1024
 )
 
-// updateNotebookEntryEditTime updates a notebook entry's edited timestamp
-func updateNotebookEntryEditTime(notebook *DecryptedNotebook, entryName string) {
-	notebook.Content.Entries[entryName].EditTime = time.Now()
+// updateNotebookEntryEditTime updates a notebook entry's edited timestamp and moves it on to a new revision
+func updateNotebookEntryEditTime(notebook *DecryptedNotebook, entryID string) {
+	notebook.Content.Entries[entryID].EditTime = time.Now()
+	notebook.Content.Entries[entryID].Revision++
 	updateNotebookEditTime(notebook)
 }
 
+// entryWithoutContent copies an entry for a change that only touched its details in the notebook's index, so its
+// content does not need decrypting to be returned.
+func entryWithoutContent(entry *NotebookEntry) *NotebookEntry {
+	entryCopy := *entry
+	entryCopy.Content = ""
+	return &entryCopy
+}
+
 /*
-CreateNotebookEntry creates an entry in a notebook.
+CreateNotebookEntry creates an entry in a notebook. Entry names do not need to be unique, as entries are identified
+by the ID they are given here.
 
 	notebookName: the notebook's name.
-	notebookKey:  key to encrypt/decrypt the notebook.
+	credentials:  the notebook key or session token used to encrypt/decrypt the notebook.
 	entryName:    the name of the new entry.
+	folderPath:   the path of the folder to create the entry in, or an empty path for the root of the notebook.
 
 	returns:      the new notebook entry, or an error.
 */
-func CreateNotebookEntry(notebookName string, notebookKey string, entryName string) (*NotebookEntry, error) {
+func CreateNotebookEntry(notebookName string, credentials NotebookCredentials, entryName string, folderPath string) (*NotebookEntry, error) {
 	if len(entryName) < entryNameMinLength || len(entryName) > entryNameMaxLength {
 		return nil, fmt.Errorf("notebook entry name must be between %d and %d characters in length", entryNameMinLength, entryNameMaxLength)
 	}
 
-	encryptedNotebook, err := readNotebook(notebookName)
+	entryID, err := newUUID()
 	if err != nil {
-		return nil, err
-	}
-
-	decryptedNotebook, err := decryptNotebook(encryptedNotebook, notebookKey)
-	if err != nil {
-		return nil, err
+		log.Printf("Error occurred generating ID for entry in notebook '%s': %s", notebookName, err)
+		return nil, fmt.Errorf("an unexpected error occurred while creating the entry, check the logs for more details")
 	}
 
 	newEntry := NotebookEntry{
+		ID: entryID,
 		Name: entryName,
+		Folder: folderPath,
 		CreateTime: time.Now(),
 		EditTime: time.Time{},
+		Revision: 1,
 		Content: "",
 	}
 
-	if _, ok := decryptedNotebook.Content.Entries[entryName]; ok {
-		return nil, fmt.Errorf("an entry with the specified name already exists in this notebook")
-	}
-
-	decryptedNotebook.Content.Entries[entryName] = &newEntry
-	updateNotebookEditTime(decryptedNotebook)
+	err = updateNotebook(notebookName, credentials, func(notebook *DecryptedNotebook) error {
+		err := checkFolderExists(notebook, folderPath)
+		if err != nil {
+			return err
+		}
 
-	encryptedNotebook, err = encryptNotebook(decryptedNotebook, notebookKey)
-	if err != nil {
-		return nil, err
-	}
+		entry := newEntry
+		notebook.Content.Entries[entryID] = &entry
+		updateNotebookEditTime(notebook)
 
-	err = writeNotebook(encryptedNotebook)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -75,175 +84,181 @@ func CreateNotebookEntry(notebookName string, notebookKey string, entryName stri
 }
 
 /*
-ListNotebookEntries lists all entries in a notebook.
+ListNotebookEntries lists all entries in a notebook. Entries are listed from the notebook's index, without their
+content, which can be fetched an entry at a time with GetNotebookEntry.
 
 	notebookName: the notebook's name.
-	notebookKey:  key to encrypt/decrypt the notebook.
+	credentials:  the notebook key or session token used to encrypt/decrypt the notebook.
+	tags:         only list entries with every one of these tags, or list all entries if there are none.
 
-	returns:      the list of notebook entries as a mapping with entry names as keys, or an error.
+	returns:      the list of notebook entries as a mapping with entry IDs as keys, or an error.
 */
-func ListNotebookEntries(notebookName string, notebookKey string) (map[string]*NotebookEntry, error) {
-	encryptedNotebook, err := readNotebook(notebookName)
-	if err != nil {
-		return nil, err
-	}
-
-	decryptedNotebook, err := decryptNotebook(encryptedNotebook, notebookKey)
+func ListNotebookEntries(notebookName string, credentials NotebookCredentials, tags []string) (map[string]*NotebookEntry, error) {
+	var entries map[string]*NotebookEntry
+
+	err := viewNotebook(notebookName, credentials, func(notebook *DecryptedNotebook) error {
+		entries = notebook.Content.Entries
+		filterEntriesByTags(entries, tags)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return decryptedNotebook.Content.Entries, nil
+	return entries, nil
 }
 
 /*
 GetNotebookEntry gets an entry from the notebook.
 
 	notebookName: the notebook's name.
-	notebookKey:  key to encrypt/decrypt the notebook.
-	entryName:    the name of the entry.
+	credentials:  the notebook key or session token used to encrypt/decrypt the notebook.
+	entryID:      the ID of the entry.
 
 	returns:      the notebook entry, or an error.
 */
-func GetNotebookEntry(notebookName string, notebookKey string, entryName string) (*NotebookEntry, error) {
-	encryptedNotebook, err := readNotebook(notebookName)
-	if err != nil {
-		return nil, err
-	}
+func GetNotebookEntry(notebookName string, credentials NotebookCredentials, entryID string) (*NotebookEntry, error) {
+	var entry *NotebookEntry
+
+	err := viewNotebook(notebookName, credentials, func(notebook *DecryptedNotebook) error {
+		var ok bool
+		if entry, ok = notebook.Content.Entries[entryID]; !ok {
+			return fmt.Errorf("an entry with the specified ID does not exist in this notebook")
+		}
 
-	decryptedNotebook, err := decryptNotebook(encryptedNotebook, notebookKey)
+		return loadEntryBody(notebook, entryID)
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	if entry, ok := decryptedNotebook.Content.Entries[entryName]; ok {
-		return entry, nil
-	} else {
-		return nil, fmt.Errorf("an entry with the specified name does not exist in this notebook")
-	}
+	return entry, nil
 }
 
 /*
 SetNotebookEntryName changes the name of an entry in a notebook.
 
-	notebookName: the notebook's name.
-	notebookKey:  key to encrypt/decrypt the notebook.
-	entryName:    the name of the entry.
-	newEntryName: the new name of the entry.
+	notebookName:     the notebook's name.
+	credentials:      the notebook key or session token used to encrypt/decrypt the notebook.
+	entryID:          the ID of the entry.
+	newEntryName:     the new name of the entry.
+	expectedRevision: the entry revision the caller last read, or nil to skip the check.
 
-	returns:      the notebook entry, or an error.
+	returns:          the updated entry without its content, which is left undecrypted, or an error.
 */
-func SetNotebookEntryName(notebookName string, notebookKey string, entryName string, newEntryName string) (*NotebookEntry, error) {
+func SetNotebookEntryName(notebookName string, credentials NotebookCredentials, entryID string, newEntryName string, expectedRevision *int) (*NotebookEntry, error) {
 	if len(newEntryName) < entryNameMinLength || len(newEntryName) > entryNameMaxLength {
 		return nil, fmt.Errorf("new notebook entry name must be between %d and %d characters in length", entryNameMinLength, entryNameMaxLength)
 	}
 
-	encryptedNotebook, err := readNotebook(notebookName)
-	if err != nil {
-		return nil, err
-	}
-
-	decryptedNotebook, err := decryptNotebook(encryptedNotebook, notebookKey)
-	if err != nil {
-		return nil, err
-	}
+	var entry *NotebookEntry
 
-	if _, ok := decryptedNotebook.Content.Entries[entryName]; !ok {
-		return nil, fmt.Errorf("an entry with the specified name does not exist in this notebook")
-	}
-
-	if _, ok := decryptedNotebook.Content.Entries[newEntryName]; ok {
-		return nil, fmt.Errorf("an entry with the specified new name already exists in this notebook")
-	}
+	err := updateNotebook(notebookName, credentials, func(notebook *DecryptedNotebook) error {
+		var ok bool
+		if entry, ok = notebook.Content.Entries[entryID]; !ok {
+			return fmt.Errorf("an entry with the specified ID does not exist in this notebook")
+		}
 
-	entry := decryptedNotebook.Content.Entries[entryName]
-	entry.Name = newEntryName
-	delete(decryptedNotebook.Content.Entries, entryName)
-	decryptedNotebook.Content.Entries[newEntryName] = entry
-	updateNotebookEntryEditTime(decryptedNotebook, newEntryName)
+		err := checkUnloadedEntryRevision(notebook, entry, expectedRevision)
+		if err != nil {
+			return err
+		}
 
-	encryptedNotebook, err = encryptNotebook(decryptedNotebook, notebookKey)
-	if err != nil {
-		return nil, err
-	}
+		entry.Name = newEntryName
+		updateNotebookEntryEditTime(notebook, entryID)
 
-	err = writeNotebook(encryptedNotebook)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return entry, nil
+	return entryWithoutContent(entry), nil
 }
 
 /*
 SetNotebookEntryContent sets the content of an entry in a notebook.
 
-	notebookName: the notebook's name.
-	notebookKey:  key to encrypt/decrypt the notebook.
-	entryName:    the name of the entry.
-	newContent:   the new entry content.
+	notebookName:     the notebook's name.
+	credentials:      the notebook key or session token used to encrypt/decrypt the notebook.
+	entryID:          the ID of the entry.
+	newContent:       the new entry content.
+	expectedRevision: the entry revision the caller last read, or nil to skip the check.
 
-	returns:      the notebook entry, or an error.
+	returns:          the notebook entry, or an error.
 */
-func SetNotebookEntryContent(notebookName string, notebookKey string, entryName string, newContent string) (*NotebookEntry, error) {
+func SetNotebookEntryContent(notebookName string, credentials NotebookCredentials, entryID string, newContent string, expectedRevision *int) (*NotebookEntry, error) {
 	if len(newContent) < entryContentMinLength || len(newContent) > entryContentMaxLength {
 		return nil, fmt.Errorf("new notebook entry content must be between %d and %d characters in length", entryContentMinLength, entryContentMaxLength)
 	}
 
-	encryptedNotebook, err := readNotebook(notebookName)
-	if err != nil {
-		return nil, err
-	}
+	var entry *NotebookEntry
 
-	decryptedNotebook, err := decryptNotebook(encryptedNotebook, notebookKey)
-	if err != nil {
-		return nil, err
-	}
+	err := updateNotebook(notebookName, credentials, func(notebook *DecryptedNotebook) error {
+		var ok bool
+		if entry, ok = notebook.Content.Entries[entryID]; !ok {
+			return fmt.Errorf("an entry with the specified ID does not exist in this notebook")
+		}
 
-	if _, ok := decryptedNotebook.Content.Entries[entryName]; !ok {
-		return nil, fmt.Errorf("an entry with the specified name does not exist in this notebook")
-	}
+		err := loadEntryBody(notebook, entryID)
+		if err != nil {
+			return err
+		}
 
-	decryptedNotebook.Content.Entries[entryName].Content = newContent
-	updateNotebookEntryEditTime(decryptedNotebook, entryName)
+		err = checkEntryRevision(entry, expectedRevision)
+		if err != nil {
+			return err
+		}
 
-	encryptedNotebook, err = encryptNotebook(decryptedNotebook, notebookKey)
-	if err != nil {
-		return nil, err
-	}
+		setEntryContent(notebook, entry, newContent)
 
-	err = writeNotebook(encryptedNotebook)
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
 
-	return decryptedNotebook.Content.Entries[entryName], nil
+	return entry, nil
 }
 
 /*
 SearchNotebookEntries searches through a notebook's entries for query matches.
 
 	notebookName: the notebook's name.
-	notebookKey:  key to encrypt/decrypt the notebook.
-	query:        the query string.
+	credentials:  the notebook key or session token used to encrypt/decrypt the notebook.
+	query:        the query string. An empty query matches nothing, unless tags are specified.
 	regexSearch:  whether the search is a regex search.
+	tags:         only match entries with every one of these tags.
 
-	returns:      the matched notebook entries as a mapping with entry names as keys, or an error.
+	returns:      the matched notebook entries as a mapping with entry IDs as keys, or an error.
 */
-func SearchNotebookEntries(notebookName string, notebookKey string, query string, regexSearch bool) (map[string]*NotebookEntry, error) {
+func SearchNotebookEntries(notebookName string, credentials NotebookCredentials, query string, regexSearch bool, tags []string) (map[string]*NotebookEntry, error) {
 	if len(query) < entryQueryMinLength || len(query) > entryQueryMaxLength {
 		return nil, fmt.Errorf("notebook entry query must be between %d and %d characters in length", entryQueryMinLength, entryQueryMaxLength)
 	}
 
-	filename := cleanFileName(notebookName)
-	filepath := fmt.Sprintf("%s/%s%s", notebooksDir, filename, notebookFileExt)
+	filepath := notebookFilepath(cleanFileName(notebookName))
 
-	encryptedNotebook, err := readNotebook(notebookName)
-	if err != nil {
-		return nil, err
-	}
+	var entries map[string]*NotebookEntry
+
+	err := viewNotebook(notebookName, credentials, func(notebook *DecryptedNotebook) error {
+		entries = notebook.Content.Entries
+		filterEntriesByTags(entries, tags)
 
-	decryptedNotebook, err := decryptNotebook(encryptedNotebook, notebookKey)
+		// Matching entries are returned with their content, so every entry that could match is decrypted
+		if query == "" && len(tags) == 0 {
+			return nil
+		}
+
+		for entryID := range entries {
+			err := loadEntryBody(notebook, entryID)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -251,20 +266,24 @@ func SearchNotebookEntries(notebookName string, notebookKey string, query string
 	matches := make(map[string]*NotebookEntry)
 
 	if query == "" {
+		if len(tags) > 0 {
+			return entries, nil
+		}
+
 		return matches, nil
 	}
 
-	for entryName, entry := range decryptedNotebook.Content.Entries {
+	for entryID, entry := range entries {
 		if !regexSearch {
-			entryNameLower := strings.ToLower(entryName)
+			entryNameLower := strings.ToLower(entry.Name)
 			entryContentLower := strings.ToLower(entry.Content)
 			queryLower := strings.ToLower(query)
 
 			if strings.Contains(entryNameLower, queryLower) || strings.Contains(entryContentLower, queryLower) {
-				matches[entryName] = entry
+				matches[entryID] = entry
 			}
 		} else {
-			nameMatch, err := regexp.MatchString(query, entryName)
+			nameMatch, err := regexp.MatchString(query, entry.Name)
 			if err != nil {
 				log.Printf("Error occurred performing notebook entry name regex search (%s): %s", filepath, err)
 				return nil, fmt.Errorf("%s", err)
@@ -277,7 +296,7 @@ func SearchNotebookEntries(notebookName string, notebookKey string, query string
 			}
 
 			if nameMatch || contentMatch {
-				matches[entryName] = entry
+				matches[entryID] = entry
 			}
 		}
 	}
@@ -286,41 +305,33 @@ func SearchNotebookEntries(notebookName string, notebookKey string, query string
 }
 
 /*
-DeleteNotebookEntry deletes an entry in a notebook.
+DeleteNotebookEntry moves an entry in a notebook to the notebook's trash.
 
-	notebookName: the notebook's name.
-	notebookKey:  key to encrypt/decrypt the notebook.
-	entryName:    the name of the entry.
+	notebookName:     the notebook's name.
+	credentials:      the notebook key or session token used to encrypt/decrypt the notebook.
+	entryID:          the ID of the entry.
+	expectedRevision: the entry revision the caller last read, or nil to skip the check.
 
-	returns:      an error, if one occurs.
+	returns:          an error, if one occurs.
 */
-func DeleteNotebookEntry(notebookName string, notebookKey string, entryName string) error {
-	encryptedNotebook, err := readNotebook(notebookName)
-	if err != nil {
-		return err
-	}
-
-	decryptedNotebook, err := decryptNotebook(encryptedNotebook, notebookKey)
-	if err != nil {
-		return err
-	}
-
-	if _, ok := decryptedNotebook.Content.Entries[entryName]; !ok {
-		return fmt.Errorf("an entry with the specified name does not exist in this notebook")
-	}
-
-	delete(decryptedNotebook.Content.Entries, entryName)
-	updateNotebookEditTime(decryptedNotebook)
+func DeleteNotebookEntry(notebookName string, credentials NotebookCredentials, entryID string, expectedRevision *int) error {
+	return updateNotebook(notebookName, credentials, func(notebook *DecryptedNotebook) error {
+		entry, ok := notebook.Content.Entries[entryID]
+		if !ok {
+			return fmt.Errorf("an entry with the specified ID does not exist in this notebook")
+		}
 
-	encryptedNotebook, err = encryptNotebook(decryptedNotebook, notebookKey)
-	if err != nil {
-		return err
-	}
+		err := checkUnloadedEntryRevision(notebook, entry, expectedRevision)
+		if err != nil {
+			return err
+		}
 
-	err = writeNotebook(encryptedNotebook)
-	if err != nil {
-		return err
-	}
+		err = trashNotebookEntry(notebook, entryID)
+		if err != nil {
+			return err
+		}
+		updateNotebookEditTime(notebook)
 
-	return nil
+		return nil
+	})
 }
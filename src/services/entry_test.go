@@ -0,0 +1,273 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+)
+
+// TestMain runs the tests inside a scratch directory so no real notebooks or settings are touched.
+func TestMain(m *testing.M) {
+	// The package's init has already created these in the package directory, so only remove them if they are empty
+	os.Remove(notebookTrashDir)
+	os.Remove(notebooksDir)
+	os.Remove(settingsFile)
+
+	dir, err := os.MkdirTemp("", "eno-services-test")
+	if err != nil {
+		panic(err)
+	}
+
+	err = os.Chdir(dir)
+	if err != nil {
+		panic(err)
+	}
+
+	ensureNotebooksDirExists()
+	ensureSettingsFileExists()
+	ensureNotebookTrashDirExists()
+
+	code := m.Run()
+
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// TestConcurrentEntryEdits hammers a notebook's entries from many goroutines and checks that no edit is lost.
+func TestConcurrentEntryEdits(t *testing.T) {
+	const (
+		notebookName = "Concurrency Test"
+		notebookKey = "concurrency-test-key"
+		numSessionWriters = 32
+		numKeyWriters = 4
+	)
+
+	_, err := CreateNotebook(notebookName, "", notebookKey, false)
+	if err != nil {
+		t.Fatalf("creating notebook: %s", err)
+	}
+
+	session, err := UnlockNotebook(notebookName, notebookKey)
+	if err != nil {
+		t.Fatalf("unlocking notebook: %s", err)
+	}
+	sessionCredentials := NotebookCredentials{SessionToken: session.Token}
+	keyCredentials := NotebookCredentials{Key: notebookKey}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, numSessionWriters + numKeyWriters)
+
+	writer := func(credentials NotebookCredentials, entryName string) {
+		defer wg.Done()
+
+		entry, err := CreateNotebookEntry(notebookName, credentials, entryName, "")
+		if err != nil {
+			errs <- fmt.Errorf("creating entry %s: %w", entryName, err)
+			return
+		}
+
+		_, err = SetNotebookEntryContent(notebookName, credentials, entry.ID, "content of " + entryName, nil)
+		if err != nil {
+			errs <- fmt.Errorf("setting content of entry %s: %w", entryName, err)
+		}
+	}
+
+	for i := 0; i < numSessionWriters; i++ {
+		wg.Add(1)
+		go writer(sessionCredentials, fmt.Sprintf("session entry %d", i))
+	}
+	for i := 0; i < numKeyWriters; i++ {
+		wg.Add(1)
+		go writer(keyCredentials, fmt.Sprintf("key entry %d", i))
+	}
+
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	err = LockNotebook(session.Token)
+	if err != nil {
+		t.Fatalf("locking notebook: %s", err)
+	}
+
+	notebook, err := OpenNotebook(notebookName, keyCredentials)
+	if err != nil {
+		t.Fatalf("reopening notebook: %s", err)
+	}
+
+	expected := make([]string, 0, numSessionWriters + numKeyWriters)
+	for i := 0; i < numSessionWriters; i++ {
+		expected = append(expected, fmt.Sprintf("session entry %d", i))
+	}
+	for i := 0; i < numKeyWriters; i++ {
+		expected = append(expected, fmt.Sprintf("key entry %d", i))
+	}
+
+	if len(notebook.Content.Entries) != len(expected) {
+		t.Errorf("expected %d entries, found %d", len(expected), len(notebook.Content.Entries))
+	}
+
+	entriesByName := make(map[string]*NotebookEntry)
+	for entryID, entry := range notebook.Content.Entries {
+		if entry.ID != entryID {
+			t.Errorf("entry %s is stored under ID %s", entry.ID, entryID)
+		}
+		entriesByName[entry.Name] = entry
+	}
+
+	for _, entryName := range expected {
+		entry, ok := entriesByName[entryName]
+		if !ok {
+			t.Errorf("entry %s was lost", entryName)
+			continue
+		}
+
+		entry, err = GetNotebookEntry(notebookName, keyCredentials, entry.ID)
+		if err != nil {
+			t.Errorf("getting entry %s: %s", entryName, err)
+			continue
+		}
+
+		if entry.Content != "content of " + entryName {
+			t.Errorf("content of entry %s was lost, found %q", entryName, entry.Content)
+		}
+	}
+}
+
+// TestStaleEntryRevision checks that an edit made against an outdated entry revision is rejected with the current entry.
+func TestStaleEntryRevision(t *testing.T) {
+	const (
+		notebookName = "Revision Test"
+		notebookKey = "revision-test-key"
+		entryName = "entry"
+	)
+
+	_, err := CreateNotebook(notebookName, "", notebookKey, false)
+	if err != nil {
+		t.Fatalf("creating notebook: %s", err)
+	}
+
+	session, err := UnlockNotebook(notebookName, notebookKey)
+	if err != nil {
+		t.Fatalf("unlocking notebook: %s", err)
+	}
+	defer LockNotebook(session.Token)
+	credentials := NotebookCredentials{SessionToken: session.Token}
+
+	entry, err := CreateNotebookEntry(notebookName, credentials, entryName, "")
+	if err != nil {
+		t.Fatalf("creating entry: %s", err)
+	}
+	seenRevision := entry.Revision
+
+	entry, err = SetNotebookEntryContent(notebookName, credentials, entry.ID, "first client", &seenRevision)
+	if err != nil {
+		t.Fatalf("setting content at the current revision: %s", err)
+	}
+	if entry.Revision != seenRevision + 1 {
+		t.Errorf("expected revision %d after an edit, found %d", seenRevision + 1, entry.Revision)
+	}
+
+	_, err = SetNotebookEntryContent(notebookName, credentials, entry.ID, "second client", &seenRevision)
+	var conflict *RevisionConflictError
+	if !errors.As(err, &conflict) {
+		t.Fatalf("expected a revision conflict, got %v", err)
+	}
+
+	current, ok := conflict.Current.(*NotebookEntry)
+	if !ok || current.Content != "first client" || current.Revision != entry.Revision {
+		t.Errorf("expected the conflict to carry the current entry, got %+v", conflict.Current)
+	}
+}
+
+// unlockTestNotebook creates a notebook and unlocks it for a test, locking it again once the test is over.
+func unlockTestNotebook(t *testing.T, notebookName string, notebookKey string) NotebookCredentials {
+	t.Helper()
+
+	_, err := CreateNotebook(notebookName, "", notebookKey, false)
+	if err != nil {
+		t.Fatalf("creating notebook: %s", err)
+	}
+
+	session, err := UnlockNotebook(notebookName, notebookKey)
+	if err != nil {
+		t.Fatalf("unlocking notebook: %s", err)
+	}
+	t.Cleanup(func() {
+		LockNotebook(session.Token)
+	})
+
+	return NotebookCredentials{SessionToken: session.Token}
+}
+
+// TestStaleEntryRevisionContent checks that changes which leave an entry's content alone still return its current
+// content when the caller's revision is stale.
+func TestStaleEntryRevisionContent(t *testing.T) {
+	const (
+		notebookName = "Stale Content Test"
+		notebookKey = "stale-content-test-key"
+	)
+
+	_, err := CreateNotebook(notebookName, "", notebookKey, false)
+	if err != nil {
+		t.Fatalf("creating notebook: %s", err)
+	}
+	// Using the key rather than a session reads the notebook from disk each time, with its entry bodies not yet loaded
+	credentials := NotebookCredentials{Key: notebookKey}
+
+	entry, err := CreateNotebookEntry(notebookName, credentials, "entry", "")
+	if err != nil {
+		t.Fatalf("creating entry: %s", err)
+	}
+	staleRevision := entry.Revision
+
+	entry, err = SetNotebookEntryContent(notebookName, credentials, entry.ID, "current content", nil)
+	if err != nil {
+		t.Fatalf("setting content: %s", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func() error
+	}{
+		{"rename", func() error {
+			_, err := SetNotebookEntryName(notebookName, credentials, entry.ID, "renamed", &staleRevision)
+			return err
+		}},
+		{"move", func() error {
+			_, err := MoveNotebookEntry(notebookName, credentials, entry.ID, "", &staleRevision)
+			return err
+		}},
+		{"add tags", func() error {
+			_, err := AddNotebookEntryTags(notebookName, credentials, entry.ID, []string{"tag"}, &staleRevision)
+			return err
+		}},
+		{"remove tags", func() error {
+			_, err := RemoveNotebookEntryTags(notebookName, credentials, entry.ID, []string{"tag"}, &staleRevision)
+			return err
+		}},
+		{"delete", func() error {
+			return DeleteNotebookEntry(notebookName, credentials, entry.ID, &staleRevision)
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.change()
+
+			var conflict *RevisionConflictError
+			if !errors.As(err, &conflict) {
+				t.Fatalf("expected a revision conflict, got %v", err)
+			}
+
+			current, ok := conflict.Current.(*NotebookEntry)
+			if !ok || current.Content != "current content" || current.Revision != entry.Revision {
+				t.Errorf("expected the conflict to carry the current entry, got %+v", conflict.Current)
+			}
+		})
+	}
+}
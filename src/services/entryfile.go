@@ -0,0 +1,378 @@
+package services
+
+import (
+	"bufio"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"strings"
+)
+
+const (
+	notebookEntriesExt = ".entries"
+	entryFileExt = ".enoe"
+	entryAdditionalDataLabel = "eno entry "
+	legacyDataKeyLabel = "eno notebook data key"
+)
+
+// notebookEntryBody represents the part of an entry that is encrypted in its own file, next to the notebook's file. The
+// notebook's file only holds an index of everything else, so changing one entry only rewrites its file and the index.
+type notebookEntryBody struct {
+	Content string                   `json:"content"`
+	History []*NotebookEntryRevision `json:"history,omitempty"`
+}
+
+// entryFile tracks which file holds an entry's body and whether the body has been decrypted into memory. Entry files
+// get a new random name whenever they are rewritten and are written before the index that lists them, so a crash
+// during a save leaves the previous index pointing at the previous files.
+type entryFile struct {
+	name    string
+	loaded  bool
+	changed bool
+}
+
+// pendingEntryFile represents an entry body waiting to be written to a new file.
+type pendingEntryFile struct {
+	entryID string
+	name    string
+	body    notebookEntryBody
+}
+
+// notebookEntriesDir gets the path to the directory holding a notebook's entry files from the notebook's ID.
+func notebookEntriesDir(notebookID string) string {
+	return fmt.Sprintf("%s/%s%s", notebooksDir, notebookID, notebookEntriesExt)
+}
+
+// trashedNotebookEntriesDir gets the path to the directory holding a trashed notebook's entry files from its trash ID.
+func trashedNotebookEntriesDir(trashID string) string {
+	return fmt.Sprintf("%s/%s%s", notebookTrashDir, trashID, notebookEntriesExt)
+}
+
+// entryFilepath gets the path to an entry file from its name.
+func entryFilepath(notebookID string, name string) string {
+	return fmt.Sprintf("%s/%s%s", notebookEntriesDir(notebookID), name, entryFileExt)
+}
+
+// legacyDataKey derives the key that entry files were encrypted with before notebooks had a data key of their own.
+func legacyDataKey(key *notebookKeyMaterial) *secureBuffer {
+	mac := hmac.New(sha256.New, key.key.Bytes())
+	mac.Write([]byte(legacyDataKeyLabel))
+	return newSecureBufferFrom(mac.Sum(nil))
+}
+
+// entryAdditionalData gets the data authenticated along with an entry file, which binds the file to its entry and
+// name so files cannot be swapped between entries or replaced with an older version.
+func entryAdditionalData(entryID string, name string) []byte {
+	return []byte(entryAdditionalDataLabel + entryID + " " + name)
+}
+
+// findNotebookEntry finds an entry in a notebook, whether it is in the notebook or its trash.
+func findNotebookEntry(notebook *DecryptedNotebook, entryID string) *NotebookEntry {
+	if entry, ok := notebook.Content.Entries[entryID]; ok {
+		return entry
+	}
+
+	for _, trashed := range notebook.Content.Trash {
+		if trashed.Entry.ID == entryID {
+			return trashed.Entry
+		}
+	}
+
+	return nil
+}
+
+/*
+readEntryFile decrypts an entry's body from its file, only returning it once the whole file has been authenticated.
+
+	notebookID: the notebook's ID.
+	entryID:    the ID of the entry.
+	name:       the name of the entry's file.
+	dataKey:    the notebook's data key.
+
+	returns:    the entry's body, or an error.
+*/
+func readEntryFile(notebookID string, entryID string, name string, dataKey []byte) (*notebookEntryBody, error) {
+	filepath := entryFilepath(notebookID, name)
+
+	file, err := os.Open(filepath)
+	if err != nil {
+		log.Printf("Error occurred opening entry file for decrypting (%s): %s", filepath, err)
+		return nil, fmt.Errorf("an unexpected error occurred while decrypting the entry, check the logs for more details")
+	}
+	defer file.Close()
+
+	var body notebookEntryBody
+
+	stream, err := newStreamReader(bufio.NewReader(file), dataKey, entryAdditionalData(entryID, name))
+	if err == nil {
+		err = decodeSecureJSON(stream, &body)
+		stream.Destroy()
+	}
+	if err != nil {
+		log.Printf("Error occurred decrypting entry file (%s): %s", filepath, err)
+		return nil, fmt.Errorf("entry content has been tampered with or is corrupted")
+	}
+
+	return &body, nil
+}
+
+// writeEntryFile encrypts an entry's body into a new file.
+func writeEntryFile(notebookID string, pending *pendingEntryFile, dataKey []byte) error {
+	return writeFileAtomicFunc(entryFilepath(notebookID, pending.name), func(w io.Writer) error {
+		stream, err := newStreamWriter(w, dataKey, entryAdditionalData(pending.entryID, pending.name))
+		if err != nil {
+			return err
+		}
+		defer stream.Destroy()
+
+		err = encodeSecureJSON(stream, pending.body)
+		if err != nil {
+			return err
+		}
+
+		return stream.Close()
+	})
+}
+
+/*
+loadEntryBody decrypts an entry's content and history into a notebook, if they are not already in memory. It can
+only be called while the notebook is being viewed or updated, which is when its data key is available.
+
+	notebook: the decrypted notebook.
+	entryID:  the ID of the entry, which may be in the notebook's trash.
+
+	returns:  an error, if one occurs.
+*/
+func loadEntryBody(notebook *DecryptedNotebook, entryID string) error {
+	file, ok := notebook.entryFiles[entryID]
+	if !ok || file.loaded {
+		return nil
+	}
+
+	entry := findNotebookEntry(notebook, entryID)
+	if entry == nil {
+		return fmt.Errorf("an entry with the specified ID does not exist in this notebook")
+	}
+
+	if notebook.dataKey == nil {
+		log.Printf("Entry body was needed without the notebook's data key (%s)", notebookFilepath(notebook.ID))
+		return fmt.Errorf("an unexpected error occurred while decrypting the entry, check the logs for more details")
+	}
+
+	body, err := readEntryFile(notebook.ID, entryID, file.name, notebook.dataKey.Bytes())
+	if err != nil {
+		return err
+	}
+
+	entry.Content = body.Content
+	if body.History != nil {
+		if notebook.Content.History == nil {
+			notebook.Content.History = make(map[string][]*NotebookEntryRevision)
+		}
+		notebook.Content.History[entryID] = body.History
+	}
+	file.loaded = true
+
+	return nil
+}
+
+// loadAllEntryBodies decrypts the content and history of every entry in a notebook and its trash.
+func loadAllEntryBodies(notebook *DecryptedNotebook) error {
+	for entryID := range notebook.entryFiles {
+		err := loadEntryBody(notebook, entryID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// markEntryBodyChanged records that an entry's content or history has changed, so its file is rewritten on save.
+func markEntryBodyChanged(notebook *DecryptedNotebook, entryID string) {
+	if file, ok := notebook.entryFiles[entryID]; ok {
+		file.changed = true
+	}
+}
+
+// forgetEntryBody drops an entry's content and history from a notebook, leaving its file to be removed on save.
+func forgetEntryBody(notebook *DecryptedNotebook, entryID string) {
+	delete(notebook.Content.History, entryID)
+	delete(notebook.entryFiles, entryID)
+}
+
+/*
+splitNotebookContent separates a notebook's content into the index that is encrypted in the notebook's file and the
+entry bodies that need writing to files of their own. Entry bodies that have not changed since they were last written
+keep their files.
+
+	notebook: the decrypted notebook.
+
+	returns:  the index content, the entry file each entry is stored in, the entry files to write, or an error.
+*/
+func splitNotebookContent(notebook *DecryptedNotebook) (NotebookContent, map[string]string, []*pendingEntryFile, error) {
+	index := notebook.Content
+	index.History = nil
+	index.Entries = make(map[string]*NotebookEntry, len(notebook.Content.Entries))
+	index.Trash = nil
+
+	entryFiles := make(map[string]string)
+	var pending []*pendingEntryFile
+
+	addEntry := func(entry *NotebookEntry) (*NotebookEntry, error) {
+		file, ok := notebook.entryFiles[entry.ID]
+		if ok && !file.changed {
+			entryFiles[entry.ID] = file.name
+		} else {
+			name, err := newNotebookID()
+			if err != nil {
+				return nil, err
+			}
+
+			entryFiles[entry.ID] = name
+			pending = append(pending, &pendingEntryFile{
+				entryID: entry.ID,
+				name: name,
+				body: notebookEntryBody{
+					Content: entry.Content,
+					History: notebook.Content.History[entry.ID],
+				},
+			})
+		}
+
+		indexEntry := *entry
+		indexEntry.Content = ""
+		return &indexEntry, nil
+	}
+
+	for entryID, entry := range notebook.Content.Entries {
+		indexEntry, err := addEntry(entry)
+		if err != nil {
+			return NotebookContent{}, nil, nil, err
+		}
+		index.Entries[entryID] = indexEntry
+	}
+
+	if notebook.Content.Trash != nil {
+		index.Trash = make(map[string]*TrashedNotebookEntry, len(notebook.Content.Trash))
+		for trashID, trashed := range notebook.Content.Trash {
+			indexEntry, err := addEntry(trashed.Entry)
+			if err != nil {
+				return NotebookContent{}, nil, nil, err
+			}
+
+			trashedCopy := *trashed
+			trashedCopy.Entry = indexEntry
+			trashedCopy.History = nil
+			index.Trash[trashID] = &trashedCopy
+		}
+	}
+
+	return index, entryFiles, pending, nil
+}
+
+// openEntryFiles records the entry files listed in a notebook's index, leaving the bodies in them to be decrypted
+// when they are needed.
+func openEntryFiles(notebook *DecryptedNotebook, entryFiles map[string]string) error {
+	notebook.entryFiles = make(map[string]*entryFile, len(entryFiles))
+
+	check := func(entryID string) error {
+		name, ok := entryFiles[entryID]
+		if !ok || cleanFileName(name) != name {
+			log.Printf("Notebook index is missing the file for entry '%s' (%s)", entryID, notebookFilepath(notebook.ID))
+			return fmt.Errorf("notebook content has been tampered with or is corrupted")
+		}
+
+		notebook.entryFiles[entryID] = &entryFile{
+			name: name,
+		}
+		return nil
+	}
+
+	for entryID := range notebook.Content.Entries {
+		err := check(entryID)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, trashed := range notebook.Content.Trash {
+		err := check(trashed.Entry.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// commitEntryFiles records the entry files a notebook has just been written with, whose bodies are all in memory.
+func commitEntryFiles(notebook *DecryptedNotebook, encryptedNotebook *EncryptedNotebook) {
+	files := make(map[string]*entryFile, len(encryptedNotebook.entryFiles))
+
+	for entryID, name := range encryptedNotebook.entryFiles {
+		file, ok := notebook.entryFiles[entryID]
+		if ok && file.name == name {
+			files[entryID] = file
+			continue
+		}
+
+		files[entryID] = &entryFile{
+			name: name,
+			loaded: true,
+		}
+	}
+
+	notebook.entryFiles = files
+}
+
+// copyEntryFiles makes a copy of a notebook's entry file records that can be changed independently of the original.
+func copyEntryFiles(entryFiles map[string]*entryFile) map[string]*entryFile {
+	if entryFiles == nil {
+		return nil
+	}
+
+	files := make(map[string]*entryFile, len(entryFiles))
+	for entryID, file := range entryFiles {
+		fileCopy := *file
+		files[entryID] = &fileCopy
+	}
+
+	return files
+}
+
+// removeUnusedEntryFiles deletes a notebook's entry files that its index no longer refers to, once the index that
+// replaced them has been written.
+func removeUnusedEntryFiles(notebookID string, entryFiles map[string]string) {
+	dir := notebookEntriesDir(notebookID)
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Error occurred checking for unused entry files (%s): %s", dir, err)
+		}
+		return
+	}
+
+	used := make(map[string]bool, len(entryFiles))
+	for _, name := range entryFiles {
+		used[name + entryFileExt] = true
+	}
+
+	for _, file := range files {
+		if file.IsDir() || isTempFile(file.Name()) || !strings.HasSuffix(file.Name(), entryFileExt) || used[file.Name()] {
+			continue
+		}
+
+		path := fmt.Sprintf("%s/%s", dir, file.Name())
+		err = os.Remove(path)
+		if err != nil {
+			log.Printf("Error occurred deleting unused entry file (%s): %s", path, err)
+		}
+	}
+}
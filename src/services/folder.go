@@ -0,0 +1,425 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	folderNameMinLength = 1
+	folderNameMaxLength = 64
+	folderMaxDepth = 16
+	folderPathSeparator = "/"
+)
+
+// NotebookFolder represents a folder that entries in a notebook can be organised into.
+type NotebookFolder struct {
+	Path       string    `json:"path"`
+	CreateTime time.Time `json:"createTime"`
+}
+
+// NotebookEntrySummary represents a notebook entry's details, without its content.
+type NotebookEntrySummary struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	CreateTime time.Time `json:"createTime"`
+	EditTime   time.Time `json:"editTime"`
+	Revision   int       `json:"revision"`
+}
+
+// NotebookFolderTree represents a folder along with the folders and entries inside it.
+type NotebookFolderTree struct {
+	Name    string                  `json:"name"`
+	Path    string                  `json:"path"`
+	Folders []*NotebookFolderTree   `json:"folders"`
+	Entries []*NotebookEntrySummary `json:"entries"`
+}
+
+// folderName gets the last part of a folder's path.
+func folderName(folderPath string) string {
+	return folderPath[strings.LastIndex(folderPath, folderPathSeparator) + 1:]
+}
+
+// parentFolderPath gets the path of the folder containing a folder, which is empty for the root of the notebook.
+func parentFolderPath(folderPath string) string {
+	i := strings.LastIndex(folderPath, folderPathSeparator)
+	if i < 0 {
+		return ""
+	}
+
+	return folderPath[:i]
+}
+
+// joinFolderPath gets the path of a folder inside another, where an empty parent path is the root of the notebook.
+func joinFolderPath(parentPath string, name string) string {
+	if parentPath == "" {
+		return name
+	}
+
+	return parentPath + folderPathSeparator + name
+}
+
+// folderContains reports whether a path is a folder or is anywhere inside it.
+func folderContains(folderPath string, path string) bool {
+	return path == folderPath || strings.HasPrefix(path, folderPath + folderPathSeparator)
+}
+
+// checkFolderName makes sure a folder's name can be used as part of a path.
+func checkFolderName(name string) error {
+	if len(name) < folderNameMinLength || len(name) > folderNameMaxLength {
+		return fmt.Errorf("folder names must be between %d and %d characters in length", folderNameMinLength, folderNameMaxLength)
+	}
+
+	if strings.Contains(name, folderPathSeparator) {
+		return fmt.Errorf("folder names cannot contain '%s'", folderPathSeparator)
+	}
+
+	return nil
+}
+
+// checkFolderPath makes sure a folder's path is well formed and not nested too deeply.
+func checkFolderPath(folderPath string) error {
+	names := strings.Split(folderPath, folderPathSeparator)
+	if len(names) > folderMaxDepth {
+		return fmt.Errorf("folders cannot be nested more than %d deep", folderMaxDepth)
+	}
+
+	for _, name := range names {
+		err := checkFolderName(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkFolderExists makes sure a folder exists in a notebook. The empty path, for the root of the notebook, always exists.
+func checkFolderExists(notebook *DecryptedNotebook, folderPath string) error {
+	if folderPath == "" {
+		return nil
+	}
+
+	if _, ok := notebook.Content.Folders[folderPath]; !ok {
+		return fmt.Errorf("the specified folder does not exist in this notebook")
+	}
+
+	return nil
+}
+
+// ensureFolderExists creates a folder in a notebook, along with any of its parents that are missing.
+func ensureFolderExists(notebook *DecryptedNotebook, folderPath string) {
+	if folderPath == "" {
+		return
+	}
+
+	if notebook.Content.Folders == nil {
+		notebook.Content.Folders = make(map[string]*NotebookFolder)
+	}
+
+	for path := folderPath; path != ""; path = parentFolderPath(path) {
+		if _, ok := notebook.Content.Folders[path]; ok {
+			break
+		}
+
+		notebook.Content.Folders[path] = &NotebookFolder{
+			Path: path,
+			CreateTime: time.Now(),
+		}
+	}
+}
+
+// moveFolder changes the path of a folder and everything inside it.
+func moveFolder(notebook *DecryptedNotebook, folderPath string, newFolderPath string) {
+	for path, folder := range notebook.Content.Folders {
+		if folderContains(folderPath, path) {
+			delete(notebook.Content.Folders, path)
+			folder.Path = newFolderPath + strings.TrimPrefix(path, folderPath)
+			notebook.Content.Folders[folder.Path] = folder
+		}
+	}
+
+	for _, entry := range notebook.Content.Entries {
+		if folderContains(folderPath, entry.Folder) {
+			entry.Folder = newFolderPath + strings.TrimPrefix(entry.Folder, folderPath)
+		}
+	}
+}
+
+/*
+CreateNotebookFolder creates a folder in a notebook.
+
+	notebookName: the notebook's name.
+	credentials:  the notebook key or session token used to encrypt/decrypt the notebook.
+	folderPath:   the path of the new folder, with each folder name separated by '/'. Its parent must already exist.
+
+	returns:      the new folder, or an error.
+*/
+func CreateNotebookFolder(notebookName string, credentials NotebookCredentials, folderPath string) (*NotebookFolder, error) {
+	err := checkFolderPath(folderPath)
+	if err != nil {
+		return nil, err
+	}
+
+	newFolder := NotebookFolder{
+		Path: folderPath,
+		CreateTime: time.Now(),
+	}
+
+	err = updateNotebook(notebookName, credentials, func(notebook *DecryptedNotebook) error {
+		if _, ok := notebook.Content.Folders[folderPath]; ok {
+			return fmt.Errorf("a folder with the specified path already exists in this notebook")
+		}
+
+		err := checkFolderExists(notebook, parentFolderPath(folderPath))
+		if err != nil {
+			return fmt.Errorf("the parent of the specified folder does not exist in this notebook")
+		}
+
+		if notebook.Content.Folders == nil {
+			notebook.Content.Folders = make(map[string]*NotebookFolder)
+		}
+
+		folder := newFolder
+		notebook.Content.Folders[folderPath] = &folder
+		updateNotebookEditTime(notebook)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &newFolder, nil
+}
+
+/*
+SetNotebookFolderName renames a folder in a notebook, keeping it in the same parent folder.
+
+	notebookName:  the notebook's name.
+	credentials:   the notebook key or session token used to encrypt/decrypt the notebook.
+	folderPath:    the path of the folder.
+	newFolderName: the folder's new name.
+
+	returns:       the renamed folder, or an error.
+*/
+func SetNotebookFolderName(notebookName string, credentials NotebookCredentials, folderPath string, newFolderName string) (*NotebookFolder, error) {
+	err := checkFolderName(newFolderName)
+	if err != nil {
+		return nil, err
+	}
+
+	return MoveNotebookFolder(notebookName, credentials, folderPath, joinFolderPath(parentFolderPath(folderPath), newFolderName))
+}
+
+/*
+MoveNotebookFolder moves a folder, along with everything inside it, to a new path in a notebook.
+
+	notebookName:  the notebook's name.
+	credentials:   the notebook key or session token used to encrypt/decrypt the notebook.
+	folderPath:    the path of the folder.
+	newFolderPath: the folder's new path. Its parent must already exist.
+
+	returns:       the moved folder, or an error.
+*/
+func MoveNotebookFolder(notebookName string, credentials NotebookCredentials, folderPath string, newFolderPath string) (*NotebookFolder, error) {
+	err := checkFolderPath(newFolderPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var folder NotebookFolder
+
+	err = updateNotebook(notebookName, credentials, func(notebook *DecryptedNotebook) error {
+		if _, ok := notebook.Content.Folders[folderPath]; !ok {
+			return fmt.Errorf("the specified folder does not exist in this notebook")
+		}
+
+		if folderContains(folderPath, newFolderPath) {
+			return fmt.Errorf("a folder cannot be moved inside itself")
+		}
+
+		if _, ok := notebook.Content.Folders[newFolderPath]; ok {
+			return fmt.Errorf("a folder with the specified new path already exists in this notebook")
+		}
+
+		err := checkFolderExists(notebook, parentFolderPath(newFolderPath))
+		if err != nil {
+			return fmt.Errorf("the parent of the specified new folder path does not exist in this notebook")
+		}
+
+		for path := range notebook.Content.Folders {
+			if folderContains(folderPath, path) {
+				err = checkFolderPath(newFolderPath + strings.TrimPrefix(path, folderPath))
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		moveFolder(notebook, folderPath, newFolderPath)
+		folder = *notebook.Content.Folders[newFolderPath]
+		updateNotebookEditTime(notebook)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &folder, nil
+}
+
+/*
+DeleteNotebookFolder deletes a folder and every folder inside it, moving the entries they contain to the notebook's trash.
+
+	notebookName: the notebook's name.
+	credentials:  the notebook key or session token used to encrypt/decrypt the notebook.
+	folderPath:   the path of the folder.
+
+	returns:      an error, if one occurs.
+*/
+func DeleteNotebookFolder(notebookName string, credentials NotebookCredentials, folderPath string) error {
+	return updateNotebook(notebookName, credentials, func(notebook *DecryptedNotebook) error {
+		if _, ok := notebook.Content.Folders[folderPath]; !ok {
+			return fmt.Errorf("the specified folder does not exist in this notebook")
+		}
+
+		for entryID, entry := range notebook.Content.Entries {
+			if folderContains(folderPath, entry.Folder) {
+				err := trashNotebookEntry(notebook, entryID)
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		for path := range notebook.Content.Folders {
+			if folderContains(folderPath, path) {
+				delete(notebook.Content.Folders, path)
+			}
+		}
+
+		updateNotebookEditTime(notebook)
+
+		return nil
+	})
+}
+
+/*
+MoveNotebookEntry moves an entry into a folder in a notebook.
+
+	notebookName:     the notebook's name.
+	credentials:      the notebook key or session token used to encrypt/decrypt the notebook.
+	entryID:          the ID of the entry.
+	folderPath:       the path of the folder to move the entry into, or an empty path for the root of the notebook.
+	expectedRevision: the entry revision the caller last read, or nil to skip the check.
+
+	returns:          the updated entry without its content, which is left undecrypted, or an error.
+*/
+func MoveNotebookEntry(notebookName string, credentials NotebookCredentials, entryID string, folderPath string, expectedRevision *int) (*NotebookEntry, error) {
+	var entry *NotebookEntry
+
+	err := updateNotebook(notebookName, credentials, func(notebook *DecryptedNotebook) error {
+		var ok bool
+		if entry, ok = notebook.Content.Entries[entryID]; !ok {
+			return fmt.Errorf("an entry with the specified ID does not exist in this notebook")
+		}
+
+		err := checkUnloadedEntryRevision(notebook, entry, expectedRevision)
+		if err != nil {
+			return err
+		}
+
+		err = checkFolderExists(notebook, folderPath)
+		if err != nil {
+			return err
+		}
+
+		entry.Folder = folderPath
+		updateNotebookEntryEditTime(notebook, entryID)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entryWithoutContent(entry), nil
+}
+
+/*
+GetNotebookEntryTree lists a notebook's folders and entries as a tree, starting from the root of the notebook.
+
+	notebookName: the notebook's name.
+	credentials:  the notebook key or session token used to encrypt/decrypt the notebook.
+
+	returns:      the root folder of the tree, or an error.
+*/
+func GetNotebookEntryTree(notebookName string, credentials NotebookCredentials) (*NotebookFolderTree, error) {
+	root := &NotebookFolderTree{
+		Folders: make([]*NotebookFolderTree, 0),
+		Entries: make([]*NotebookEntrySummary, 0),
+	}
+
+	err := viewNotebook(notebookName, credentials, func(notebook *DecryptedNotebook) error {
+		folders := map[string]*NotebookFolderTree{"": root}
+
+		paths := make([]string, 0, len(notebook.Content.Folders))
+		for path := range notebook.Content.Folders {
+			paths = append(paths, path)
+		}
+		// Sorting puts each folder's parent before it
+		sort.Strings(paths)
+
+		for _, path := range paths {
+			folder := &NotebookFolderTree{
+				Name: folderName(path),
+				Path: path,
+				Folders: make([]*NotebookFolderTree, 0),
+				Entries: make([]*NotebookEntrySummary, 0),
+			}
+			folders[path] = folder
+
+			parent, ok := folders[parentFolderPath(path)]
+			if !ok {
+				parent = root
+			}
+			parent.Folders = append(parent.Folders, folder)
+		}
+
+		for _, entry := range notebook.Content.Entries {
+			folder, ok := folders[entry.Folder]
+			if !ok {
+				folder = root
+			}
+
+			folder.Entries = append(folder.Entries, &NotebookEntrySummary{
+				ID: entry.ID,
+				Name: entry.Name,
+				CreateTime: entry.CreateTime,
+				EditTime: entry.EditTime,
+				Revision: entry.Revision,
+			})
+		}
+
+		for _, folder := range folders {
+			sort.Slice(folder.Entries, func(i, j int) bool {
+				if folder.Entries[i].Name != folder.Entries[j].Name {
+					return folder.Entries[i].Name < folder.Entries[j].Name
+				}
+
+				return folder.Entries[i].ID < folder.Entries[j].ID
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return root, nil
+}
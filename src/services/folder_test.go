@@ -0,0 +1,172 @@
+package services
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// createTestFolders creates the folders a, a/b, a/b/c, ab and d in a new notebook, with an entry in a/b and another
+// in d, and gets the entries' IDs by folder.
+func createTestFolders(t *testing.T, notebookName string) (NotebookCredentials, map[string]string) {
+	t.Helper()
+
+	credentials := unlockTestNotebook(t, notebookName, "folder-test-key")
+
+	for _, path := range []string{"a", "a/b", "a/b/c", "ab", "d"} {
+		_, err := CreateNotebookFolder(notebookName, credentials, path)
+		if err != nil {
+			t.Fatalf("creating folder %s: %s", path, err)
+		}
+	}
+
+	entryIDs := make(map[string]string)
+	for _, path := range []string{"a/b", "d"} {
+		entry, err := CreateNotebookEntry(notebookName, credentials, "entry in " + path, path)
+		if err != nil {
+			t.Fatalf("creating entry in %s: %s", path, err)
+		}
+		entryIDs[path] = entry.ID
+	}
+
+	return credentials, entryIDs
+}
+
+// listTestFolders gets the paths of every folder in a notebook, sorted, and the folder each entry is in.
+func listTestFolders(t *testing.T, notebookName string, credentials NotebookCredentials) ([]string, map[string]string) {
+	t.Helper()
+
+	tree, err := GetNotebookEntryTree(notebookName, credentials)
+	if err != nil {
+		t.Fatalf("getting entry tree: %s", err)
+	}
+
+	paths := make([]string, 0)
+	entryFolders := make(map[string]string)
+
+	var walk func(folder *NotebookFolderTree)
+	walk = func(folder *NotebookFolderTree) {
+		for _, entry := range folder.Entries {
+			entryFolders[entry.ID] = folder.Path
+		}
+		for _, child := range folder.Folders {
+			paths = append(paths, child.Path)
+			walk(child)
+		}
+	}
+	walk(tree)
+	sort.Strings(paths)
+
+	return paths, entryFolders
+}
+
+// TestMoveNotebookFolder checks that moving a folder moves everything inside it, and that invalid moves change nothing.
+func TestMoveNotebookFolder(t *testing.T) {
+	unchanged := []string{"a", "a/b", "a/b/c", "ab", "d"}
+
+	tests := []struct {
+		name            string
+		folderPath      string
+		newFolderPath   string
+		wantErr         bool
+		expectedFolders []string
+		expectedEntries map[string]string
+	}{
+		{"into another folder", "a", "d/a", false,
+			[]string{"ab", "d", "d/a", "d/a/b", "d/a/b/c"}, map[string]string{"a/b": "d/a/b", "d": "d"}},
+		{"to the root", "a/b", "b", false,
+			[]string{"a", "ab", "b", "b/c", "d"}, map[string]string{"a/b": "b", "d": "d"}},
+		{"into its own subtree", "a", "a/b/a", true, unchanged, nil},
+		{"into its own child", "a/b", "a/b/c/b", true, unchanged, nil},
+		{"onto itself", "a", "a", true, unchanged, nil},
+		{"onto an existing folder", "a", "ab", true, unchanged, nil},
+		{"into a missing parent", "a", "x/a", true, unchanged, nil},
+		{"a missing folder", "x", "d/x", true, unchanged, nil},
+		{"to an invalid path", "a", "d//a", true, unchanged, nil},
+	}
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			notebookName := fmt.Sprintf("Folder Move Test %d", i)
+			credentials, entryIDs := createTestFolders(t, notebookName)
+
+			_, err := MoveNotebookFolder(notebookName, credentials, test.folderPath, test.newFolderPath)
+			if test.wantErr != (err != nil) {
+				t.Fatalf("expected an error to be %t, got %v", test.wantErr, err)
+			}
+
+			expectedEntries := test.expectedEntries
+			if expectedEntries == nil {
+				expectedEntries = map[string]string{"a/b": "a/b", "d": "d"}
+			}
+
+			folders, entryFolders := listTestFolders(t, notebookName, credentials)
+			if !reflect.DeepEqual(folders, test.expectedFolders) {
+				t.Errorf("expected folders %v, found %v", test.expectedFolders, folders)
+			}
+			for path, expectedFolder := range expectedEntries {
+				if entryFolders[entryIDs[path]] != expectedFolder {
+					t.Errorf("expected the entry from %s to be in %s, found %s", path, expectedFolder, entryFolders[entryIDs[path]])
+				}
+			}
+		})
+	}
+}
+
+// TestDeleteNotebookFolder checks that deleting a folder deletes the folders inside it and trashes their entries.
+func TestDeleteNotebookFolder(t *testing.T) {
+	tests := []struct {
+		name            string
+		folderPath      string
+		wantErr         bool
+		expectedFolders []string
+		expectedTrashed []string
+	}{
+		{"folder with subfolders", "a", false, []string{"ab", "d"}, []string{"a/b"}},
+		{"innermost folder", "a/b/c", false, []string{"a", "a/b", "ab", "d"}, []string{}},
+		{"folder with an entry", "d", false, []string{"a", "a/b", "a/b/c", "ab"}, []string{"d"}},
+		{"missing folder", "x", true, []string{"a", "a/b", "a/b/c", "ab", "d"}, []string{}},
+	}
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			notebookName := fmt.Sprintf("Folder Delete Test %d", i)
+			credentials, entryIDs := createTestFolders(t, notebookName)
+
+			err := DeleteNotebookFolder(notebookName, credentials, test.folderPath)
+			if test.wantErr != (err != nil) {
+				t.Fatalf("expected an error to be %t, got %v", test.wantErr, err)
+			}
+
+			folders, entryFolders := listTestFolders(t, notebookName, credentials)
+			if !reflect.DeepEqual(folders, test.expectedFolders) {
+				t.Errorf("expected folders %v, found %v", test.expectedFolders, folders)
+			}
+
+			trashedEntries, err := ListTrashedNotebookEntries(notebookName, credentials)
+			if err != nil {
+				t.Fatalf("listing trashed entries: %s", err)
+			}
+			trashedIDs := make(map[string]bool)
+			for _, trashedEntry := range trashedEntries {
+				trashedIDs[trashedEntry.Entry.ID] = true
+			}
+
+			trashed := make([]string, 0)
+			for path, entryID := range entryIDs {
+				_, inFolder := entryFolders[entryID]
+				if inFolder == trashedIDs[entryID] {
+					t.Errorf("expected the entry from %s to be either in the trash or in a folder", path)
+				}
+				if trashedIDs[entryID] {
+					trashed = append(trashed, path)
+				}
+			}
+			sort.Strings(trashed)
+			if !reflect.DeepEqual(trashed, test.expectedTrashed) {
+				t.Errorf("expected the entries from %v to be trashed, found %v", test.expectedTrashed, trashed)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+)
+
+const (
+	notebookFormatLegacy = 0
+	notebookFormatVersioned = 1
+	notebookFormatAuthenticatedHeader = 2
+	notebookFormatHiddenMetadata = 3
+	notebookFormatRevisions = 4
+	notebookFormatEntryIDs = 5
+	notebookFormatStream = 6
+	notebookFormatEntryFiles = 7
+	notebookFormatDataKey = 8
+	notebookFormatKeySlots = 9
+	notebookFormatBoundKeyChecks = 10
+	notebookFormatBoundRecoveryKeys = 11
+	notebookFormatVersion = notebookFormatBoundRecoveryKeys
+	notebookCipherAES256GCM = "aes-256-gcm"
+	notebookKeyCheckLabel = "eno notebook key check"
+)
+
+// notebookHeader is the plaintext part of a notebook file that is authenticated as additional data.
+type notebookHeader struct {
+	Version     int          `json:"version"`
+	Cipher      string       `json:"cipher"`
+	Hidden      bool         `json:"hidden,omitempty"`
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	CreateTime  time.Time    `json:"createTime"`
+	EditTime    time.Time    `json:"editTime"`
+	Revision    int          `json:"revision,omitempty"`
+	KDF         *NotebookKDF `json:"kdf"`
+}
+
+// notebookMigration upgrades a decrypted notebook's content from one format version to the next.
+type notebookMigration func(notebook *DecryptedNotebook) error
+
+// notebookMigrations maps a format version to the migration that upgrades content from that version to the next one.
+var notebookMigrations = map[int]notebookMigration{
+	notebookFormatLegacy: func(notebook *DecryptedNotebook) error {
+		if notebook.Content.Entries == nil {
+			notebook.Content.Entries = make(map[string]*NotebookEntry)
+		}
+
+		return nil
+	},
+	notebookFormatRevisions: func(notebook *DecryptedNotebook) error {
+		// Entries and their history were keyed by entry name, so each entry is given an ID and re-keyed by it
+		entries := make(map[string]*NotebookEntry, len(notebook.Content.Entries))
+		history := make(map[string][]*NotebookEntryRevision, len(notebook.Content.History))
+
+		for entryName, entry := range notebook.Content.Entries {
+			entryID, err := newUUID()
+			if err != nil {
+				return err
+			}
+
+			entry.ID = entryID
+			entries[entryID] = entry
+			if entryHistory, ok := notebook.Content.History[entryName]; ok {
+				history[entryID] = entryHistory
+			}
+		}
+
+		for _, trashed := range notebook.Content.Trash {
+			entryID, err := newUUID()
+			if err != nil {
+				return err
+			}
+
+			trashed.Entry.ID = entryID
+		}
+
+		notebook.Content.Entries = entries
+		notebook.Content.History = history
+		if len(history) == 0 {
+			notebook.Content.History = nil
+		}
+
+		return nil
+	},
+	notebookFormatStream: func(notebook *DecryptedNotebook) error {
+		// Trashed entries kept their history alongside them, but it now lives with the rest of the history, keyed by
+		// entry ID, so that it is written to the entry's file
+		for _, trashed := range notebook.Content.Trash {
+			if trashed.History == nil {
+				continue
+			}
+
+			if notebook.Content.History == nil {
+				notebook.Content.History = make(map[string][]*NotebookEntryRevision)
+			}
+			notebook.Content.History[trashed.Entry.ID] = trashed.History
+			trashed.History = nil
+		}
+
+		return nil
+	},
+}
+
+// checkNotebookFormat verifies that a notebook's on-disk format can be read by this version of the app.
+func checkNotebookFormat(notebook *EncryptedNotebook, filepath string) error {
+	if notebook.Version > notebookFormatVersion {
+		log.Printf("Notebook format version %d is newer than the supported version %d (%s)", notebook.Version, notebookFormatVersion, filepath)
+		return fmt.Errorf("the notebook was created by a newer version of the app and cannot be opened")
+	}
+
+	if notebook.Version > notebookFormatLegacy && notebook.Cipher != notebookCipherAES256GCM {
+		log.Printf("Notebook uses unsupported cipher '%s' (%s)", notebook.Cipher, filepath)
+		return fmt.Errorf("the notebook uses an unsupported cipher and cannot be opened")
+	}
+
+	if notebook.Hidden && notebook.Version < notebookFormatHiddenMetadata {
+		log.Printf("Notebook is marked hidden but uses format version %d (%s)", notebook.Version, filepath)
+		return fmt.Errorf("the notebook file is corrupted and cannot be opened")
+	}
+
+	return nil
+}
+
+// notebookHasAuthenticatedHeader reports whether a notebook's header was bound to its content when it was encrypted.
+func notebookHasAuthenticatedHeader(notebook *EncryptedNotebook) bool {
+	return notebook.Version >= notebookFormatAuthenticatedHeader
+}
+
+// notebookHasEntryFiles reports whether a notebook keeps its entries' content and history in files of their own.
+func notebookHasEntryFiles(notebook *EncryptedNotebook) bool {
+	return notebook.Version >= notebookFormatEntryFiles
+}
+
+// notebookHasDataKey reports whether a notebook's content is encrypted under a data key wrapped by its notebook key.
+func notebookHasDataKey(notebook *EncryptedNotebook) bool {
+	return notebook.Version >= notebookFormatDataKey
+}
+
+// notebookHasKeySlots reports whether a notebook's data key is wrapped once for each of several key slots.
+func notebookHasKeySlots(notebook *EncryptedNotebook) bool {
+	return notebook.Version >= notebookFormatKeySlots
+}
+
+// notebookAdditionalData serializes a notebook's header for use as AEAD additional data.
+func notebookAdditionalData(notebook *EncryptedNotebook) ([]byte, error) {
+	header := notebookHeader{
+		Version: notebook.Version,
+		Cipher: notebook.Cipher,
+		Hidden: notebook.Hidden,
+		Name: notebook.Name,
+		Description: notebook.Description,
+		CreateTime: notebook.CreateTime,
+		EditTime: notebook.EditTime,
+		Revision: notebook.Revision,
+		KDF: notebook.KDF,
+	}
+
+	// A wrapped data key can only be unwrapped with the key derivation parameters it was wrapped with, so they are
+	// already protected and are left out, which lets the notebook key change without the content changing
+	if notebookHasDataKey(notebook) {
+		header.KDF = nil
+	}
+
+	return json.Marshal(header)
+}
+
+// notebookKeyCheck computes a value that tells a wrong key apart from a tampered header.
+func notebookKeyCheck(derivedKey []byte) []byte {
+	mac := hmac.New(sha256.New, derivedKey)
+	mac.Write([]byte(notebookKeyCheckLabel))
+	return mac.Sum(nil)
+}
+
+// notebookNeedsUpgrade reports whether a notebook was written in an older format than the current one.
+func notebookNeedsUpgrade(notebook *EncryptedNotebook) bool {
+	return notebook.Version < notebookFormatVersion
+}
+
+// migrateNotebookContent brings a freshly decrypted notebook's content up to the newest format.
+func migrateNotebookContent(version int, notebook *DecryptedNotebook) error {
+	for v := version; v < notebookFormatVersion; v++ {
+		migrate, ok := notebookMigrations[v]
+		if !ok {
+			continue
+		}
+
+		err := migrate(notebook)
+		if err != nil {
+			log.Printf("Error occurred migrating notebook '%s' from format version %d: %s", notebook.Name, v, err)
+			return fmt.Errorf("an unexpected error occurred while upgrading the notebook, check the logs for more details")
+		}
+	}
+
+	return nil
+}
+
+/*
+upgradeNotebook rewrites a notebook's file in the newest format.
+
+	version:  the format version the notebook was read from.
+	notebook: the decrypted notebook, with its content already migrated.
+	key:      the key material to encrypt the notebook.
+
+	returns:  an error, if one occurs.
+*/
+func upgradeNotebook(version int, notebook *DecryptedNotebook, key *notebookKeyMaterial) error {
+	err := saveNotebook(notebook, key)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Upgraded notebook '%s' from format version %d to %d", notebook.Name, version, notebookFormatVersion)
+
+	return nil
+}
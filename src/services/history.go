@@ -0,0 +1,240 @@
+package services
+
+import (
+	"fmt"
+	"time"
+
+	util "eno/src/util"
+)
+
+const (
+	entryHistoryMaxRevisions = 50
+	entryHistoryMaxSize = 16 * entryContentMaxLength
+)
+
+// NotebookEntryRevision represents a previous version of a notebook entry's content.
+type NotebookEntryRevision struct {
+	Revision int       `json:"revision"`
+	EditTime time.Time `json:"editTime"`
+	Content  string    `json:"content"`
+}
+
+// NotebookEntryRevisionDetails represents the details of a version of a notebook entry's content.
+type NotebookEntryRevisionDetails struct {
+	Revision int       `json:"revision"`
+	EditTime time.Time `json:"editTime"`
+	Length   int       `json:"length"`
+	Current  bool      `json:"current"`
+}
+
+// NotebookEntryDiff represents the line-by-line differences between two versions of a notebook entry's content.
+type NotebookEntryDiff struct {
+	FromRevision int             `json:"fromRevision"`
+	ToRevision   int             `json:"toRevision"`
+	Lines        []util.DiffLine `json:"lines"`
+}
+
+// recordEntryRevision keeps an entry's current content in the notebook's history, dropping the oldest revisions
+// once the entry's history grows beyond its size limits.
+func recordEntryRevision(notebook *DecryptedNotebook, entry *NotebookEntry) {
+	editTime := entry.EditTime
+	if editTime.IsZero() {
+		editTime = entry.CreateTime
+	}
+
+	if notebook.Content.History == nil {
+		notebook.Content.History = make(map[string][]*NotebookEntryRevision)
+	}
+
+	history := append(notebook.Content.History[entry.ID], &NotebookEntryRevision{
+		Revision: entry.Revision,
+		EditTime: editTime,
+		Content: entry.Content,
+	})
+
+	size := 0
+	for _, revision := range history {
+		size += len(revision.Content)
+	}
+	for len(history) > entryHistoryMaxRevisions || size > entryHistoryMaxSize {
+		size -= len(history[0].Content)
+		history = history[1:]
+	}
+
+	notebook.Content.History[entry.ID] = history
+}
+
+// setEntryContent replaces an entry's content, keeping the previous content in the notebook's history. The entry's
+// body must have been loaded.
+func setEntryContent(notebook *DecryptedNotebook, entry *NotebookEntry, newContent string) {
+	if newContent != entry.Content {
+		recordEntryRevision(notebook, entry)
+	}
+
+	entry.Content = newContent
+	markEntryBodyChanged(notebook, entry.ID)
+	updateNotebookEntryEditTime(notebook, entry.ID)
+}
+
+// findEntryRevision finds the content an entry had at a revision, which may be its current one.
+func findEntryRevision(notebook *DecryptedNotebook, entry *NotebookEntry, revision int) (*NotebookEntryRevision, error) {
+	if revision == entry.Revision {
+		return &NotebookEntryRevision{
+			Revision: entry.Revision,
+			EditTime: entry.EditTime,
+			Content: entry.Content,
+		}, nil
+	}
+
+	for _, entryRevision := range notebook.Content.History[entry.ID] {
+		if entryRevision.Revision == revision {
+			return entryRevision, nil
+		}
+	}
+
+	return nil, fmt.Errorf("the specified revision does not exist in this entry's history")
+}
+
+/*
+ListNotebookEntryRevisions lists the versions of an entry's content that are kept in its notebook's history.
+
+	notebookName: the notebook's name.
+	credentials:  the notebook key or session token used to encrypt/decrypt the notebook.
+	entryID:      the ID of the entry.
+
+	returns:      the entry's revisions from oldest to newest, ending with the current one, or an error.
+*/
+func ListNotebookEntryRevisions(notebookName string, credentials NotebookCredentials, entryID string) ([]*NotebookEntryRevisionDetails, error) {
+	var revisions []*NotebookEntryRevisionDetails
+
+	err := viewNotebook(notebookName, credentials, func(notebook *DecryptedNotebook) error {
+		entry, ok := notebook.Content.Entries[entryID]
+		if !ok {
+			return fmt.Errorf("an entry with the specified ID does not exist in this notebook")
+		}
+
+		err := loadEntryBody(notebook, entryID)
+		if err != nil {
+			return err
+		}
+
+		for _, revision := range notebook.Content.History[entryID] {
+			revisions = append(revisions, &NotebookEntryRevisionDetails{
+				Revision: revision.Revision,
+				EditTime: revision.EditTime,
+				Length: len(revision.Content),
+			})
+		}
+
+		revisions = append(revisions, &NotebookEntryRevisionDetails{
+			Revision: entry.Revision,
+			EditTime: entry.EditTime,
+			Length: len(entry.Content),
+			Current: true,
+		})
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+/*
+DiffNotebookEntryRevisions shows the differences between two versions of an entry's content.
+
+	notebookName: the notebook's name.
+	credentials:  the notebook key or session token used to encrypt/decrypt the notebook.
+	entryID:      the ID of the entry.
+	fromRevision: the revision to compare from.
+	toRevision:   the revision to compare to.
+
+	returns:      the line-by-line diff, or an error.
+*/
+func DiffNotebookEntryRevisions(notebookName string, credentials NotebookCredentials, entryID string, fromRevision int, toRevision int) (*NotebookEntryDiff, error) {
+	var diff *NotebookEntryDiff
+
+	err := viewNotebook(notebookName, credentials, func(notebook *DecryptedNotebook) error {
+		entry, ok := notebook.Content.Entries[entryID]
+		if !ok {
+			return fmt.Errorf("an entry with the specified ID does not exist in this notebook")
+		}
+
+		err := loadEntryBody(notebook, entryID)
+		if err != nil {
+			return err
+		}
+
+		from, err := findEntryRevision(notebook, entry, fromRevision)
+		if err != nil {
+			return err
+		}
+
+		to, err := findEntryRevision(notebook, entry, toRevision)
+		if err != nil {
+			return err
+		}
+
+		diff = &NotebookEntryDiff{
+			FromRevision: from.Revision,
+			ToRevision: to.Revision,
+			Lines: util.DiffLines(from.Content, to.Content),
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return diff, nil
+}
+
+/*
+RestoreNotebookEntryRevision makes an old version of an entry's content its current content. The content being
+replaced is kept in the history, so a restore can itself be undone.
+
+	notebookName:     the notebook's name.
+	credentials:      the notebook key or session token used to encrypt/decrypt the notebook.
+	entryID:          the ID of the entry.
+	revision:         the revision to restore.
+	expectedRevision: the entry revision the caller last read, or nil to skip the check.
+
+	returns:          the notebook entry, or an error.
+*/
+func RestoreNotebookEntryRevision(notebookName string, credentials NotebookCredentials, entryID string, revision int, expectedRevision *int) (*NotebookEntry, error) {
+	var entry *NotebookEntry
+
+	err := updateNotebook(notebookName, credentials, func(notebook *DecryptedNotebook) error {
+		var ok bool
+		if entry, ok = notebook.Content.Entries[entryID]; !ok {
+			return fmt.Errorf("an entry with the specified ID does not exist in this notebook")
+		}
+
+		err := loadEntryBody(notebook, entryID)
+		if err != nil {
+			return err
+		}
+
+		err = checkEntryRevision(entry, expectedRevision)
+		if err != nil {
+			return err
+		}
+
+		restored, err := findEntryRevision(notebook, entry, revision)
+		if err != nil {
+			return err
+		}
+
+		setEntryContent(notebook, entry, restored.Content)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	util "eno/src/util"
+)
+
+// TestDiffNotebookEntryRevisions checks the diffs between revisions kept in an entry's history and its current one.
+func TestDiffNotebookEntryRevisions(t *testing.T) {
+	credentials := unlockTestNotebook(t, "Diff Test", "diff-test-key")
+
+	entry, err := CreateNotebookEntry("Diff Test", credentials, "entry", "")
+	if err != nil {
+		t.Fatalf("creating entry: %s", err)
+	}
+	revisions := []int{entry.Revision}
+	for _, content := range []string{"one\ntwo", "one\nthree", "one\nthree\nfour"} {
+		entry, err = SetNotebookEntryContent("Diff Test", credentials, entry.ID, content, nil)
+		if err != nil {
+			t.Fatalf("setting content: %s", err)
+		}
+		revisions = append(revisions, entry.Revision)
+	}
+
+	tests := []struct {
+		name     string
+		from     int
+		to       int
+		expected []util.DiffLine
+		wantErr  bool
+	}{
+		{"from empty content", revisions[0], revisions[1], []util.DiffLine{
+			{Op: util.DiffInsert, Text: "one"},
+			{Op: util.DiffInsert, Text: "two"},
+		}, false},
+		{"changed line", revisions[1], revisions[2], []util.DiffLine{
+			{Op: util.DiffEqual, Text: "one"},
+			{Op: util.DiffDelete, Text: "two"},
+			{Op: util.DiffInsert, Text: "three"},
+		}, false},
+		{"to the current revision", revisions[2], revisions[3], []util.DiffLine{
+			{Op: util.DiffEqual, Text: "one"},
+			{Op: util.DiffEqual, Text: "three"},
+			{Op: util.DiffInsert, Text: "four"},
+		}, false},
+		{"backwards", revisions[3], revisions[1], []util.DiffLine{
+			{Op: util.DiffEqual, Text: "one"},
+			{Op: util.DiffDelete, Text: "three"},
+			{Op: util.DiffDelete, Text: "four"},
+			{Op: util.DiffInsert, Text: "two"},
+		}, false},
+		{"same revision", revisions[2], revisions[2], []util.DiffLine{
+			{Op: util.DiffEqual, Text: "one"},
+			{Op: util.DiffEqual, Text: "three"},
+		}, false},
+		{"missing revision", revisions[1], revisions[3] + 1, nil, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			diff, err := DiffNotebookEntryRevisions("Diff Test", credentials, entry.ID, test.from, test.to)
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", diff)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("diffing revisions: %s", err)
+			}
+
+			if diff.FromRevision != test.from || diff.ToRevision != test.to {
+				t.Errorf("expected a diff from %d to %d, found %d to %d", test.from, test.to, diff.FromRevision, diff.ToRevision)
+			}
+			if !reflect.DeepEqual(diff.Lines, test.expected) {
+				t.Errorf("expected lines %+v, found %+v", test.expected, diff.Lines)
+			}
+		})
+	}
+}
+
+// TestRestoreNotebookEntryRevision checks that restoring a revision makes it current and keeps the replaced content.
+func TestRestoreNotebookEntryRevision(t *testing.T) {
+	credentials := unlockTestNotebook(t, "Restore Test", "restore-test-key")
+
+	entry, err := CreateNotebookEntry("Restore Test", credentials, "entry", "")
+	if err != nil {
+		t.Fatalf("creating entry: %s", err)
+	}
+	entry, err = SetNotebookEntryContent("Restore Test", credentials, entry.ID, "first", nil)
+	if err != nil {
+		t.Fatalf("setting content: %s", err)
+	}
+	firstRevision := entry.Revision
+	entry, err = SetNotebookEntryContent("Restore Test", credentials, entry.ID, "second", nil)
+	if err != nil {
+		t.Fatalf("setting content: %s", err)
+	}
+	secondRevision := entry.Revision
+
+	staleRevision := firstRevision
+	missingRevision := secondRevision + 1
+
+	tests := []struct {
+		name             string
+		revision         int
+		expectedRevision *int
+		wantConflict     bool
+		wantErr          bool
+	}{
+		{"stale expected revision", firstRevision, &staleRevision, true, true},
+		{"missing revision", missingRevision, nil, false, true},
+		{"old revision", firstRevision, &secondRevision, false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			restored, err := RestoreNotebookEntryRevision("Restore Test", credentials, entry.ID, test.revision, test.expectedRevision)
+
+			var conflict *RevisionConflictError
+			if errors.As(err, &conflict) != test.wantConflict {
+				t.Fatalf("expected a revision conflict to be %t, got %v", test.wantConflict, err)
+			}
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", restored)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("restoring revision: %s", err)
+			}
+
+			if restored.Content != "first" || restored.Revision != secondRevision + 1 {
+				t.Errorf("expected the first content at revision %d, found %q at %d", secondRevision + 1, restored.Content, restored.Revision)
+			}
+		})
+	}
+
+	// The replaced content is kept, so the restore can itself be undone
+	diff, err := DiffNotebookEntryRevisions("Restore Test", credentials, entry.ID, secondRevision, secondRevision + 1)
+	if err != nil {
+		t.Fatalf("diffing the restore: %s", err)
+	}
+	expected := []util.DiffLine{
+		{Op: util.DiffDelete, Text: "second"},
+		{Op: util.DiffInsert, Text: "first"},
+	}
+	if !reflect.DeepEqual(diff.Lines, expected) {
+		t.Errorf("expected the restore to replace the second content, found %+v", diff.Lines)
+	}
+}
@@ -7,8 +7,12 @@ import (
 // WindowHandle holds a handle to the webview window.
 var WindowHandle webview.WebView
 
-// init Initializes the notebooks directory and settings file.
+// init Initializes the notebooks directory and settings file, recovers from any interrupted notebook writes, and
+// purges notebooks that have been in the trash for too long.
 func init() {
 	ensureNotebooksDirExists()
+	recoverNotebookFiles()
 	ensureSettingsFileExists()
+	ensureNotebookTrashDirExists()
+	purgeExpiredNotebooks()
 }
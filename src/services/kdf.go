@@ -0,0 +1,210 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	kdfAlgorithmArgon2id = "argon2id"
+	kdfAlgorithmScrypt = "scrypt"
+	kdfSaltLength = 16
+	kdfKeyLength = 32
+	argon2idDefaultTime = 3
+	argon2idDefaultMemory = 64 * 1024
+	argon2idDefaultThreads = 4
+	argon2idMaxTime = 16
+	argon2idMaxMemory = 1024 * 1024
+	argon2idMaxThreads = 16
+	scryptMaxMemory = 1024 * 1024 * 1024
+	scryptMaxP = 16
+	dataKeyLength = 32
+	dataKeyAdditionalData = "eno notebook data key"
+)
+
+// NotebookKDF describes how a notebook's encryption key is derived from its password.
+type NotebookKDF struct {
+	Algorithm string `json:"algorithm"`
+	Salt      []byte `json:"salt"`
+	Time      uint32 `json:"time,omitempty"`
+	Memory    uint32 `json:"memory,omitempty"`
+	Threads   uint8  `json:"threads,omitempty"`
+	N         int    `json:"n,omitempty"`
+	R         int    `json:"r,omitempty"`
+	P         int    `json:"p,omitempty"`
+}
+
+// newNotebookKDF creates key derivation parameters with a fresh random salt using the default algorithm.
+func newNotebookKDF() (*NotebookKDF, error) {
+	salt := make([]byte, kdfSaltLength)
+	_, err := io.ReadFull(rand.Reader, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NotebookKDF{
+		Algorithm: kdfAlgorithmArgon2id,
+		Salt: salt,
+		Time: argon2idDefaultTime,
+		Memory: argon2idDefaultMemory,
+		Threads: argon2idDefaultThreads,
+	}, nil
+}
+
+/*
+deriveKey derives an AES-256 key from a notebook key. The notebook key is copied into a secure buffer for the key
+derivation function, and the derived key is moved into one as soon as it has been computed.
+
+	key:     the notebook key.
+	kdf:     the key derivation parameters, or nil for notebooks created before key derivation was configurable.
+
+	returns: the derived key, or an error.
+*/
+func deriveKey(key string, kdf *NotebookKDF) (*secureBuffer, error) {
+	password := newSecureBuffer(len(key))
+	defer password.Destroy()
+	copy(password.Bytes(), key)
+
+	if kdf == nil {
+		keyHash := sha256.Sum256(password.Bytes())
+		return newSecureBufferFrom(keyHash[:]), nil
+	}
+
+	switch kdf.Algorithm {
+	case kdfAlgorithmArgon2id:
+		if kdf.Time == 0 || kdf.Memory == 0 || kdf.Threads == 0 {
+			return nil, fmt.Errorf("invalid argon2id parameters")
+		}
+		// The parameters come from the notebook file, so they are limited before anything is allocated for them
+		if kdf.Time > argon2idMaxTime || kdf.Memory > argon2idMaxMemory || kdf.Threads > argon2idMaxThreads {
+			return nil, fmt.Errorf("argon2id parameters exceed the supported limits")
+		}
+
+		return newSecureBufferFrom(argon2.IDKey(password.Bytes(), kdf.Salt, kdf.Time, kdf.Memory, kdf.Threads, kdfKeyLength)), nil
+	case kdfAlgorithmScrypt:
+		if kdf.N <= 1 || kdf.R <= 0 || kdf.P <= 0 {
+			return nil, fmt.Errorf("invalid scrypt parameters")
+		}
+		if kdf.N > scryptMaxMemory / 128 / kdf.R || kdf.P > scryptMaxP {
+			return nil, fmt.Errorf("scrypt parameters exceed the supported limits")
+		}
+
+		derivedKey, err := scrypt.Key(password.Bytes(), kdf.Salt, kdf.N, kdf.R, kdf.P, kdfKeyLength)
+		if err != nil {
+			return nil, err
+		}
+
+		return newSecureBufferFrom(derivedKey), nil
+	default:
+		return nil, fmt.Errorf("unsupported key derivation algorithm: %s", kdf.Algorithm)
+	}
+}
+
+/*
+notebookKeyMaterial holds a key derived from a notebook key along with the parameters used to derive it, the key slot
+it unlocks, whether that slot holds a recovery key, and the notebook's data key once it has been unwrapped.
+
+A notebook's content is encrypted under a random data key rather than the key derived from its notebook key, which
+only wraps the data key. Changing the notebook key then only needs the data key to be wrapped again.
+*/
+type notebookKeyMaterial struct {
+	kdf     *NotebookKDF
+	key     *secureBuffer
+	slotID   string
+	recovery bool
+	dataKey  *secureBuffer
+}
+
+// newNotebookDataKey generates a random key for encrypting a notebook's content.
+func newNotebookDataKey() (*secureBuffer, error) {
+	dataKey := newSecureBuffer(dataKeyLength)
+	_, err := io.ReadFull(rand.Reader, dataKey.Bytes())
+	if err != nil {
+		dataKey.Destroy()
+		return nil, err
+	}
+
+	return dataKey, nil
+}
+
+// dataKeyCipher creates the AEAD cipher that wraps a notebook's data key under the key derived from its notebook key.
+func dataKeyCipher(key *notebookKeyMaterial) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key.key.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// wrapDataKey encrypts key material's data key under its derived key, so it can be stored in a notebook's header.
+func wrapDataKey(key *notebookKeyMaterial, additionalData []byte) ([]byte, error) {
+	aesgcm, err := dataKeyCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, aesgcm.NonceSize())
+	_, err = io.ReadFull(rand.Reader, nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	return aesgcm.Seal(nonce, nonce, key.dataKey.Bytes(), additionalData), nil
+}
+
+// unwrapDataKey decrypts a data key wrapped by wrapDataKey into key material.
+func unwrapDataKey(key *notebookKeyMaterial, wrappedKey []byte, additionalData []byte) error {
+	aesgcm, err := dataKeyCipher(key)
+	if err != nil {
+		return err
+	}
+
+	nonceSize := aesgcm.NonceSize()
+	if len(wrappedKey) < nonceSize {
+		return fmt.Errorf("wrapped data key is shorter than the nonce")
+	}
+
+	ciphertext := wrappedKey[nonceSize:]
+	if len(ciphertext) < aesgcm.Overhead() {
+		return fmt.Errorf("wrapped data key is shorter than its tag")
+	}
+
+	// Opened straight into a secure buffer so the data key is never left behind on the heap
+	dataKey := newSecureBuffer(len(ciphertext) - aesgcm.Overhead())
+	_, err = aesgcm.Open(dataKey.Bytes()[:0], wrappedKey[:nonceSize], ciphertext, additionalData)
+	if err != nil {
+		dataKey.Destroy()
+		return err
+	}
+
+	key.dataKey.Destroy()
+	key.dataKey = dataKey
+
+	return nil
+}
+
+// newNotebookKeyMaterial derives key material from a notebook key using a fresh salt.
+func newNotebookKeyMaterial(key string) (*notebookKeyMaterial, error) {
+	kdf, err := newNotebookKDF()
+	if err != nil {
+		return nil, err
+	}
+
+	derivedKey, err := deriveKey(key, kdf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &notebookKeyMaterial{
+		kdf: kdf,
+		key: derivedKey,
+	}, nil
+}
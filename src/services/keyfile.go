@@ -0,0 +1,70 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+const (
+	keyfileMinSize = 32
+	keyfileKeyPrefix = "keyfile:"
+	keyfileKeyLabel = "eno keyfile key"
+	KeyfileMaxSize = 64 * 1024 * 1024
+)
+
+// HashKeyfile reads a keyfile and returns its SHA-256 hash, which is all of the keyfile that notebook keys are made from.
+func HashKeyfile(r io.Reader) ([]byte, error) {
+	hash := sha256.New()
+
+	n, err := io.Copy(hash, io.LimitReader(r, KeyfileMaxSize + 1))
+	if err != nil {
+		log.Printf("Error occurred reading keyfile: %s", err)
+		return nil, fmt.Errorf("an unexpected error occurred while reading the keyfile, check the logs for more details")
+	}
+
+	if n < keyfileMinSize || n > KeyfileMaxSize {
+		return nil, fmt.Errorf("keyfile must be between %d bytes and %d MiB in size", keyfileMinSize, KeyfileMaxSize / (1024 * 1024))
+	}
+
+	return hash.Sum(nil), nil
+}
+
+// HashKeyfileAt reads the keyfile at a path and returns its SHA-256 hash.
+func HashKeyfileAt(path string) ([]byte, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		log.Printf("Error occurred opening keyfile (%s): %s", path, err)
+		return nil, fmt.Errorf("the keyfile could not be opened, check the logs for more details")
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("the keyfile must be a regular file")
+	}
+
+	return HashKeyfile(file)
+}
+
+/*
+NotebookKeyWithKeyfile combines a keyfile with a passphrase into the notebook key that is derived from them. The key is
+derived like any other, so a key slot for a keyfile works the same way as one for a typed key, and the keyfile and
+passphrase are only accepted together.
+
+	passphrase:  the passphrase used along with the keyfile, which may be empty.
+	keyfileHash: the keyfile's hash, from HashKeyfile.
+
+	returns:     the notebook key.
+*/
+func NotebookKeyWithKeyfile(passphrase string, keyfileHash []byte) string {
+	mac := hmac.New(sha256.New, keyfileHash)
+	mac.Write([]byte(keyfileKeyLabel))
+	mac.Write([]byte(passphrase))
+
+	return keyfileKeyPrefix + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
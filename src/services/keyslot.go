@@ -0,0 +1,533 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	keySlotLabelMinLength = 1
+	keySlotLabelMaxLength = 64
+	passwordKeySlotLabel = "Password"
+	recoveryKeySlotLabel = "Recovery key"
+	recoveryKeyLength = 20
+	recoveryKeyGroupSize = 4
+	keySlotVersionBoundKeyCheck = 1
+	keySlotVersionBoundRecovery = 2
+	keySlotsMax = 8
+	recoveryKeySlotAdditionalData = "recovery"
+)
+
+// NotebookKeySlot holds one of a notebook's keys in its header, as the notebook's data key wrapped under it. Every slot
+// wraps the same data key with its own key derivation parameters, so adding, changing or revoking one slot leaves the
+// others and the notebook's content alone.
+type NotebookKeySlot struct {
+	Version    int          `json:"version,omitempty"`
+	ID         string       `json:"id"`
+	KDF        *NotebookKDF `json:"kdf"`
+	KeyCheck   []byte       `json:"keyCheck"`
+	WrappedKey []byte       `json:"wrappedKey"`
+}
+
+// NotebookKeySlotDetails represents a key slot's details, which are encrypted in the notebook's index so a hidden
+// notebook does not give away what its keys are for.
+type NotebookKeySlotDetails struct {
+	ID         string    `json:"id"`
+	Label      string    `json:"label"`
+	Recovery   bool      `json:"recovery,omitempty"`
+	CreateTime time.Time `json:"createTime"`
+}
+
+// NotebookRecoveryKey represents a generated recovery key and the key slot it unlocks. The key is only ever returned
+// when it is generated.
+type NotebookRecoveryKey struct {
+	KeySlot *NotebookKeySlotDetails `json:"keySlot"`
+	Key     string                  `json:"key"`
+}
+
+/*
+notebookKeyMaterialFor derives key material from a notebook key using the parameters stored in a notebook. A notebook
+with key slots has the key tried against each slot in turn, and the key material records the slot it unlocks.
+
+	notebook: the encrypted notebook.
+	key:      the notebook key.
+
+	returns:  the key material, or an error.
+*/
+func notebookKeyMaterialFor(notebook *EncryptedNotebook, key string) (*notebookKeyMaterial, error) {
+	filepath := notebookFilepath(notebook.ID)
+
+	if !notebookHasKeySlots(notebook) {
+		derivedKey, err := deriveKey(key, notebook.KDF)
+		if err != nil {
+			log.Printf("Error occurred deriving key for decrypting (%s): %s", filepath, err)
+			return nil, fmt.Errorf("an unexpected error occurred while decrypting the notebook, check the logs for more details")
+		}
+
+		return &notebookKeyMaterial{
+			kdf: notebook.KDF,
+			key: derivedKey,
+		}, nil
+	}
+
+	// Every slot costs a key derivation, so a header with more slots than could have been added is not tried
+	if len(notebook.KeySlots) > keySlotsMax {
+		log.Printf("Notebook has %d key slots, more than the limit of %d (%s)", len(notebook.KeySlots), keySlotsMax, filepath)
+		return nil, fmt.Errorf("notebook metadata has been tampered with")
+	}
+
+	for _, slot := range notebook.KeySlots {
+		derivedKey, err := deriveKey(key, slot.KDF)
+		if err != nil {
+			log.Printf("Error occurred deriving key for key slot '%s' (%s): %s", slot.ID, filepath, err)
+			return nil, fmt.Errorf("an unexpected error occurred while decrypting the notebook, check the logs for more details")
+		}
+
+		keyMaterial := &notebookKeyMaterial{
+			kdf: slot.KDF,
+			key: derivedKey,
+			slotID: slot.ID,
+		}
+
+		keyCheck := notebookKeyCheck(derivedKey.Bytes())
+		if hmac.Equal(slot.KeyCheck, keyCheck) {
+			return keyMaterial, nil
+		}
+
+		// A slot whose key check is bound to its data key only unwraps with the right key's check, so a key that
+		// unwraps it anyway is the right key and the stored check has been tampered with
+		tampered := slot.Version >= keySlotVersionBoundKeyCheck && unwrapKeySlot(keyMaterial, slot, keyCheck) == nil
+		wipeKeyMaterial(keyMaterial)
+		if tampered {
+			log.Printf("Notebook key check for key slot '%s' does not match its data key (%s)", slot.ID, filepath)
+			return nil, fmt.Errorf("notebook metadata has been tampered with")
+		}
+	}
+
+	log.Printf("Notebook key did not match any key slot (%s)", filepath)
+	return nil, errIncorrectNotebookKey
+}
+
+// findKeySlot finds a key slot by its ID.
+func findKeySlot(slots []*NotebookKeySlot, slotID string) (int, *NotebookKeySlot) {
+	for i, slot := range slots {
+		if slot.ID == slotID {
+			return i, slot
+		}
+	}
+
+	return -1, nil
+}
+
+// keySlotAdditionalData gets the additional data a key slot's data key is wrapped with. Slots from before key checks
+// were bound to their data keys only use a fixed label, and recovery key slots are marked as such from the version
+// that binds that too, so only the holder of a slot's key can tell what it is for.
+func keySlotAdditionalData(slot *NotebookKeySlot, keyCheck []byte, recovery bool) []byte {
+	if slot.Version < keySlotVersionBoundKeyCheck {
+		return []byte(dataKeyAdditionalData)
+	}
+
+	additionalData := append([]byte(dataKeyAdditionalData), keyCheck...)
+	if recovery && slot.Version >= keySlotVersionBoundRecovery {
+		additionalData = append(additionalData, recoveryKeySlotAdditionalData...)
+	}
+
+	return additionalData
+}
+
+// unwrapKeySlot unwraps a key slot's data key into key material, recording whether the slot holds a recovery key when
+// its version binds that.
+func unwrapKeySlot(key *notebookKeyMaterial, slot *NotebookKeySlot, keyCheck []byte) error {
+	err := unwrapDataKey(key, slot.WrappedKey, keySlotAdditionalData(slot, keyCheck, false))
+	if err == nil || slot.Version < keySlotVersionBoundRecovery {
+		return err
+	}
+
+	err = unwrapDataKey(key, slot.WrappedKey, keySlotAdditionalData(slot, keyCheck, true))
+	if err != nil {
+		return err
+	}
+	key.recovery = true
+
+	return nil
+}
+
+// unwrapNotebookDataKey unwraps a notebook's data key into key material, from the key slot the material unlocks.
+func unwrapNotebookDataKey(notebook *EncryptedNotebook, key *notebookKeyMaterial) error {
+	if !notebookHasKeySlots(notebook) {
+		return unwrapDataKey(key, notebook.WrappedKey, []byte(dataKeyAdditionalData))
+	}
+
+	_, slot := findKeySlot(notebook.KeySlots, key.slotID)
+	if slot == nil {
+		return fmt.Errorf("key slot '%s' does not exist", key.slotID)
+	}
+
+	return unwrapKeySlot(key, slot, slot.KeyCheck)
+}
+
+/*
+openKeySlots records a decrypted notebook's key slots, keeping only the slots in its header that its index lists, so a
+slot slipped into the header alongside the ones the index knows about is never trusted.
+
+	notebook:          the decrypted notebook.
+	encryptedNotebook: the encrypted notebook the key slots are read from.
+	key:               the key material the notebook was decrypted with.
+	details:           the key slot details listed in the notebook's index.
+
+	returns:           an error, if the key slot that was used is not listed in the index.
+*/
+func openKeySlots(notebook *DecryptedNotebook, encryptedNotebook *EncryptedNotebook, key *notebookKeyMaterial, details map[string]*NotebookKeySlotDetails) error {
+	filepath := notebookFilepath(encryptedNotebook.ID)
+
+	if _, ok := details[key.slotID]; !ok {
+		log.Printf("Notebook key slot '%s' is not listed in its index (%s)", key.slotID, filepath)
+		return fmt.Errorf("notebook metadata has been tampered with")
+	}
+
+	notebook.keySlots = make([]*NotebookKeySlot, 0, len(encryptedNotebook.KeySlots))
+	notebook.keySlotDetails = make(map[string]*NotebookKeySlotDetails, len(details))
+
+	for _, slot := range encryptedNotebook.KeySlots {
+		slotDetails, ok := details[slot.ID]
+		if !ok {
+			log.Printf("Ignoring notebook key slot '%s' that is not listed in its index (%s)", slot.ID, filepath)
+			continue
+		}
+
+		notebook.keySlots = append(notebook.keySlots, slot)
+		notebook.keySlotDetails[slot.ID] = slotDetails
+	}
+
+	return nil
+}
+
+// copyKeySlots makes a copy of a notebook's key slots that can be changed independently of the original. Key slots
+// are replaced rather than changed, so they can be shared between copies.
+func copyKeySlots(notebook *DecryptedNotebook, notebookCopy *DecryptedNotebook) {
+	notebookCopy.keySlots = append([]*NotebookKeySlot(nil), notebook.keySlots...)
+
+	if notebook.keySlotDetails != nil {
+		notebookCopy.keySlotDetails = make(map[string]*NotebookKeySlotDetails, len(notebook.keySlotDetails))
+		for slotID, slotDetails := range notebook.keySlotDetails {
+			notebookCopy.keySlotDetails[slotID] = slotDetails
+		}
+	}
+}
+
+// newRecoveryKey generates a random recovery key, split into groups so it is easier to write down.
+func newRecoveryKey() (string, error) {
+	key := make([]byte, recoveryKeyLength)
+	_, err := io.ReadFull(rand.Reader, key)
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(key)
+
+	var groups []string
+	for len(encoded) > 0 {
+		groups = append(groups, encoded[:recoveryKeyGroupSize])
+		encoded = encoded[recoveryKeyGroupSize:]
+	}
+
+	return strings.Join(groups, "-"), nil
+}
+
+// newKeySlot wraps key material's data key into a key slot, which the key material then records it unlocks.
+func newKeySlot(slotID string, key *notebookKeyMaterial) (*NotebookKeySlot, error) {
+	if key.kdf == nil {
+		return nil, fmt.Errorf("refusing to wrap a data key under a legacy unsalted key")
+	}
+	if key.dataKey == nil {
+		return nil, fmt.Errorf("key material has no data key to wrap")
+	}
+
+	slot := &NotebookKeySlot{
+		Version: keySlotVersionBoundRecovery,
+		ID: slotID,
+		KDF: key.kdf,
+		KeyCheck: notebookKeyCheck(key.key.Bytes()),
+	}
+
+	wrappedKey, err := wrapDataKey(key, keySlotAdditionalData(slot, slot.KeyCheck, key.recovery))
+	if err != nil {
+		return nil, err
+	}
+	slot.WrappedKey = wrappedKey
+	key.slotID = slotID
+
+	return slot, nil
+}
+
+/*
+addKeySlot adds a key slot to a notebook for key material holding the notebook's data key.
+
+	notebook: the decrypted notebook.
+	key:      the key material for the new slot.
+	label:    the label the slot is listed by.
+	recovery: whether the slot holds a generated recovery key.
+
+	returns:  the new slot's details, or an error.
+*/
+func addKeySlot(notebook *DecryptedNotebook, key *notebookKeyMaterial, label string, recovery bool) (*NotebookKeySlotDetails, error) {
+	filepath := notebookFilepath(notebook.ID)
+
+	err := checkKeySlotCount(notebook)
+	if err != nil {
+		return nil, err
+	}
+
+	slotID, err := newUUID()
+	if err != nil {
+		log.Printf("Error occurred generating key slot ID (%s): %s", filepath, err)
+		return nil, fmt.Errorf("an unexpected error occurred while encrypting the notebook, check the logs for more details")
+	}
+
+	key.recovery = recovery
+	slot, err := newKeySlot(slotID, key)
+	if err != nil {
+		log.Printf("Error occurred creating key slot (%s): %s", filepath, err)
+		return nil, fmt.Errorf("an unexpected error occurred while encrypting the notebook, check the logs for more details")
+	}
+
+	slotDetails := &NotebookKeySlotDetails{
+		ID: slot.ID,
+		Label: label,
+		Recovery: recovery,
+		CreateTime: time.Now(),
+	}
+
+	notebook.keySlots = append(notebook.keySlots, slot)
+	if notebook.keySlotDetails == nil {
+		notebook.keySlotDetails = make(map[string]*NotebookKeySlotDetails)
+	}
+	notebook.keySlotDetails[slot.ID] = slotDetails
+
+	return slotDetails, nil
+}
+
+// addDerivedKeySlot derives key material from a new notebook key and adds a key slot for it, wrapping a data key.
+func addDerivedKeySlot(notebook *DecryptedNotebook, dataKey *secureBuffer, newKey string, label string, recovery bool) (*NotebookKeySlotDetails, error) {
+	// The count is checked before the slow key derivation as well as when the slot is added
+	err := checkKeySlotCount(notebook)
+	if err != nil {
+		return nil, err
+	}
+
+	keyMaterial, err := newNotebookKeyMaterial(newKey)
+	if err != nil {
+		log.Printf("Error occurred deriving key for new key slot (%s): %s", notebookFilepath(notebook.ID), err)
+		return nil, fmt.Errorf("an unexpected error occurred while encrypting the notebook, check the logs for more details")
+	}
+	defer wipeKeyMaterial(keyMaterial)
+	keyMaterial.dataKey = dataKey.Copy()
+
+	return addKeySlot(notebook, keyMaterial, label, recovery)
+}
+
+// addRecoveryKeySlot generates a recovery key and adds a key slot for it to a notebook.
+func addRecoveryKeySlot(notebook *DecryptedNotebook, dataKey *secureBuffer, label string) (*NotebookRecoveryKey, error) {
+	recoveryKey, err := newRecoveryKey()
+	if err != nil {
+		log.Printf("Error occurred generating recovery key (%s): %s", notebookFilepath(notebook.ID), err)
+		return nil, fmt.Errorf("an unexpected error occurred while generating a recovery key, check the logs for more details")
+	}
+
+	slotDetails, err := addDerivedKeySlot(notebook, dataKey, recoveryKey, label, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NotebookRecoveryKey{
+		KeySlot: slotDetails,
+		Key: recoveryKey,
+	}, nil
+}
+
+// checkKeySlotCount verifies that a notebook has room for another key slot, since unlocking it may try every slot.
+func checkKeySlotCount(notebook *DecryptedNotebook) error {
+	if len(notebook.keySlots) >= keySlotsMax {
+		return fmt.Errorf("a notebook can have at most %d keys, revoke one before adding another", keySlotsMax)
+	}
+
+	return nil
+}
+
+// checkKeySlotLabel verifies that a label is a valid length and not already used by another of a notebook's key slots.
+func checkKeySlotLabel(notebook *DecryptedNotebook, label string) error {
+	if len(label) < keySlotLabelMinLength || len(label) > keySlotLabelMaxLength {
+		return fmt.Errorf("key slot label must be between %d and %d characters in length", keySlotLabelMinLength, keySlotLabelMaxLength)
+	}
+
+	for _, slotDetails := range notebook.keySlotDetails {
+		if strings.EqualFold(slotDetails.Label, label) {
+			return fmt.Errorf("a key slot with the specified label already exists in this notebook")
+		}
+	}
+
+	return nil
+}
+
+/*
+ListNotebookKeySlots lists the key slots that can unlock a notebook.
+
+	name:    the notebook's name.
+	key:     the notebook key.
+
+	returns: the notebook's key slots, oldest first, or an error.
+*/
+func ListNotebookKeySlots(name string, key string) ([]*NotebookKeySlotDetails, error) {
+	unlock := lockNotebookForWrite(name)
+	defer unlock()
+
+	notebook, keyMaterial, err := openNotebook(name, key)
+	if err != nil {
+		return nil, err
+	}
+	wipeKeyMaterial(keyMaterial)
+
+	slots := make([]*NotebookKeySlotDetails, 0, len(notebook.keySlotDetails))
+	for _, slotDetails := range notebook.keySlotDetails {
+		slots = append(slots, slotDetails)
+	}
+
+	sort.Slice(slots, func(i, j int) bool {
+		return slots[i].CreateTime.Before(slots[j].CreateTime)
+	})
+
+	return slots, nil
+}
+
+/*
+AddNotebookKeySlot adds a key slot to a notebook, so it can also be unlocked by another notebook key.
+
+	name:    the notebook's name.
+	key:     an existing notebook key.
+	label:   the label the new slot is listed by.
+	newKey:  the notebook key for the new slot.
+
+	returns: the new slot's details, or an error.
+*/
+func AddNotebookKeySlot(name string, key string, label string, newKey string) (*NotebookKeySlotDetails, error) {
+	if len(newKey) < notebookKeyMinLength || len(newKey) > notebookKeyMaxLength {
+		return nil, fmt.Errorf("notebook key must be between %d and %d characters in length", notebookKeyMinLength, notebookKeyMaxLength)
+	}
+
+	unlock := lockNotebookForWrite(name)
+	defer unlock()
+
+	notebook, keyMaterial, err := openNotebook(name, key)
+	if err != nil {
+		return nil, err
+	}
+	defer wipeKeyMaterial(keyMaterial)
+
+	err = checkKeySlotLabel(notebook, label)
+	if err != nil {
+		return nil, err
+	}
+
+	slotDetails, err := addDerivedKeySlot(notebook, keyMaterial.dataKey, newKey, label, false)
+	if err != nil {
+		return nil, err
+	}
+
+	err = saveNotebook(notebook, keyMaterial)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sessions keep working with the slots they were unlocked with, but the cached copy is missing the new slot
+	evictCachedNotebook(notebook.ID)
+
+	return slotDetails, nil
+}
+
+/*
+AddNotebookRecoveryKey generates a recovery key and adds a key slot for it to a notebook. The recovery key is only
+returned this once.
+
+	name:    the notebook's name.
+	key:     an existing notebook key.
+	label:   the label the new slot is listed by.
+
+	returns: the recovery key and its slot's details, or an error.
+*/
+func AddNotebookRecoveryKey(name string, key string, label string) (*NotebookRecoveryKey, error) {
+	unlock := lockNotebookForWrite(name)
+	defer unlock()
+
+	notebook, keyMaterial, err := openNotebook(name, key)
+	if err != nil {
+		return nil, err
+	}
+	defer wipeKeyMaterial(keyMaterial)
+
+	err = checkKeySlotLabel(notebook, label)
+	if err != nil {
+		return nil, err
+	}
+
+	recoveryKey, err := addRecoveryKeySlot(notebook, keyMaterial.dataKey, label)
+	if err != nil {
+		return nil, err
+	}
+
+	err = saveNotebook(notebook, keyMaterial)
+	if err != nil {
+		return nil, err
+	}
+
+	evictCachedNotebook(notebook.ID)
+
+	return recoveryKey, nil
+}
+
+/*
+RevokeNotebookKeySlot removes a key slot from a notebook, so its notebook key no longer unlocks the notebook. Any
+sessions unlocked with the slot are ended.
+
+	name:    the notebook's name.
+	key:     a notebook key that is still valid, which may be the key being revoked.
+	slotID:  the ID of the slot to revoke.
+
+	returns: an error, if one occurs.
+*/
+func RevokeNotebookKeySlot(name string, key string, slotID string) error {
+	unlock := lockNotebookForWrite(name)
+	defer unlock()
+
+	notebook, keyMaterial, err := openNotebook(name, key)
+	if err != nil {
+		return err
+	}
+	defer wipeKeyMaterial(keyMaterial)
+
+	i, slot := findKeySlot(notebook.keySlots, slotID)
+	if slot == nil {
+		return fmt.Errorf("a key slot with the specified ID does not exist in this notebook")
+	}
+	if len(notebook.keySlots) == 1 {
+		return fmt.Errorf("the notebook's last key slot cannot be revoked")
+	}
+
+	notebook.keySlots = append(notebook.keySlots[:i:i], notebook.keySlots[i + 1:]...)
+	delete(notebook.keySlotDetails, slotID)
+
+	err = saveNotebook(notebook, keyMaterial)
+	if err != nil {
+		return err
+	}
+
+	lockKeySlotSessions(notebook.ID, slotID)
+
+	return nil
+}
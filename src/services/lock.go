@@ -0,0 +1,121 @@
+package services
+
+import (
+	"sort"
+	"sync"
+)
+
+var (
+	notebookLocks = make(map[string]*sync.RWMutex)
+	notebookLocksMutex sync.Mutex
+)
+
+// notebookLock gets the lock that guards a notebook's file and cached content, creating it if needed.
+func notebookLock(notebookID string) *sync.RWMutex {
+	notebookLocksMutex.Lock()
+	defer notebookLocksMutex.Unlock()
+
+	lock, ok := notebookLocks[notebookID]
+	if !ok {
+		lock = &sync.RWMutex{}
+		notebookLocks[notebookID] = lock
+	}
+
+	return lock
+}
+
+// lockNotebookForWrite takes exclusive access to a notebook for a read-modify-write cycle and returns the unlock function.
+func lockNotebookForWrite(notebookName string) func() {
+	lock := notebookLock(cleanFileName(notebookName))
+	lock.Lock()
+	return lock.Unlock
+}
+
+// lockNotebookForRead takes shared access to a notebook for reading and returns the unlock function.
+func lockNotebookForRead(notebookName string) func() {
+	lock := notebookLock(cleanFileName(notebookName))
+	lock.RLock()
+	return lock.RUnlock
+}
+
+// lockNotebooksForWrite takes exclusive access to several notebooks in a consistent order and returns the unlock function.
+func lockNotebooksForWrite(notebookNames ...string) func() {
+	notebookIDs := make([]string, 0, len(notebookNames))
+	seen := make(map[string]bool)
+	for _, notebookName := range notebookNames {
+		notebookID := cleanFileName(notebookName)
+		if !seen[notebookID] {
+			seen[notebookID] = true
+			notebookIDs = append(notebookIDs, notebookID)
+		}
+	}
+	sort.Strings(notebookIDs)
+
+	unlocks := make([]func(), 0, len(notebookIDs))
+	for _, notebookID := range notebookIDs {
+		unlocks = append(unlocks, lockNotebookForWrite(notebookID))
+	}
+
+	return func() {
+		for i := len(unlocks) - 1; i >= 0; i-- {
+			unlocks[i]()
+		}
+	}
+}
+
+/*
+viewNotebook loads a notebook while holding its lock for reading. Only the notebook's index is decrypted up front, and
+entry bodies are decrypted with loadEntryBody as they are needed.
+
+	notebookName: the notebook's name.
+	credentials:  the notebook key or session token.
+	view:         reads from the decrypted notebook.
+
+	returns:      an error, if one occurs.
+*/
+func viewNotebook(notebookName string, credentials NotebookCredentials, view func(notebook *DecryptedNotebook) error) error {
+	unlock := lockNotebookForRead(notebookName)
+	defer unlock()
+
+	notebook, key, err := loadNotebook(notebookName, credentials)
+	if err != nil {
+		return err
+	}
+	defer wipeKeyMaterial(key)
+	notebook.dataKey = key.dataKey
+
+	return view(notebook)
+}
+
+/*
+updateNotebook runs a read-modify-write cycle on a notebook while holding its lock, so that concurrent changes to
+the same notebook are applied one after another instead of overwriting each other.
+
+	notebookName: the notebook's name.
+	credentials:  the notebook key or session token.
+	update:       modifies the decrypted notebook, loading the bodies of any entries it changes the content of. The
+	              notebook is only saved if no error is returned, and any entries that have been in its trash for
+	              too long are purged when it is.
+
+	returns:      an error, if one occurs.
+*/
+func updateNotebook(notebookName string, credentials NotebookCredentials, update func(notebook *DecryptedNotebook) error) error {
+	unlock := lockNotebookForWrite(notebookName)
+	defer unlock()
+
+	notebook, key, err := loadNotebook(notebookName, credentials)
+	if err != nil {
+		return err
+	}
+	defer wipeKeyMaterial(key)
+	notebook.dataKey = key.dataKey
+
+	purgeExpiredNotebookEntries(notebook)
+
+	err = update(notebook)
+	if err != nil {
+		return err
+	}
+
+	return storeNotebook(notebook, key)
+}
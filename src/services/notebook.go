@@ -1,10 +1,12 @@
 package services
 
 import (
+	"bufio"
 	"crypto/aes"
 	"crypto/cipher"
+	"crypto/hmac"
 	"crypto/rand"
-	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -28,45 +30,117 @@ const (
 	notebookDescriptionMaxLength = 256
 	notebookKeyMinLength = 8
 	notebookKeyMaxLength = 256
+	notebookIDLength = 16
+	hiddenNotebookPlaceholderName = "Locked notebook"
 )
 
 // NotebookEntry represents a single entry within a notebook.
 type NotebookEntry struct {
+	ID         string    `json:"id"`
 	Name       string    `json:"name"`
+	Folder     string    `json:"folder"`
 	CreateTime time.Time `json:"createTime"`
 	EditTime   time.Time `json:"editTime"`
+	Revision   int       `json:"revision"`
+	Tags       []string  `json:"tags,omitempty"`
 	Content    string    `json:"content"`
 }
 
 // NotebookContent represents the decrypted content of a notebook.
 type NotebookContent struct {
-	Entries map[string]*NotebookEntry `json:"entries"`
+	Entries     map[string]*NotebookEntry           `json:"entries"`
+	History     map[string][]*NotebookEntryRevision `json:"history,omitempty"`
+	Trash       map[string]*TrashedNotebookEntry    `json:"trash,omitempty"`
+	Folders     map[string]*NotebookFolder          `json:"folders,omitempty"`
+	Attachments map[string]*NotebookAttachment      `json:"attachments,omitempty"`
 }
 
-// EncryptedNotebook represents an encrypted notebook.
-type EncryptedNotebook struct {
+// hiddenNotebookMetadata holds a hidden notebook's details, which are encrypted along with its content.
+type hiddenNotebookMetadata struct {
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
 	CreateTime  time.Time `json:"createTime"`
 	EditTime    time.Time `json:"editTime"`
-	Content     []byte    `json:"content"`
+	Revision    int       `json:"revision"`
+}
+
+// notebookPayload represents the plaintext that is sealed inside a notebook file.
+type notebookPayload struct {
+	NotebookContent
+	Metadata   *hiddenNotebookMetadata            `json:"metadata,omitempty"`
+	EntryFiles map[string]string                  `json:"entryFiles,omitempty"`
+	KeySlots   map[string]*NotebookKeySlotDetails `json:"keySlots,omitempty"`
+}
+
+// EncryptedNotebook represents an encrypted notebook.
+type EncryptedNotebook struct {
+	Version     int                `json:"version"`
+	Cipher      string             `json:"cipher,omitempty"`
+	ID          string             `json:"id"`
+	Hidden      bool               `json:"hidden,omitempty"`
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	CreateTime  time.Time          `json:"createTime"`
+	EditTime    time.Time          `json:"editTime"`
+	Revision    int                `json:"revision"`
+	KDF         *NotebookKDF       `json:"kdf,omitempty"`
+	KeyCheck    []byte             `json:"keyCheck,omitempty"`
+	WrappedKey  []byte             `json:"wrappedKey,omitempty"`
+	KeySlots    []*NotebookKeySlot `json:"keySlots,omitempty"`
+	Content     []byte             `json:"content,omitempty"`
+
+	// Notebooks in the streamed format keep their content in the file after the header, where it is read from and
+	// written to a segment at a time rather than being held here
+	contentFile   string
+	contentOffset int64
+	writeContent  func(w io.Writer) error
+
+	// Entry bodies are written to their own files before the notebook's file, which lists the files they are in.
+	// Neither is set when only the notebook's header is being rewritten
+	entryFiles   map[string]string
+	writeEntries func(notebookID string) error
 }
 
 // DecryptedNotebook represents a decrypted notebook.
 type DecryptedNotebook struct {
+	ID          string          `json:"id"`
+	Hidden      bool            `json:"hidden"`
 	Name        string          `json:"name"`
 	Description string          `json:"description"`
 	CreateTime  time.Time       `json:"createTime"`
 	EditTime    time.Time       `json:"editTime"`
+	Revision    int             `json:"revision"`
 	Content     NotebookContent `json:"content"`
+
+	// Entry bodies are only decrypted from their files when needed, using the data key, which is only set while the
+	// notebook is being viewed or updated
+	entryFiles map[string]*entryFile
+	dataKey    *secureBuffer
+
+	// The notebook's key slots are written to its header, and their details to its index
+	keySlots       []*NotebookKeySlot
+	keySlotDetails map[string]*NotebookKeySlotDetails
+
+	// Deleted attachments keep their encrypted data until the notebook has been written without them
+	deletedAttachments []string
+}
+
+// CreatedNotebook represents a newly created notebook along with the recovery key generated for it, which is only ever
+// returned here.
+type CreatedNotebook struct {
+	*DecryptedNotebook
+	RecoveryKey string `json:"recoveryKey"`
 }
 
 // NotebookDetails represents a notebook's details.
 type NotebookDetails struct {
+	ID          string    `json:"id"`
+	Hidden      bool      `json:"hidden"`
 	Name        string    `json:"name"`
 	Description string    `json:"description"`
 	CreateTime  time.Time `json:"createTime"`
 	EditTime    time.Time `json:"editTime"`
+	Revision    int       `json:"revision"`
 }
 
 // ensureNotebooksDirExists will create the notebooks directory if it does not exist.
@@ -85,102 +159,299 @@ func cleanFileName(name string) string {
 	return reg.ReplaceAllString(strings.ReplaceAll(name, " ", "_"), "-")
 }
 
-// readNotebook reads a notebook file into memory.
+// newNotebookID generates a random identifier for a hidden notebook's file name.
+func newNotebookID() (string, error) {
+	id := make([]byte, notebookIDLength)
+	_, err := io.ReadFull(rand.Reader, id)
+	if err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(id), nil
+}
+
+// newUUID generates a random version 4 UUID, which identifies an entry or attachment whatever it is renamed to.
+func newUUID() (string, error) {
+	id := make([]byte, 16)
+	_, err := io.ReadFull(rand.Reader, id)
+	if err != nil {
+		return "", err
+	}
+
+	id[6] = (id[6] & 0x0f) | 0x40
+	id[8] = (id[8] & 0x3f) | 0x80
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16]), nil
+}
+
+// notebookFileID gets the identifier a notebook's file is named after.
+func notebookFileID(name string, hidden bool, id string) string {
+	if hidden {
+		return id
+	}
+
+	return cleanFileName(name)
+}
+
+// notebookFilepath gets the path to a notebook's file from its identifier.
+func notebookFilepath(id string) string {
+	return fmt.Sprintf("%s/%s%s", notebooksDir, id, notebookFileExt)
+}
+
+// readNotebook reads a notebook file into memory. The name may also be a hidden notebook's ID.
 func readNotebook(name string) (*EncryptedNotebook, error) {
 	filename := cleanFileName(name)
-	filepath := fmt.Sprintf("%s/%s%s", notebooksDir, filename, notebookFileExt)
+	filepath := notebookFilepath(filename)
 
 	if _, err := os.Stat(filepath); errors.Is(err, fs.ErrNotExist) {
 		return nil, fmt.Errorf("the specified notebook does not exist")
 	}
 
-	notebookJson, err := os.ReadFile(filepath)
+	notebook, err := readNotebookFile(filepath)
 	if err != nil {
-		log.Printf("Error occurred reading notebook file (%s): %s", filepath, err)
-		return nil, fmt.Errorf("an unexpected error occurred while opening the notebook, check the logs for more details")
+		return nil, err
+	}
+
+	notebook.ID = filename
+
+	return notebook, nil
+}
+
+/*
+readNotebookHeader reads the plaintext header at the start of a notebook file. A streamed notebook's encrypted content
+is left on disk until it is decrypted, while older notebooks hold their content inline and are read whole.
+
+	filepath: the notebook file's path.
+
+	returns:  the encrypted notebook, or an error.
+*/
+func readNotebookHeader(filepath string) (*EncryptedNotebook, error) {
+	file, err := os.Open(filepath)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	headerJson, err := bufio.NewReader(file).ReadBytes('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
 	}
 
 	var notebook EncryptedNotebook
-	err = json.Unmarshal(notebookJson, &notebook)
+	err = json.Unmarshal(headerJson, &notebook)
 	if err != nil {
-		log.Printf("Error occurred parsing notebook file JSON (%s): %s", filepath, err)
-		return nil, fmt.Errorf("an unexpected error occurred while opening the notebook, check the logs for more details")
+		return nil, err
+	}
+
+	if notebook.Content == nil {
+		notebook.contentFile = filepath
+		notebook.contentOffset = int64(len(headerJson))
 	}
 
 	return &notebook, nil
 }
 
-// writeNotebook writes a notebook to a file.
+// readNotebookFile reads and parses the notebook file at a path, checking that its format is supported.
+func readNotebookFile(filepath string) (*EncryptedNotebook, error) {
+	notebook, err := readNotebookHeader(filepath)
+	if err != nil {
+		log.Printf("Error occurred reading notebook file (%s): %s", filepath, err)
+		return nil, fmt.Errorf("an unexpected error occurred while opening the notebook, check the logs for more details")
+	}
+
+	err = checkNotebookFormat(notebook, filepath)
+	if err != nil {
+		return nil, err
+	}
+
+	return notebook, nil
+}
+
+/*
+writeNotebook writes a notebook to a file, replacing any previous version of it atomically. Any entry files that have
+changed are written first, and entry files the notebook no longer refers to are removed once it has been written.
+
+	notebook: the encrypted notebook.
+
+	returns:  an error, if one occurs.
+*/
 func writeNotebook(notebook *EncryptedNotebook) error {
-	filename := cleanFileName(notebook.Name)
-	filepath := fmt.Sprintf("%s/%s%s", notebooksDir, filename, notebookFileExt)
+	return writeNotebookWithEntriesIn(notebook, notebook.ID)
+}
+
+/*
+writeNotebookWithEntriesIn writes a notebook to a file like writeNotebook, but keeps its entry files in the directory
+for another ID, such as the ID a notebook is being moved from.
+
+	notebook:          the encrypted notebook.
+	entriesNotebookID: the ID whose entries directory the entry files are written to and removed from.
 
-	notebookJson, err := json.Marshal(notebook)
+	returns:           an error, if one occurs.
+*/
+func writeNotebookWithEntriesIn(notebook *EncryptedNotebook, entriesNotebookID string) error {
+	filepath := notebookFilepath(notebook.ID)
+
+	headerJson, err := json.Marshal(notebook)
 	if err != nil {
 		log.Printf("Error occurred stringifying notebook file JSON (%s): %s", filepath, err)
 		return fmt.Errorf("an unexpected error occurred while saving the notebook, check the logs for more details")
 	}
 
-	err = os.WriteFile(filepath, notebookJson, 0755)
+	if notebook.writeEntries != nil {
+		err = notebook.writeEntries(entriesNotebookID)
+		if err != nil {
+			log.Printf("Error occurred writing notebook entry files (%s): %s", filepath, err)
+			return fmt.Errorf("an unexpected error occurred while saving the notebook, check the logs for more details")
+		}
+	}
+
+	err = writeFileAtomicFunc(filepath, func(w io.Writer) error {
+		_, err := w.Write(append(headerJson, '\n'))
+		if err != nil {
+			return err
+		}
+
+		return notebook.writeContent(w)
+	})
 	if err != nil {
 		log.Printf("Error occurred writing notebook file (%s): %s", filepath, err)
 		return fmt.Errorf("an unexpected error occurred while saving the notebook, check the logs for more details")
 	}
 
+	if notebook.entryFiles != nil {
+		removeUnusedEntryFiles(entriesNotebookID, notebook.entryFiles)
+	}
+
 	return nil
 }
 
-// encryptNotebook encrypts and returns a notebook.
-func encryptNotebook(notebook *DecryptedNotebook, key string) (*EncryptedNotebook, error) {
-	filename := cleanFileName(notebook.Name)
-	filepath := fmt.Sprintf("%s/%s%s", notebooksDir, filename, notebookFileExt)
+/*
+encryptNotebook prepares a notebook to be written as an index and a file for each changed entry. Its content is
+encrypted as writeNotebook writes it, so the key material must not be wiped until the notebook has been written.
+
+	notebook: the decrypted notebook.
+	key:      the key material to encrypt the notebook.
 
-	notebookContentJson, err := json.Marshal(notebook.Content)
+	returns:  the encrypted notebook, or an error.
+*/
+func encryptNotebook(notebook *DecryptedNotebook, key *notebookKeyMaterial) (*EncryptedNotebook, error) {
+	id := notebookFileID(notebook.Name, notebook.Hidden, notebook.ID)
+	filepath := notebookFilepath(id)
+
+	index, entryFiles, pendingEntryFiles, err := splitNotebookContent(notebook)
 	if err != nil {
-		log.Printf("Error occurred stringifying notebook file JSON (%s): %s", filepath, err)
+		log.Printf("Error occurred generating entry file names (%s): %s", filepath, err)
 		return nil, fmt.Errorf("an unexpected error occurred while encrypting the notebook, check the logs for more details")
 	}
 
-	keyHash := sha256.Sum256([]byte(key))
+	payload := notebookPayload{
+		NotebookContent: index,
+		EntryFiles: entryFiles,
+		KeySlots: notebook.keySlotDetails,
+	}
+	if notebook.Hidden {
+		payload.Metadata = &hiddenNotebookMetadata{
+			Name: notebook.Name,
+			Description: notebook.Description,
+			CreateTime: notebook.CreateTime,
+			EditTime: notebook.EditTime,
+			Revision: notebook.Revision,
+		}
+	}
 
-	block, err := aes.NewCipher(keyHash[:])
-	if err != nil {
-		log.Printf("Error occurred creating AES cipher for encrypting (%s): %s", filepath, err)
+	if key.dataKey == nil {
+		log.Printf("Refusing to encrypt notebook without a data key (%s)", filepath)
 		return nil, fmt.Errorf("an unexpected error occurred while encrypting the notebook, check the logs for more details")
 	}
-
-	aesgcm, err := cipher.NewGCM(block)
-	if err != nil {
-		log.Printf("Error occurred wrapping AES cipher in GCM for encrypting (%s): %s", filepath, err)
+	if len(notebook.keySlots) == 0 {
+		log.Printf("Refusing to encrypt notebook without any key slots (%s)", filepath)
 		return nil, fmt.Errorf("an unexpected error occurred while encrypting the notebook, check the logs for more details")
 	}
 
-	nonce := make([]byte, aesgcm.NonceSize())
-	_, err = io.ReadFull(rand.Reader, nonce)
+	encryptedNotebook := &EncryptedNotebook{
+		Version: notebookFormatVersion,
+		Cipher: notebookCipherAES256GCM,
+		ID: id,
+		Hidden: notebook.Hidden,
+		KeySlots: notebook.keySlots,
+		entryFiles: entryFiles,
+	}
+	if !notebook.Hidden {
+		encryptedNotebook.Name = notebook.Name
+		encryptedNotebook.Description = notebook.Description
+		encryptedNotebook.CreateTime = notebook.CreateTime
+		encryptedNotebook.EditTime = notebook.EditTime
+		encryptedNotebook.Revision = notebook.Revision
+	}
+
+	additionalData, err := notebookAdditionalData(encryptedNotebook)
 	if err != nil {
-		log.Printf("Error occurred reading random bytes for encrypting (%s): %s", filepath, err)
+		log.Printf("Error occurred stringifying notebook header JSON for encrypting (%s): %s", filepath, err)
 		return nil, fmt.Errorf("an unexpected error occurred while encrypting the notebook, check the logs for more details")
 	}
 
-	encryptedNotebookContent := aesgcm.Seal(nonce, nonce, notebookContentJson, nil)
+	encryptedNotebook.writeContent = func(w io.Writer) error {
+		stream, err := newStreamWriter(w, key.dataKey.Bytes(), additionalData)
+		if err != nil {
+			return err
+		}
+		defer stream.Destroy()
 
-	return &EncryptedNotebook{
-		Name: notebook.Name,
-		Description: notebook.Description,
-		CreateTime: notebook.CreateTime,
-		EditTime: notebook.EditTime,
-		Content: encryptedNotebookContent,
-	}, nil
+		err = encodeSecureJSON(stream, payload)
+		if err != nil {
+			return err
+		}
+
+		return stream.Close()
+	}
+
+	encryptedNotebook.writeEntries = func(notebookID string) error {
+		if len(pendingEntryFiles) == 0 {
+			return nil
+		}
+
+		err := os.MkdirAll(notebookEntriesDir(notebookID), 0700)
+		if err != nil {
+			return err
+		}
+
+		for _, pending := range pendingEntryFiles {
+			err = writeEntryFile(notebookID, pending, key.dataKey.Bytes())
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	return encryptedNotebook, nil
 }
 
-// decryptNotebook decrypts and returns a notebook.
-func decryptNotebook(notebook *EncryptedNotebook, key string) (*DecryptedNotebook, error) {
-	filename := cleanFileName(notebook.Name)
-	filepath := fmt.Sprintf("%s/%s%s", notebooksDir, filename, notebookFileExt)
+// saveNotebook encrypts and writes a notebook, then records the entry files it was written with.
+func saveNotebook(notebook *DecryptedNotebook, key *notebookKeyMaterial) error {
+	encryptedNotebook, err := encryptNotebook(notebook, key)
+	if err != nil {
+		return err
+	}
+
+	err = writeNotebook(encryptedNotebook)
+	if err != nil {
+		return err
+	}
 
-	keyHash := sha256.Sum256([]byte(key))
+	commitEntryFiles(notebook, encryptedNotebook)
+	removeDeletedAttachmentFiles(notebook, encryptedNotebook.ID)
+
+	return nil
+}
 
-	block, err := aes.NewCipher(keyHash[:])
+// openInlineNotebookContent decrypts the content of a notebook written before the streamed format, which was sealed
+// in a single piece, into a secure buffer.
+func openInlineNotebookContent(notebook *EncryptedNotebook, key *notebookKeyMaterial, additionalData []byte) (*secureBuffer, error) {
+	filepath := notebookFilepath(notebook.ID)
+
+	block, err := aes.NewCipher(key.key.Bytes())
 	if err != nil {
 		log.Printf("Error occurred creating AES cipher for decrypting (%s): %s", filepath, err)
 		return nil, fmt.Errorf("an unexpected error occurred while decrypting the notebook, check the logs for more details")
@@ -193,33 +464,198 @@ func decryptNotebook(notebook *EncryptedNotebook, key string) (*DecryptedNoteboo
 	}
 
 	nonceSize := aesgmc.NonceSize()
+	if len(notebook.Content) < nonceSize + aesgmc.Overhead() {
+		log.Printf("Notebook content is shorter than the nonce and tag (%s)", filepath)
+		return nil, fmt.Errorf("an unexpected error occurred while decrypting the notebook, check the logs for more details")
+	}
 	nonce, encryptedContent := notebook.Content[:nonceSize], notebook.Content[nonceSize:]
 
-	decryptedNotebookContentJson, err := aesgmc.Open(nil, nonce, encryptedContent, nil)
+	decryptedNotebookContentJson := newSecureBuffer(len(encryptedContent) - aesgmc.Overhead())
+	_, err = aesgmc.Open(decryptedNotebookContentJson.Bytes()[:0], nonce, encryptedContent, additionalData)
 	if err != nil {
+		decryptedNotebookContentJson.Destroy()
 		log.Printf("Error occurred decrypting notebook (%s): %s", filepath, err)
-		return nil, fmt.Errorf("incorrect notebook key")
+		if notebook.KeyCheck != nil {
+			return nil, fmt.Errorf("notebook metadata has been tampered with")
+		}
+		return nil, errIncorrectNotebookKey
+	}
+
+	return decryptedNotebookContentJson, nil
+}
+
+/*
+readStreamedNotebookContent decrypts a streamed notebook's content from its file a segment at a time into a secure
+buffer, and only parses it once the whole stream has been read and authenticated. The decrypted index is held in
+memory in full while it is parsed, so reading it takes about twice its size, on top of the parsed content.
+
+	notebook:       the encrypted notebook.
+	key:            the key the content was encrypted under.
+	additionalData: the notebook's authenticated header.
+	payload:        where the decrypted content is parsed into.
+
+	returns:        an error, if one occurs.
+*/
+func readStreamedNotebookContent(notebook *EncryptedNotebook, key []byte, additionalData []byte, payload *notebookPayload) error {
+	filepath := notebook.contentFile
+
+	file, err := os.Open(filepath)
+	if err != nil {
+		log.Printf("Error occurred opening notebook file for decrypting (%s): %s", filepath, err)
+		return fmt.Errorf("an unexpected error occurred while decrypting the notebook, check the logs for more details")
 	}
+	defer file.Close()
 
-	var decryptedNotebookContent NotebookContent
-	err = json.Unmarshal(decryptedNotebookContentJson, &decryptedNotebookContent)
+	_, err = file.Seek(notebook.contentOffset, io.SeekStart)
 	if err != nil {
-		log.Printf("Error occurred parsing notebook file JSON after decrypting (%s): %s", filepath, err)
-		return nil, fmt.Errorf("an unexpected error occurred while decrypting the notebook, check the logs for more details")
+		log.Printf("Error occurred seeking to notebook content for decrypting (%s): %s", filepath, err)
+		return fmt.Errorf("an unexpected error occurred while decrypting the notebook, check the logs for more details")
+	}
+
+	stream, err := newStreamReader(bufio.NewReader(file), key, additionalData)
+	if err == nil {
+		// The whole stream is read before parsing, which also makes sure the content was not truncated
+		err = decodeSecureJSON(stream, payload)
+		stream.Destroy()
+	}
+	if err != nil {
+		log.Printf("Error occurred decrypting notebook (%s): %s", filepath, err)
+		return fmt.Errorf("notebook content has been tampered with or is corrupted")
+	}
+
+	return nil
+}
+
+// decryptNotebook decrypts and returns a notebook.
+func decryptNotebook(notebook *EncryptedNotebook, key *notebookKeyMaterial) (*DecryptedNotebook, error) {
+	filepath := notebookFilepath(notebook.ID)
+
+	if notebook.KeyCheck != nil && !hmac.Equal(notebook.KeyCheck, notebookKeyCheck(key.key.Bytes())) {
+		// A key that still unwraps the data key is the right key, so it is the stored check that has been changed
+		if notebookHasDataKey(notebook) && unwrapNotebookDataKey(notebook, key) == nil {
+			log.Printf("Notebook key check does not match its data key (%s)", filepath)
+			return nil, fmt.Errorf("notebook metadata has been tampered with")
+		}
+
+		log.Printf("Notebook key check failed (%s)", filepath)
+		return nil, errIncorrectNotebookKey
+	}
+
+	contentKey := key.key.Bytes()
+	if notebookHasDataKey(notebook) {
+		err := unwrapNotebookDataKey(notebook, key)
+		if err != nil {
+			log.Printf("Error occurred unwrapping notebook data key (%s): %s", filepath, err)
+			return nil, fmt.Errorf("notebook metadata has been tampered with")
+		}
+		contentKey = key.dataKey.Bytes()
+	}
+
+	var additionalData []byte
+	if notebookHasAuthenticatedHeader(notebook) {
+		var err error
+		additionalData, err = notebookAdditionalData(notebook)
+		if err != nil {
+			log.Printf("Error occurred stringifying notebook header JSON for decrypting (%s): %s", filepath, err)
+			return nil, fmt.Errorf("an unexpected error occurred while decrypting the notebook, check the logs for more details")
+		}
+	}
+
+	var payload notebookPayload
+	if notebook.Content == nil {
+		err := readStreamedNotebookContent(notebook, contentKey, additionalData, &payload)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		decryptedNotebookContentJson, err := openInlineNotebookContent(notebook, key, additionalData)
+		if err != nil {
+			return nil, err
+		}
+
+		err = json.Unmarshal(decryptedNotebookContentJson.Bytes(), &payload)
+		decryptedNotebookContentJson.Destroy()
+		if err != nil {
+			log.Printf("Error occurred parsing notebook file JSON after decrypting (%s): %s", filepath, err)
+			return nil, fmt.Errorf("an unexpected error occurred while decrypting the notebook, check the logs for more details")
+		}
 	}
 
-	return &DecryptedNotebook{
+	decryptedNotebook := &DecryptedNotebook{
+		ID: notebook.ID,
+		Hidden: notebook.Hidden,
 		Name: notebook.Name,
 		Description: notebook.Description,
 		CreateTime: notebook.CreateTime,
 		EditTime: notebook.EditTime,
-		Content: decryptedNotebookContent,
-	}, nil
+		Revision: notebook.Revision,
+		Content: payload.NotebookContent,
+	}
+	if notebook.Hidden {
+		if payload.Metadata == nil {
+			log.Printf("Hidden notebook is missing its encrypted metadata (%s)", filepath)
+			return nil, fmt.Errorf("an unexpected error occurred while decrypting the notebook, check the logs for more details")
+		}
+
+		decryptedNotebook.Name = payload.Metadata.Name
+		decryptedNotebook.Description = payload.Metadata.Description
+		decryptedNotebook.CreateTime = payload.Metadata.CreateTime
+		decryptedNotebook.EditTime = payload.Metadata.EditTime
+		decryptedNotebook.Revision = payload.Metadata.Revision
+	}
+
+	if notebookHasEntryFiles(notebook) {
+		err := openEntryFiles(decryptedNotebook, payload.EntryFiles)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if notebookHasKeySlots(notebook) {
+		err := openKeySlots(decryptedNotebook, notebook, key, payload.KeySlots)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := migrateNotebookContent(notebook.Version, decryptedNotebook)
+	if err != nil {
+		return nil, err
+	}
+
+	return decryptedNotebook, nil
 }
 
-// updateNotebookEditTime updates a notebook's edited timestamp
+// updateNotebookEditTime updates a notebook's edited timestamp and moves it on to a new revision
 func updateNotebookEditTime(notebook *DecryptedNotebook) {
 	notebook.EditTime = time.Now()
+	notebook.Revision++
+}
+
+// notebookDetails gets a decrypted notebook's details.
+func notebookDetails(notebook *DecryptedNotebook) *NotebookDetails {
+	return &NotebookDetails{
+		ID: notebook.ID,
+		Hidden: notebook.Hidden,
+		Name: notebook.Name,
+		Description: notebook.Description,
+		CreateTime: notebook.CreateTime,
+		EditTime: notebook.EditTime,
+		Revision: notebook.Revision,
+	}
+}
+
+// encryptedNotebookDetails gets a notebook's details from its header.
+func encryptedNotebookDetails(notebook *EncryptedNotebook) *NotebookDetails {
+	return &NotebookDetails{
+		ID: notebook.ID,
+		Hidden: notebook.Hidden,
+		Name: notebook.Name,
+		Description: notebook.Description,
+		CreateTime: notebook.CreateTime,
+		EditTime: notebook.EditTime,
+		Revision: notebook.Revision,
+	}
 }
 
 /*
@@ -228,10 +664,11 @@ CreateNotebook creates a new notebook in the file system.
 	name:        the name of the new notebook.
 	description: the notebook's description.
 	key:         the key to use to encrypt the notebook.
+	hidden:      whether the notebook's details should be encrypted and its file given a random name.
 
-	returns:     the created notebook, or an error.
+	returns:     the created notebook along with its recovery key, or an error.
 */
-func CreateNotebook(name string, description string, key string) (*DecryptedNotebook, error) {
+func CreateNotebook(name string, description string, key string, hidden bool) (*CreatedNotebook, error) {
 	if len(name) < notebookNameMinLength || len(name) > notebookNameMaxLength {
 		return nil, fmt.Errorf("notebook name must be between %d and %d characters in length", notebookNameMinLength, notebookNameMaxLength)
 	}
@@ -242,34 +679,68 @@ func CreateNotebook(name string, description string, key string) (*DecryptedNote
 		return nil, fmt.Errorf("notebook key must be between %d and %d characters in length", notebookKeyMinLength, notebookKeyMaxLength)
 	}
 
-	filename := cleanFileName(name)
-	filepath := fmt.Sprintf("%s/%s%s", notebooksDir, filename, notebookFileExt)
+	id := cleanFileName(name)
+	if hidden {
+		var err error
+		id, err = newNotebookID()
+		if err != nil {
+			log.Printf("Error occurred generating hidden notebook ID: %s", err)
+			return nil, fmt.Errorf("an unexpected error occurred while creating the notebook, check the logs for more details")
+		}
+	}
 
-	if _, err := os.Stat(filepath); !errors.Is(err, fs.ErrNotExist) {
+	unlock := lockNotebookForWrite(id)
+	defer unlock()
+
+	if _, err := os.Stat(notebookFilepath(id)); !errors.Is(err, fs.ErrNotExist) {
 		return nil, fmt.Errorf("the specified notebook name is too similar to the name of another notebook")
 	}
 
 	notebook := &DecryptedNotebook{
+		ID: id,
+		Hidden: hidden,
 		Name: name,
 		Description: description,
 		CreateTime: time.Now(),
 		EditTime: time.Time{},
+		Revision: 1,
 		Content: NotebookContent{
 			Entries: make(map[string]*NotebookEntry),
 		},
 	}
 
-	encryptedNotebook, err := encryptNotebook(notebook, key)
+	keyMaterial, err := newNotebookKeyMaterial(key)
+	if err != nil {
+		log.Printf("Error occurred deriving key for new notebook (%s): %s", notebookFilepath(id), err)
+		return nil, fmt.Errorf("an unexpected error occurred while encrypting the notebook, check the logs for more details")
+	}
+	defer wipeKeyMaterial(keyMaterial)
+
+	keyMaterial.dataKey, err = newNotebookDataKey()
+	if err != nil {
+		log.Printf("Error occurred generating data key for new notebook (%s): %s", notebookFilepath(id), err)
+		return nil, fmt.Errorf("an unexpected error occurred while encrypting the notebook, check the logs for more details")
+	}
+
+	_, err = addKeySlot(notebook, keyMaterial, passwordKeySlotLabel, false)
 	if err != nil {
 		return nil, err
 	}
 
-	err = writeNotebook(encryptedNotebook)
+	recoveryKey, err := addRecoveryKeySlot(notebook, keyMaterial.dataKey, recoveryKeySlotLabel)
 	if err != nil {
 		return nil, err
 	}
 
-	return notebook, nil
+	err = saveNotebook(notebook, keyMaterial)
+	if err != nil {
+		return nil, err
+	}
+
+	return &CreatedNotebook{
+		DecryptedNotebook: notebook,
+		RecoveryKey: recoveryKey.Key,
+	}, nil
 }
 
 /*
@@ -288,22 +759,19 @@ func ListNotebooks() ([]*EncryptedNotebook, error) {
 
 	for _, file := range files {
 		if !file.IsDir() && strings.HasSuffix(file.Name(), notebookFileExt) {
-			var notebook EncryptedNotebook
-
 			notebookPath := fmt.Sprintf("%s/%s", notebooksDir, file.Name())
-			notebookJson, err := os.ReadFile(notebookPath)
+			notebook, err := readNotebookHeader(notebookPath)
 			if err != nil {
 				log.Printf("Error occurred reading notebook file (%s): %s", notebookPath, err)
 				return nil, fmt.Errorf("an unexpected error occurred while opening the notebooks, check the logs for more details")
 			}
 
-			err = json.Unmarshal(notebookJson, &notebook)
-			if err != nil {
-				log.Printf("Error occurred parsing notebook file JSON (%s): %s", notebookPath, err)
-				return nil, fmt.Errorf("an unexpected error occurred while opening the notebooks, check the logs for more details")
+			notebook.ID = strings.TrimSuffix(file.Name(), notebookFileExt)
+			if notebook.Hidden {
+				notebook.Name = hiddenNotebookPlaceholderName
 			}
 
-			notebooks = append(notebooks, &notebook)
+			notebooks = append(notebooks, notebook)
 		}
 	}
 
@@ -318,37 +786,133 @@ GetNotebookDetails attempts to retrieve a specified notebook's details.
 	returns: the notebook's details, or an error.
 */
 func GetNotebookDetails(name string) (*NotebookDetails, error) {
+	unlock := lockNotebookForRead(name)
+	defer unlock()
+
 	encryptedNotebook, err := readNotebook(name)
 	if err != nil {
 		return nil, err
 	}
 
-	return &NotebookDetails{
-		Name: encryptedNotebook.Name,
-		Description: encryptedNotebook.Description,
-		CreateTime: encryptedNotebook.CreateTime,
-		EditTime: encryptedNotebook.EditTime,
-	}, nil
+	// An unlocked notebook's file lags behind its pending changes, so its details are taken from the cache. A hidden
+	// notebook's details are only ever taken from its file, where they are not revealed
+	if !encryptedNotebook.Hidden {
+		if details, ok := cachedNotebookDetails(encryptedNotebook.ID); ok {
+			return details, nil
+		}
+	}
+
+	return encryptedNotebookDetails(encryptedNotebook), nil
+}
+
+// openNotebook decrypts a notebook, upgrading its file if needed, and returns it along with its key material.
+func openNotebook(name string, key string) (*DecryptedNotebook, *notebookKeyMaterial, error) {
+	err := flushCachedNotebook(cleanFileName(name))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	encryptedNotebook, err := readNotebook(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	filepath := notebookFilepath(encryptedNotebook.ID)
+
+	finishAttempt, err := beginUnlockAttempt(encryptedNotebook.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyMaterial, err := notebookKeyMaterialFor(encryptedNotebook, key)
+	if err != nil {
+		finishAttempt(err)
+		return nil, nil, err
+	}
+
+	// Notebooks from before key checks only show their key was incorrect once they fail to decrypt
+	notebook, err := decryptNotebook(encryptedNotebook, keyMaterial)
+	finishAttempt(err)
+	if err != nil {
+		wipeKeyMaterial(keyMaterial)
+		return nil, nil, err
+	}
+
+	if notebookNeedsUpgrade(encryptedNotebook) {
+		// Entry files from before notebooks had a data key are decrypted now, to be encrypted again under a new one
+		if notebookHasEntryFiles(encryptedNotebook) && !notebookHasDataKey(encryptedNotebook) {
+			notebook.dataKey = legacyDataKey(keyMaterial)
+			err = loadAllEntryBodies(notebook)
+			notebook.dataKey.Destroy()
+			notebook.dataKey = nil
+			if err != nil {
+				wipeKeyMaterial(keyMaterial)
+				return nil, nil, err
+			}
+			notebook.entryFiles = nil
+		}
+
+		if keyMaterial.kdf == nil {
+			wipeKeyMaterial(keyMaterial)
+			keyMaterial, err = newNotebookKeyMaterial(key)
+			if err != nil {
+				log.Printf("Error occurred deriving key for upgrading (%s): %s", filepath, err)
+				return nil, nil, fmt.Errorf("an unexpected error occurred while upgrading the notebook, check the logs for more details")
+			}
+		}
+
+		if keyMaterial.dataKey == nil {
+			keyMaterial.dataKey, err = newNotebookDataKey()
+			if err != nil {
+				wipeKeyMaterial(keyMaterial)
+				log.Printf("Error occurred generating data key for upgrading (%s): %s", filepath, err)
+				return nil, nil, fmt.Errorf("an unexpected error occurred while upgrading the notebook, check the logs for more details")
+			}
+		}
+
+		// The notebook key becomes the notebook's first key slot
+		if len(notebook.keySlots) == 0 {
+			_, err = addKeySlot(notebook, keyMaterial, passwordKeySlotLabel, false)
+			if err != nil {
+				wipeKeyMaterial(keyMaterial)
+				return nil, nil, err
+			}
+		}
+
+		err = upgradeNotebook(encryptedNotebook.Version, notebook, keyMaterial)
+		if err != nil {
+			wipeKeyMaterial(keyMaterial)
+			return nil, nil, err
+		}
+	}
+
+	return notebook, keyMaterial, nil
 }
 
 /*
 OpenNotebook attempts to open a specified notebook.
 
-	name:    the notebook's name.
-	key:     the key to decrypt the notebook.
+	name:        the notebook's name.
+	credentials: the notebook key or session token.
 
-	returns: the decrypted notebook, or an error.
+	returns:     the decrypted notebook, or an error.
 */
-func OpenNotebook(name string, key string) (*DecryptedNotebook, error) {
-	encryptedNotebook, err := readNotebook(name)
-	if err != nil {
-		return nil, err
-	}
+func OpenNotebook(name string, credentials NotebookCredentials) (*DecryptedNotebook, error) {
+	unlock := lockNotebookForWrite(name)
+	defer unlock()
 
-	notebook, err := decryptNotebook(encryptedNotebook, key)
+	notebook, keyMaterial, err := loadNotebook(name, credentials)
 	if err != nil {
 		return nil, err
 	}
+	wipeKeyMaterial(keyMaterial)
+
+	// Entry history, trash and attachments have their own routes, so they are left out of the opened notebook, which
+	// also keeps attachment keys from leaving the backend. Entries are listed from the notebook's index without their
+	// content, which is fetched an entry at a time
+	notebook.Content.History = nil
+	notebook.Content.Trash = nil
+	notebook.Content.Attachments = nil
 
 	return notebook, nil
 }
@@ -356,121 +920,296 @@ func OpenNotebook(name string, key string) (*DecryptedNotebook, error) {
 /*
 SetNotebookName changes a notebook's name and file name.
 
-	name:    the notebook's current name.
-	newName: the notebook's new name.
+	name:             the notebook's current name.
+	credentials:      the notebook key or session token.
+	newName:          the notebook's new name.
+	expectedRevision: the notebook revision the caller last read, or nil to skip the check.
 
-	returns: the updated notebook, or an error.
+	returns:          the updated notebook, or an error.
 */
-func SetNotebookName(name string, newName string) (*EncryptedNotebook, error) {
+func SetNotebookName(name string, credentials NotebookCredentials, newName string, expectedRevision *int) (*EncryptedNotebook, error) {
 	if len(newName) < notebookNameMinLength || len(newName) > notebookNameMaxLength {
 		return nil, fmt.Errorf("new notebook name must be between %d and %d characters in length", notebookNameMinLength, notebookNameMaxLength)
 	}
 
-	notebook, err := readNotebook(name)
+	unlock := lockNotebooksForWrite(name, newName)
+	defer unlock()
+
+	notebook, keyMaterial, err := loadNotebook(name, credentials)
+	if err != nil {
+		return nil, err
+	}
+	defer wipeKeyMaterial(keyMaterial)
+
+	err = checkNotebookRevision(notebook, expectedRevision)
 	if err != nil {
 		return nil, err
 	}
 
-	oldFilename := cleanFileName(notebook.Name)
-	oldFilepath := fmt.Sprintf("%s/%s%s", notebooksDir, oldFilename, notebookFileExt)
 	notebook.Name = newName
+	notebook.Revision++
 
-	err = writeNotebook(notebook)
+	encryptedNotebook, err := encryptNotebook(notebook, keyMaterial)
 	if err != nil {
 		return nil, err
 	}
 
-	err = os.Remove(oldFilepath)
-	if err != nil {
-		log.Printf("Error occurred deleting old notebook file (%s): %s", oldFilepath, err)
-		return nil, fmt.Errorf("an unexpected error occurred while renaming the notebook, check the logs for more details")
+	if encryptedNotebook.ID != notebook.ID {
+		if _, err := os.Stat(notebookFilepath(encryptedNotebook.ID)); !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("the specified notebook name is too similar to the name of another notebook")
+		}
+
+		err = moveNotebook(encryptedNotebook, notebook.ID)
+		if err != nil {
+			// Once the old file is gone the notebook has moved, even if its entry files and attachments have not yet
+			if _, statErr := os.Stat(notebookFilepath(notebook.ID)); errors.Is(statErr, fs.ErrNotExist) {
+				renameNotebookSessions(notebook.ID, encryptedNotebook.ID)
+				evictCachedNotebook(notebook.ID)
+			}
+			return nil, err
+		}
+
+		renameNotebookSessions(notebook.ID, encryptedNotebook.ID)
+	} else {
+		err = writeNotebook(encryptedNotebook)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	return notebook, nil
+	removeDeletedAttachmentFiles(notebook, encryptedNotebook.ID)
+	evictCachedNotebook(notebook.ID)
+
+	return encryptedNotebook, nil
 }
 
 /*
 SetNotebookDescription changes a notebook's description.
 
-	name:           the notebook's name.
-	newDescription: the notebook's new description.
+	name:             the notebook's name.
+	credentials:      the notebook key or session token.
+	newDescription:   the notebook's new description.
+	expectedRevision: the notebook revision the caller last read, or nil to skip the check.
 
-	returns:        the updated notebook, or an error.
+	returns:          the updated notebook, or an error.
 */
-func SetNotebookDescription(name string, newDescription string) (*EncryptedNotebook, error) {
+func SetNotebookDescription(name string, credentials NotebookCredentials, newDescription string, expectedRevision *int) (*EncryptedNotebook, error) {
 	if len(newDescription) < notebookDescriptionMinLength || len(newDescription) > notebookDescriptionMaxLength {
 		return nil, fmt.Errorf("new notebook description must be between %d and %d characters in length", notebookDescriptionMinLength, notebookDescriptionMaxLength)
 	}
 
-	notebook, err := readNotebook(name)
+	unlock := lockNotebookForWrite(name)
+	defer unlock()
+
+	notebook, keyMaterial, err := loadNotebook(name, credentials)
+	if err != nil {
+		return nil, err
+	}
+	defer wipeKeyMaterial(keyMaterial)
+
+	err = checkNotebookRevision(notebook, expectedRevision)
 	if err != nil {
 		return nil, err
 	}
 
 	notebook.Description = newDescription
+	notebook.Revision++
 
-	err = writeNotebook(notebook)
+	encryptedNotebook, err := encryptNotebook(notebook, keyMaterial)
 	if err != nil {
 		return nil, err
 	}
 
-	return notebook, nil
+	err = writeNotebook(encryptedNotebook)
+	if err != nil {
+		return nil, err
+	}
+
+	removeDeletedAttachmentFiles(notebook, encryptedNotebook.ID)
+	evictCachedNotebook(notebook.ID)
+
+	return encryptedNotebook, nil
 }
 
 /*
-SetNotebookKey changes a notebook's key.
+rewrapNotebookKey wraps a notebook's data key under a new notebook key, in place of one of its key slots. Only the
+notebook's header is rewritten, and its encrypted content is copied across as it is, since the data key it is
+encrypted under does not change.
 
-	name:    the notebook's name.
-	key:     the notebook key.
-	newKey:  the new notebook key.
+	encryptedNotebook: the notebook, as read from its file.
+	slotID:            the ID of the key slot to replace.
+	key:               the key material derived from the new notebook key, holding the notebook's data key.
+
+	returns:           an error, if one occurs.
+*/
+func rewrapNotebookKey(encryptedNotebook *EncryptedNotebook, slotID string, key *notebookKeyMaterial) error {
+	filepath := notebookFilepath(encryptedNotebook.ID)
+
+	if !notebookHasKeySlots(encryptedNotebook) || encryptedNotebook.contentFile == "" {
+		log.Printf("Notebook cannot have its data key rewrapped in format version %d (%s)", encryptedNotebook.Version, filepath)
+		return fmt.Errorf("an unexpected error occurred while encrypting the notebook, check the logs for more details")
+	}
+
+	i, _ := findKeySlot(encryptedNotebook.KeySlots, slotID)
+	if i < 0 {
+		log.Printf("Notebook key slot '%s' to rewrap does not exist (%s)", slotID, filepath)
+		return fmt.Errorf("an unexpected error occurred while encrypting the notebook, check the logs for more details")
+	}
+
+	// The slot keeps its ID, which is how the notebook's index lists it
+	slot, err := newKeySlot(slotID, key)
+	if err != nil {
+		log.Printf("Error occurred wrapping notebook data key (%s): %s", filepath, err)
+		return fmt.Errorf("an unexpected error occurred while encrypting the notebook, check the logs for more details")
+	}
+
+	encryptedNotebook.KeySlots[i] = slot
+	encryptedNotebook.writeContent = func(w io.Writer) error {
+		file, err := os.Open(encryptedNotebook.contentFile)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		_, err = file.Seek(encryptedNotebook.contentOffset, io.SeekStart)
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(w, file)
+		return err
+	}
+
+	return writeNotebook(encryptedNotebook)
+}
+
+/*
+SetNotebookKey changes the notebook key in the key slot that the current key unlocks, leaving any other slots as they
+are. The current key is checked against its slot and the data key it unwraps is wrapped under the new key, so only
+the notebook's header is rewritten and its content is never decrypted. The notebook's revision does not change.
+
+	name:             the notebook's name.
+	key:              the notebook key.
+	newKey:           the new notebook key.
+	expectedRevision: the notebook revision the caller last read, or nil to skip the check.
 
-	returns: an error, if one occurs.
+	returns:          an error, if one occurs.
 */
-func SetNotebookKey(name string, key string, newKey string) error {
+func SetNotebookKey(name string, key string, newKey string, expectedRevision *int) error {
 	if len(newKey) < notebookKeyMinLength || len(newKey) > notebookKeyMaxLength {
 		return fmt.Errorf("notebook key must be between %d and %d characters in length", notebookKeyMinLength, notebookKeyMaxLength)
 	}
 
-	notebook, err := OpenNotebook(name, key)
+	unlock := lockNotebookForWrite(name)
+	defer unlock()
+
+	// Pending changes are saved first, so the header that is rewritten below is the current one
+	err := flushCachedNotebook(cleanFileName(name))
 	if err != nil {
 		return err
 	}
 
-	encryptedNotebook, err := encryptNotebook(notebook, newKey)
+	encryptedNotebook, oldKeyMaterial, err := readNotebookWithKey(name, key)
 	if err != nil {
 		return err
 	}
+	defer wipeKeyMaterial(oldKeyMaterial)
 
-	err = writeNotebook(encryptedNotebook)
+	filepath := notebookFilepath(encryptedNotebook.ID)
+
+	// The key matched its slot's key check, so a data key that does not unwrap means the slot has been changed
+	err = unwrapNotebookDataKey(encryptedNotebook, oldKeyMaterial)
+	if err != nil {
+		log.Printf("Error occurred unwrapping notebook data key (%s): %s", filepath, err)
+		return fmt.Errorf("notebook metadata has been tampered with")
+	}
+
+	recovery := oldKeyMaterial.recovery
+
+	// Hidden notebooks only keep their revision in their index, and slots from before recovery keys were bound to their
+	// data keys are only listed as such there, so either needs the index decrypted
+	_, slot := findKeySlot(encryptedNotebook.KeySlots, oldKeyMaterial.slotID)
+	if encryptedNotebook.Hidden || slot.Version < keySlotVersionBoundRecovery {
+		notebook, err := decryptNotebook(encryptedNotebook, oldKeyMaterial)
+		if err != nil {
+			return err
+		}
+
+		err = checkNotebookRevision(notebook, expectedRevision)
+		if err != nil {
+			return err
+		}
+
+		if slot.Version < keySlotVersionBoundRecovery {
+			slotDetails := notebook.keySlotDetails[oldKeyMaterial.slotID]
+			recovery = slotDetails != nil && slotDetails.Recovery
+		}
+	} else {
+		err = checkEncryptedNotebookRevision(encryptedNotebook, expectedRevision)
+		if err != nil {
+			return err
+		}
+	}
+
+	if recovery {
+		return fmt.Errorf("a recovery key cannot be changed, add a new key slot instead")
+	}
+
+	keyMaterial, err := newNotebookKeyMaterial(newKey)
+	if err != nil {
+		log.Printf("Error occurred deriving new key (%s): %s", filepath, err)
+		return fmt.Errorf("an unexpected error occurred while encrypting the notebook, check the logs for more details")
+	}
+	defer wipeKeyMaterial(keyMaterial)
+	keyMaterial.dataKey = oldKeyMaterial.dataKey.Copy()
+
+	err = rewrapNotebookKey(encryptedNotebook, oldKeyMaterial.slotID, keyMaterial)
 	if err != nil {
 		return err
 	}
 
+	lockNotebookSessions(encryptedNotebook.ID, notebookLockedKeyChanged)
+
 	return nil
 }
 
 /*
-DeleteNotebook deletes a notebook from the file system and requires the notebook key as confirmation.
+DeleteNotebook moves a notebook to the trash and requires the notebook key or a session as confirmation.
 
-	name:    the notebook's name.
-	key:     the notebook key, used as deletion confirmation.
+	name:             the notebook's name.
+	credentials:      the notebook key or session token, used as deletion confirmation.
+	expectedRevision: the notebook revision the caller last read, or nil to skip the check.
 
-	returns: an error, if one occurs.
+	returns:          an error, if one occurs.
 */
-func DeleteNotebook(name string, key string) error {
-	_, err := OpenNotebook(name, key)
+func DeleteNotebook(name string, credentials NotebookCredentials, expectedRevision *int) error {
+	unlock := lockNotebookForWrite(name)
+	defer unlock()
+
+	notebook, keyMaterial, err := loadNotebook(name, credentials)
 	if err != nil {
 		return err
 	}
+	wipeKeyMaterial(keyMaterial)
 
-	filename := cleanFileName(name)
-	filepath := fmt.Sprintf("%s/%s%s", notebooksDir, filename, notebookFileExt)
+	err = checkNotebookRevision(notebook, expectedRevision)
+	if err != nil {
+		return err
+	}
 
-	err = os.Remove(filepath)
+	// Pending changes from sessions are saved first, so they go to the trash with the notebook
+	err = flushCachedNotebook(notebook.ID)
 	if err != nil {
-		log.Printf("Error occurred deleting the notebook file (%s): %s", filepath, err)
-		return fmt.Errorf("an unexpected error occurred while deleting the notebook, check the logs for more details")
+		return err
 	}
 
+	err = trashNotebook(notebook.ID)
+	if err != nil {
+		return err
+	}
+
+	lockNotebookSessions(notebook.ID, notebookLockedDeleted)
+	clearUnlockAttempts(notebook.ID)
+
 	return nil
 }
@@ -0,0 +1,184 @@
+package services
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"testing"
+)
+
+// TestSetNotebookNameWithUnsavedEdits checks that renaming a notebook while its session has edits waiting to be saved
+// keeps every entry readable under the new name.
+func TestSetNotebookNameWithUnsavedEdits(t *testing.T) {
+	tests := []struct {
+		name             string
+		leftoverEntryDir bool
+	}{
+		{"new entries directory absent", false},
+		{"new entries directory left behind", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			notebookName := "Rename Test " + test.name
+			newName := "Renamed Test " + test.name
+			credentials := unlockTestNotebook(t, notebookName, "rename-test-key")
+
+			saved, err := CreateNotebookEntry(notebookName, credentials, "saved", "")
+			if err != nil {
+				t.Fatalf("creating entry: %s", err)
+			}
+			_, err = SetNotebookEntryContent(notebookName, credentials, saved.ID, "saved content", nil)
+			if err != nil {
+				t.Fatalf("setting content: %s", err)
+			}
+			edited, err := CreateNotebookEntry(notebookName, credentials, "edited", "")
+			if err != nil {
+				t.Fatalf("creating entry: %s", err)
+			}
+
+			err = flushCachedNotebook(cleanFileName(notebookName))
+			if err != nil {
+				t.Fatalf("saving notebook: %s", err)
+			}
+
+			// This edit is still waiting for the delayed save when the notebook is renamed
+			_, err = SetNotebookEntryContent(notebookName, credentials, edited.ID, "unsaved content", nil)
+			if err != nil {
+				t.Fatalf("setting content: %s", err)
+			}
+
+			if test.leftoverEntryDir {
+				// A directory that is not empty cannot be renamed over, so it has to be merged with
+				leftoverDir := notebookEntriesDir(cleanFileName(newName))
+				err = os.MkdirAll(leftoverDir, 0700)
+				if err != nil {
+					t.Fatalf("creating leftover entries directory: %s", err)
+				}
+				err = os.WriteFile(leftoverDir + "/leftover" + entryFileExt, []byte("leftover"), 0600)
+				if err != nil {
+					t.Fatalf("creating leftover entry file: %s", err)
+				}
+			}
+
+			_, err = SetNotebookName(notebookName, credentials, newName, nil)
+			if err != nil {
+				t.Fatalf("renaming notebook: %s", err)
+			}
+
+			expected := map[string]string{saved.ID: "saved content", edited.ID: "unsaved content"}
+			for entryID, content := range expected {
+				entry, err := GetNotebookEntry(newName, NotebookCredentials{Key: "rename-test-key"}, entryID)
+				if err != nil {
+					t.Fatalf("getting entry after rename: %s", err)
+				}
+				if entry.Content != content {
+					t.Errorf("expected content %q after rename, found %q", content, entry.Content)
+				}
+			}
+
+			oldID := cleanFileName(notebookName)
+			for _, path := range []string{notebookEntriesDir(oldID), notebookRenameJournalPath(oldID)} {
+				if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+					t.Errorf("expected %s to be gone after rename, got %v", path, err)
+				}
+			}
+		})
+	}
+}
+
+// TestSetHiddenNotebookKeyRevision checks that a hidden notebook's key can be changed at its current revision, which
+// is only kept in its encrypted index.
+func TestSetHiddenNotebookKeyRevision(t *testing.T) {
+	created, err := CreateNotebook("Hidden Key Test", "", "hidden-key-test-key", true)
+	if err != nil {
+		t.Fatalf("creating notebook: %s", err)
+	}
+	notebookID := created.ID
+
+	_, err = SetNotebookDescription(notebookID, NotebookCredentials{Key: "hidden-key-test-key"}, "changed", nil)
+	if err != nil {
+		t.Fatalf("setting description: %s", err)
+	}
+	notebook, err := OpenNotebook(notebookID, NotebookCredentials{Key: "hidden-key-test-key"})
+	if err != nil {
+		t.Fatalf("opening notebook: %s", err)
+	}
+	currentRevision := notebook.Revision
+	staleRevision := currentRevision - 1
+
+	tests := []struct {
+		name             string
+		key              string
+		newKey           string
+		expectedRevision *int
+		wantConflict     bool
+	}{
+		{"stale revision", "hidden-key-test-key", "hidden-key-test-key-2", &staleRevision, true},
+		{"current revision", "hidden-key-test-key", "hidden-key-test-key-2", &currentRevision, false},
+		{"no revision", "hidden-key-test-key-2", "hidden-key-test-key-3", nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := SetNotebookKey(notebookID, test.key, test.newKey, test.expectedRevision)
+
+			var conflict *RevisionConflictError
+			if errors.As(err, &conflict) != test.wantConflict {
+				t.Fatalf("expected a revision conflict to be %t, got %v", test.wantConflict, err)
+			}
+			if test.wantConflict {
+				details, ok := conflict.Current.(*NotebookDetails)
+				if !ok || details.Revision != currentRevision {
+					t.Errorf("expected the conflict to carry revision %d, got %+v", currentRevision, conflict.Current)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("changing key: %s", err)
+			}
+
+			_, err = OpenNotebook(notebookID, NotebookCredentials{Key: test.newKey})
+			if err != nil {
+				t.Errorf("opening notebook with the new key: %s", err)
+			}
+		})
+	}
+}
+
+// TestGetHiddenNotebookDetails checks that an unlocked hidden notebook's details are masked like a locked one's.
+func TestGetHiddenNotebookDetails(t *testing.T) {
+	created, err := CreateNotebook("Hidden Details Test", "secret description", "hidden-details-test-key", true)
+	if err != nil {
+		t.Fatalf("creating notebook: %s", err)
+	}
+	notebookID := created.ID
+
+	locked, err := GetNotebookDetails(notebookID)
+	if err != nil {
+		t.Fatalf("getting details: %s", err)
+	}
+
+	session, err := UnlockNotebook(notebookID, "hidden-details-test-key")
+	if err != nil {
+		t.Fatalf("unlocking notebook: %s", err)
+	}
+	defer LockNotebook(session.Token)
+
+	// The change is only in the cache until the delayed save
+	_, err = CreateNotebookEntry(notebookID, NotebookCredentials{SessionToken: session.Token}, "entry", "")
+	if err != nil {
+		t.Fatalf("creating entry: %s", err)
+	}
+
+	unlocked, err := GetNotebookDetails(notebookID)
+	if err != nil {
+		t.Fatalf("getting details: %s", err)
+	}
+	if *unlocked != *locked {
+		t.Errorf("expected the unlocked notebook's details %+v to be masked like %+v", unlocked, locked)
+	}
+	if unlocked.Name != "" || unlocked.Description != "" || !unlocked.CreateTime.IsZero() || !unlocked.EditTime.IsZero() || unlocked.Revision != 0 {
+		t.Errorf("expected the hidden notebook's details to be masked, found %+v", unlocked)
+	}
+}
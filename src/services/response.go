@@ -2,6 +2,7 @@ package services
 
 import (
 	"net/http"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
 )
@@ -24,7 +25,7 @@ func JSONError(c *gin.Context, err string) {
 
 // JSONUnauthorized sends an unauthorized error message in JSON format
 func JSONUnauthorized(c *gin.Context, err string) {
-	c.JSON(http.StatusBadRequest, gin.H{
+	c.JSON(http.StatusUnauthorized, gin.H{
 		"data": nil,
 		"error": err,
 	})
@@ -45,3 +46,28 @@ func JSONNotFound(c *gin.Context, err string) {
 		"error": err,
 	})
 }
+
+// JSONConflict sends a conflict error message in JSON format, along with the current version of what was changed
+func JSONConflict(c *gin.Context, err string, current interface{}) {
+	c.JSON(http.StatusConflict, gin.H{
+		"data": current,
+		"error": err,
+	})
+}
+
+// JSONLocked sends a locked error message in JSON format, for when a notebook has to be unlocked again
+func JSONLocked(c *gin.Context, err string) {
+	c.JSON(http.StatusLocked, gin.H{
+		"data": nil,
+		"error": err,
+	})
+}
+
+// JSONTooManyRequests sends a too many requests error message in JSON format, telling the client when to retry
+func JSONTooManyRequests(c *gin.Context, err string, retryAfter int) {
+	c.Header("Retry-After", strconv.Itoa(retryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"data": nil,
+		"error": err,
+	})
+}
@@ -0,0 +1,66 @@
+package services
+
+// RevisionConflictError is returned when a change is made against a revision of a notebook or entry that is no
+// longer the current one, meaning someone else has changed it since the caller last read it.
+type RevisionConflictError struct {
+	Message string
+	Current interface{}
+}
+
+// Error gets the conflict's error message.
+func (err *RevisionConflictError) Error() string {
+	return err.Message
+}
+
+// checkEntryRevision makes sure an entry has not changed since the caller last read it.
+func checkEntryRevision(entry *NotebookEntry, expectedRevision *int) error {
+	if expectedRevision == nil || *expectedRevision == entry.Revision {
+		return nil
+	}
+
+	current := *entry
+	return &RevisionConflictError{
+		Message: "the entry has been changed since it was last read",
+		Current: &current,
+	}
+}
+
+// checkUnloadedEntryRevision makes sure an entry whose body may not have been loaded has not changed since the caller
+// last read it. The body is only decrypted if the entry has changed, so the conflict carries its current content.
+func checkUnloadedEntryRevision(notebook *DecryptedNotebook, entry *NotebookEntry, expectedRevision *int) error {
+	if expectedRevision == nil || *expectedRevision == entry.Revision {
+		return nil
+	}
+
+	err := loadEntryBody(notebook, entry.ID)
+	if err != nil {
+		return err
+	}
+
+	return checkEntryRevision(entry, expectedRevision)
+}
+
+// checkNotebookRevision makes sure a notebook has not changed since the caller last read it.
+func checkNotebookRevision(notebook *DecryptedNotebook, expectedRevision *int) error {
+	if expectedRevision == nil || *expectedRevision == notebook.Revision {
+		return nil
+	}
+
+	return &RevisionConflictError{
+		Message: "the notebook has been changed since it was last read",
+		Current: notebookDetails(notebook),
+	}
+}
+
+// checkEncryptedNotebookRevision makes sure a notebook has not changed since the caller last read it, going by its
+// header alone.
+func checkEncryptedNotebookRevision(notebook *EncryptedNotebook, expectedRevision *int) error {
+	if expectedRevision == nil || *expectedRevision == notebook.Revision {
+		return nil
+	}
+
+	return &RevisionConflictError{
+		Message: "the notebook has been changed since it was last read",
+		Current: encryptedNotebookDetails(notebook),
+	}
+}
@@ -0,0 +1,175 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"unsafe"
+)
+
+const (
+	secureBufferMinGrowth = 4 * 1024
+)
+
+var (
+	memoryLockWarning sync.Once
+)
+
+/*
+secureBuffer holds a secret in memory that is locked against swapping where possible and is wiped once destroyed.
+Derived keys and data keys, the plaintext passing through stream containers, and decrypted JSON are kept in secure
+buffers for as long as they are needed.
+
+Some copies are out of reach: notebook keys arrive from the API as strings, parsed content is held in ordinary strings
+and slices, and the standard library keeps its own copies in cipher key schedules, Argon2's working memory and
+encoding/json's buffers. Plaintext is therefore never held in a secure buffer longer than it takes to parse or write it.
+*/
+type secureBuffer struct {
+	data   []byte
+	region []byte
+	locked bool
+}
+
+/*
+newSecureBuffer allocates a zeroed secure buffer. The buffer's pages are not shared with anything else, so unlocking
+them when the buffer is destroyed cannot unlock memory that something else relies on. Go does not move memory once
+it has been allocated on the heap, so the pages stay where they were locked.
+
+	size:    the size of the buffer in bytes.
+
+	returns: the secure buffer, which must be destroyed once it is no longer needed.
+*/
+func newSecureBuffer(size int) *secureBuffer {
+	if size <= 0 {
+		return &secureBuffer{
+			data: []byte{},
+		}
+	}
+
+	pageSize := os.Getpagesize()
+	regionSize := (size + pageSize - 1) / pageSize * pageSize
+
+	backing := make([]byte, regionSize + pageSize)
+	offset := (pageSize - int(uintptr(unsafe.Pointer(&backing[0])) % uintptr(pageSize))) % pageSize
+	region := backing[offset:offset + regionSize:offset + regionSize]
+
+	buffer := &secureBuffer{
+		data: region[:size:size],
+		region: region,
+	}
+
+	err := lockMemory(region)
+	if err != nil {
+		memoryLockWarning.Do(func() {
+			log.Printf("Memory holding secrets could not be locked and may be swapped to disk: %s", err)
+		})
+	} else {
+		buffer.locked = true
+	}
+
+	return buffer
+}
+
+// newSecureBufferFrom moves a secret into a new secure buffer, wiping the original.
+func newSecureBufferFrom(secret []byte) *secureBuffer {
+	buffer := newSecureBuffer(len(secret))
+	copy(buffer.data, secret)
+	wipeBytes(secret)
+
+	return buffer
+}
+
+// Bytes gets the secret held by a buffer, which is only valid until the buffer is destroyed.
+func (b *secureBuffer) Bytes() []byte {
+	if b == nil {
+		return nil
+	}
+
+	return b.data
+}
+
+// Copy makes a copy of a buffer that can be destroyed independently of the original.
+func (b *secureBuffer) Copy() *secureBuffer {
+	if b == nil {
+		return nil
+	}
+
+	buffer := newSecureBuffer(len(b.data))
+	copy(buffer.data, b.data)
+
+	return buffer
+}
+
+// Destroy wipes a buffer and unlocks its memory. Destroying a buffer more than once does nothing.
+func (b *secureBuffer) Destroy() {
+	if b == nil || b.region == nil {
+		return
+	}
+
+	wipeBytes(b.region)
+	if b.locked {
+		err := unlockMemory(b.region)
+		if err != nil {
+			log.Printf("Error occurred unlocking wiped memory: %s", err)
+		}
+	}
+
+	b.data = nil
+	b.region = nil
+	b.locked = false
+}
+
+// readSecureBuffer reads everything from a reader into a secure buffer, so decrypted data is never held anywhere else.
+func readSecureBuffer(r io.Reader) (*secureBuffer, error) {
+	buffer := newSecureBuffer(secureBufferMinGrowth)
+	n := 0
+
+	for {
+		if n == len(buffer.data) {
+			grown := newSecureBuffer(2 * len(buffer.data))
+			copy(grown.data, buffer.data)
+			buffer.Destroy()
+			buffer = grown
+		}
+
+		read, err := r.Read(buffer.data[n:])
+		n += read
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			buffer.Destroy()
+			return nil, err
+		}
+	}
+
+	buffer.data = buffer.data[:n:n]
+
+	return buffer, nil
+}
+
+// decodeSecureJSON reads the whole of a decrypted JSON document into a secure buffer and parses it.
+func decodeSecureJSON(r io.Reader, v interface{}) error {
+	buffer, err := readSecureBuffer(r)
+	if err != nil {
+		return err
+	}
+	defer buffer.Destroy()
+
+	return json.Unmarshal(buffer.Bytes(), v)
+}
+
+// encodeSecureJSON writes a value as JSON, wiping the serialized copy once it has been written.
+func encodeSecureJSON(w io.Writer, v interface{}) error {
+	serialized, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	defer wipeBytes(serialized)
+
+	_, err = w.Write(serialized)
+	return err
+}
@@ -0,0 +1,18 @@
+//go:build !linux && !darwin && !windows
+// +build !linux,!darwin,!windows
+
+package services
+
+import (
+	"fmt"
+)
+
+// lockMemory reports that memory cannot be locked on this platform, so secure buffers are only wiped.
+func lockMemory(b []byte) error {
+	return fmt.Errorf("memory locking is not supported on this platform")
+}
+
+// unlockMemory does nothing, since memory is never locked on this platform.
+func unlockMemory(b []byte) error {
+	return nil
+}
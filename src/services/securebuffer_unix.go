@@ -0,0 +1,18 @@
+//go:build linux || darwin
+// +build linux darwin
+
+package services
+
+import (
+	"golang.org/x/sys/unix"
+)
+
+// lockMemory keeps memory from being swapped to disk.
+func lockMemory(b []byte) error {
+	return unix.Mlock(b)
+}
+
+// unlockMemory lets memory locked by lockMemory be swapped again.
+func unlockMemory(b []byte) error {
+	return unix.Munlock(b)
+}
@@ -0,0 +1,440 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	sessionTokenLength = 32
+	autoLockTimeoutSetting = "autoLockTimeout"
+	defaultAutoLockTimeoutSeconds = 15 * 60
+	notebookLockedEvent = "notebooklocked"
+	notebookLockedIdle = "idle"
+	notebookLockedRequested = "requested"
+	notebookLockedKeyChanged = "keyChanged"
+	notebookLockedDeleted = "deleted"
+)
+
+// ErrNotebookLocked is returned when a session is used after its notebook has been locked, whether on request, after
+// being left idle, or because the notebook's key has changed or the notebook has been deleted.
+var ErrNotebookLocked = errors.New("the notebook is locked, unlock it again to continue")
+
+// notebookSession represents a notebook that has been unlocked and can be accessed with a session token.
+type notebookSession struct {
+	notebookID  string
+	key         *notebookKeyMaterial
+	lastUsed    time.Time
+	idleTimeout time.Duration
+	lockTimer   *time.Timer
+}
+
+// NotebookLockedNotification is pushed to the UI when a notebook is locked. The notebook ID is left empty when every
+// notebook has been locked at once.
+type NotebookLockedNotification struct {
+	NotebookID string `json:"notebookId"`
+	Reason     string `json:"reason"`
+}
+
+// NotebookSession represents the details of an unlocked notebook's session.
+type NotebookSession struct {
+	Token       string `json:"token"`
+	NotebookID  string `json:"notebookId"`
+	IdleTimeout int    `json:"idleTimeout"`
+}
+
+// NotebookCredentials holds what a caller presents to access a notebook: its key, or the token of a session that unlocked it.
+type NotebookCredentials struct {
+	Key          string
+	SessionToken string
+}
+
+var (
+	sessions = make(map[string]*notebookSession)
+	sessionsMutex sync.Mutex
+)
+
+// newSessionToken generates a random, opaque session token.
+func newSessionToken() (string, error) {
+	token := make([]byte, sessionTokenLength)
+	_, err := io.ReadFull(rand.Reader, token)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(token), nil
+}
+
+/*
+autoLockTimeout gets how long a session can be left idle before its notebook is locked, from the autoLockTimeout
+setting in seconds. A timeout of zero leaves notebooks unlocked until they are locked on request.
+
+	returns: the idle timeout.
+*/
+func autoLockTimeout() time.Duration {
+	seconds := getSettingsCount(autoLockTimeoutSetting, defaultAutoLockTimeoutSeconds)
+
+	return time.Duration(seconds) * time.Second
+}
+
+// notifyNotebookLocked tells the UI that a notebook, or every notebook if the ID is empty, has been locked.
+func notifyNotebookLocked(notebookID string, reason string) {
+	dispatchWindowEvent(notebookLockedEvent, NotebookLockedNotification{
+		NotebookID: notebookID,
+		Reason: reason,
+	})
+}
+
+// wipeKeyMaterial destroys the secure buffers holding derived and data keys so they do not linger in memory.
+func wipeKeyMaterial(key *notebookKeyMaterial) {
+	key.key.Destroy()
+	key.dataKey.Destroy()
+}
+
+// wipeBytes overwrites a buffer with zeros once the secret it holds is no longer needed.
+func wipeBytes(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+// endSession removes a session and wipes its key. The sessions mutex must be held.
+func endSession(token string) {
+	if session, ok := sessions[token]; ok {
+		if session.lockTimer != nil {
+			session.lockTimer.Stop()
+		}
+		wipeKeyMaterial(session.key)
+		delete(sessions, token)
+	}
+}
+
+// touchSession marks a session as used and restarts its idle timer. The sessions mutex must be held.
+func touchSession(token string, session *notebookSession, idleTimeout time.Duration) {
+	session.lastUsed = time.Now()
+	session.idleTimeout = idleTimeout
+
+	if session.lockTimer != nil {
+		session.lockTimer.Stop()
+		session.lockTimer = nil
+	}
+	if idleTimeout > 0 {
+		session.lockTimer = time.AfterFunc(idleTimeout, func() {
+			expireSession(token)
+		})
+	}
+}
+
+// sessionExpired reports whether a session has been idle for longer than its timeout. The sessions mutex must be held.
+func sessionExpired(session *notebookSession) bool {
+	return session.idleTimeout > 0 && time.Since(session.lastUsed) >= session.idleTimeout
+}
+
+// expireSession locks a session's notebook once the session has been left idle for longer than its timeout, saving
+// the notebook's pending changes first if it was the last session for it.
+func expireSession(token string) {
+	sessionsMutex.Lock()
+	session, ok := sessions[token]
+	if !ok || !sessionExpired(session) {
+		sessionsMutex.Unlock()
+		return
+	}
+	notebookID := session.notebookID
+	sessionsMutex.Unlock()
+
+	unlock := lockNotebookForWrite(notebookID)
+	defer unlock()
+
+	// The session may have been used, or locked, while waiting for the notebook
+	sessionsMutex.Lock()
+	session, ok = sessions[token]
+	if !ok || !sessionExpired(session) || session.notebookID != notebookID {
+		sessionsMutex.Unlock()
+		return
+	}
+	sessionsMutex.Unlock()
+
+	err := endSessionAndRelease(token)
+	if err != nil {
+		log.Printf("Error occurred releasing notebook after its session expired (%s): %s", notebookFilepath(notebookID), err)
+	}
+
+	notifyNotebookLocked(notebookID, notebookLockedIdle)
+}
+
+// notebookUnlocked reports whether any session still has a notebook unlocked. The sessions mutex must be held.
+func notebookUnlocked(notebookID string) bool {
+	for _, session := range sessions {
+		if session.notebookID == notebookID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// endSessionAndRelease ends a session and, if it was the last one for its notebook, saves and drops the cached notebook.
+func endSessionAndRelease(token string) error {
+	sessionsMutex.Lock()
+	session, ok := sessions[token]
+	if !ok {
+		sessionsMutex.Unlock()
+		return fmt.Errorf("the session does not exist or has expired")
+	}
+	notebookID := session.notebookID
+	endSession(token)
+	stillUnlocked := notebookUnlocked(notebookID)
+	sessionsMutex.Unlock()
+
+	if !stillUnlocked {
+		return releaseCachedNotebook(notebookID)
+	}
+
+	return nil
+}
+
+/*
+getSession looks up an unexpired session, marks it as used, and returns the notebook ID and a copy of its key. A
+session that has outlived its timeout without its timer having locked it yet is locked here instead. The session's
+notebook lock must be held.
+
+	token:   the session token.
+
+	returns: the notebook ID and key material, or ErrNotebookLocked if the session has ended.
+*/
+func getSession(token string) (string, *notebookKeyMaterial, error) {
+	idleTimeout := autoLockTimeout()
+
+	sessionsMutex.Lock()
+	session, ok := sessions[token]
+	if !ok {
+		sessionsMutex.Unlock()
+		return "", nil, ErrNotebookLocked
+	}
+
+	if sessionExpired(session) {
+		notebookID := session.notebookID
+		sessionsMutex.Unlock()
+		err := endSessionAndRelease(token)
+		if err != nil {
+			log.Printf("Error occurred releasing notebook after its session expired (%s): %s", notebookFilepath(notebookID), err)
+		}
+		notifyNotebookLocked(notebookID, notebookLockedIdle)
+		return "", nil, ErrNotebookLocked
+	}
+
+	touchSession(token, session, idleTimeout)
+	defer sessionsMutex.Unlock()
+
+	return session.notebookID, copyKeyMaterial(session.key), nil
+}
+
+// lockNotebookSessions ends every session that has a specified notebook unlocked and drops it from the cache unsaved.
+func lockNotebookSessions(notebookID string, reason string) {
+	sessionsMutex.Lock()
+	for token, session := range sessions {
+		if session.notebookID == notebookID {
+			endSession(token)
+		}
+	}
+	sessionsMutex.Unlock()
+
+	evictCachedNotebook(notebookID)
+	notifyNotebookLocked(notebookID, reason)
+}
+
+// lockKeySlotSessions ends every session that unlocked a notebook with a revoked key slot, and drops the notebook
+// from the cache unsaved, since the cached copy still has the slot.
+func lockKeySlotSessions(notebookID string, slotID string) {
+	sessionsMutex.Lock()
+	for token, session := range sessions {
+		if session.notebookID == notebookID && session.key.slotID == slotID {
+			endSession(token)
+		}
+	}
+	sessionsMutex.Unlock()
+
+	evictCachedNotebook(notebookID)
+	notifyNotebookLocked(notebookID, notebookLockedKeyChanged)
+}
+
+// renameNotebookSessions points every session for a notebook at the notebook's new ID.
+func renameNotebookSessions(oldNotebookID string, newNotebookID string) {
+	sessionsMutex.Lock()
+	defer sessionsMutex.Unlock()
+
+	for _, session := range sessions {
+		if session.notebookID == oldNotebookID {
+			session.notebookID = newNotebookID
+		}
+	}
+}
+
+// sessionNotebookKey looks up the notebook ID and key material held by a session, checking it belongs to a notebook.
+func sessionNotebookKey(notebookName string, sessionToken string) (string, *notebookKeyMaterial, error) {
+	notebookID, key, err := getSession(sessionToken)
+	if err != nil {
+		return "", nil, err
+	}
+
+	if notebookID != cleanFileName(notebookName) {
+		wipeKeyMaterial(key)
+		return "", nil, fmt.Errorf("the session does not belong to the specified notebook")
+	}
+
+	return notebookID, key, nil
+}
+
+// readNotebookWithKey reads a notebook, upgrading it first if needed, and derives its key material from a notebook key.
+func readNotebookWithKey(notebookName string, key string) (*EncryptedNotebook, *notebookKeyMaterial, error) {
+	encryptedNotebook, err := readNotebook(notebookName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if notebookNeedsUpgrade(encryptedNotebook) {
+		_, keyMaterial, err := openNotebook(notebookName, key)
+		if err != nil {
+			return nil, nil, err
+		}
+		wipeKeyMaterial(keyMaterial)
+
+		encryptedNotebook, err = readNotebook(notebookName)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	finishAttempt, err := beginUnlockAttempt(encryptedNotebook.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyMaterial, err := notebookKeyMaterialFor(encryptedNotebook, key)
+	finishAttempt(err)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return encryptedNotebook, keyMaterial, nil
+}
+
+/*
+UnlockNotebook derives a notebook's key once and starts a session that can be used in place of the key.
+
+	name:    the notebook's name.
+	key:     the key to decrypt the notebook.
+
+	returns: the new session, or an error.
+*/
+func UnlockNotebook(name string, key string) (*NotebookSession, error) {
+	unlock := lockNotebookForWrite(name)
+	defer unlock()
+
+	notebook, keyMaterial, err := openNotebook(name, key)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := newSessionToken()
+	if err != nil {
+		wipeKeyMaterial(keyMaterial)
+		log.Printf("Error occurred generating session token: %s", err)
+		return nil, fmt.Errorf("an unexpected error occurred while unlocking the notebook, check the logs for more details")
+	}
+
+	cacheNotebook(notebook, keyMaterial)
+	rememberNotebookKey(notebook.ID, key, keyMaterial)
+
+	idleTimeout := autoLockTimeout()
+
+	sessionsMutex.Lock()
+	session := &notebookSession{
+		notebookID: notebook.ID,
+		key: keyMaterial,
+	}
+	touchSession(token, session, idleTimeout)
+	sessions[token] = session
+	sessionsMutex.Unlock()
+
+	return &NotebookSession{
+		Token: token,
+		NotebookID: notebook.ID,
+		IdleTimeout: int(idleTimeout / time.Second),
+	}, nil
+}
+
+/*
+LockNotebook ends a session and wipes the notebook key it held. Once no sessions remain for the notebook, its pending
+changes are saved and its decrypted content is dropped from memory.
+
+	sessionToken: the session token.
+
+	returns:      an error, if one occurs.
+*/
+func LockNotebook(sessionToken string) error {
+	sessionsMutex.Lock()
+	session, ok := sessions[sessionToken]
+	if !ok {
+		sessionsMutex.Unlock()
+		return fmt.Errorf("the session does not exist or has expired")
+	}
+	notebookID := session.notebookID
+	sessionsMutex.Unlock()
+
+	unlock := lockNotebookForWrite(notebookID)
+	defer unlock()
+
+	// The notebook is locked even if its pending changes could not be saved
+	err := endSessionAndRelease(sessionToken)
+	notifyNotebookLocked(notebookID, notebookLockedRequested)
+
+	return err
+}
+
+/*
+LockAllNotebooks ends every session, saving each unlocked notebook's pending changes and dropping its decrypted content
+and keys from memory.
+
+	returns: an error, if any notebook could not be saved. Every notebook is locked regardless.
+*/
+func LockAllNotebooks() error {
+	sessionsMutex.Lock()
+	notebookIDs := make(map[string]bool)
+	for _, session := range sessions {
+		notebookIDs[session.notebookID] = true
+	}
+	sessionsMutex.Unlock()
+
+	var lockErr error
+
+	for notebookID := range notebookIDs {
+		unlock := lockNotebookForWrite(notebookID)
+
+		sessionsMutex.Lock()
+		for token, session := range sessions {
+			if session.notebookID == notebookID {
+				endSession(token)
+			}
+		}
+		sessionsMutex.Unlock()
+
+		err := releaseCachedNotebook(notebookID)
+		if err != nil {
+			log.Printf("Error occurred saving notebook while locking all notebooks (%s): %s", notebookFilepath(notebookID), err)
+			lockErr = fmt.Errorf("an unexpected error occurred while saving unlocked notebooks, check the logs for more details")
+		}
+
+		unlock()
+	}
+
+	notifyNotebookLocked("", notebookLockedRequested)
+
+	return lockErr
+}
@@ -0,0 +1,72 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"testing"
+)
+
+// TestLockNotebookWhenSaveFails checks that locking drops a notebook from memory even when its pending changes cannot
+// be saved, and reports the failure.
+func TestLockNotebookWhenSaveFails(t *testing.T) {
+	tests := []struct {
+		name string
+		lock func(sessionToken string) error
+	}{
+		{"lock notebook", LockNotebook},
+		{"lock all notebooks", func(sessionToken string) error {
+			return LockAllNotebooks()
+		}},
+		{"flush notebooks", func(sessionToken string) error {
+			return FlushNotebooks()
+		}},
+	}
+
+	for i, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			notebookName := fmt.Sprintf("Lock Failure Test %d", i)
+			notebookKey := "lock-failure-test-key"
+
+			_, err := CreateNotebook(notebookName, "", notebookKey, false)
+			if err != nil {
+				t.Fatalf("creating notebook: %s", err)
+			}
+			session, err := UnlockNotebook(notebookName, notebookKey)
+			if err != nil {
+				t.Fatalf("unlocking notebook: %s", err)
+			}
+			credentials := NotebookCredentials{SessionToken: session.Token}
+
+			_, err = CreateNotebookEntry(notebookName, credentials, "unsaved", "")
+			if err != nil {
+				t.Fatalf("creating entry: %s", err)
+			}
+
+			// A directory that is not empty cannot be renamed over, so the delayed save fails
+			notebookID := cleanFileName(notebookName)
+			filepath := notebookFilepath(notebookID)
+			err = os.Remove(filepath)
+			if err == nil {
+				err = os.MkdirAll(filepath + "/blocked", 0700)
+			}
+			if err != nil {
+				t.Fatalf("blocking notebook file: %s", err)
+			}
+			t.Cleanup(func() {
+				os.RemoveAll(filepath)
+			})
+
+			err = test.lock(session.Token)
+			if err == nil {
+				t.Errorf("expected the failed save to be reported")
+			}
+
+			notebookCacheMutex.Lock()
+			_, cached := notebookCache[notebookID]
+			notebookCacheMutex.Unlock()
+			if cached {
+				t.Errorf("expected the notebook to be dropped from memory")
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"io/fs"
 	"log"
 	"os"
+	"strconv"
 
 	util "eno/src/util"
 )
@@ -60,6 +61,41 @@ func writeSettings(settings map[string]string) error {
 	return nil
 }
 
+/*
+getSettingsCount gets an option from the settings that holds a count, such as a number of days or attempts. Options
+that are unset, cannot be read, or are not a whole number of at least zero fall back to a default.
+
+	key:          the name of the option.
+	defaultValue: the value used when the option is unset or invalid.
+
+	returns:      the option's value.
+*/
+func getSettingsCount(key string, defaultValue int) int {
+	settings, err := readSettings()
+	if err != nil {
+		return defaultValue
+	}
+
+	return settingsCount(settings, key, defaultValue)
+}
+
+// settingsCount gets an option that holds a count from settings that have already been read, so several options can
+// be got from one read of the settings file.
+func settingsCount(settings map[string]string, key string, defaultValue int) int {
+	value := settings[key]
+	if value == "" {
+		return defaultValue
+	}
+
+	count, err := strconv.Atoi(value)
+	if err != nil || count < 0 {
+		log.Printf("Invalid %s setting '%s', using the default of %d", key, value, defaultValue)
+		return defaultValue
+	}
+
+	return count
+}
+
 /*
 GetSettings gets all settings.
 
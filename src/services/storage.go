@@ -0,0 +1,338 @@
+package services
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+const (
+	tempFileExt = ".tmp"
+	notebookRenameJournalExt = ".rename"
+)
+
+// notebookRenameJournal records a notebook file that is being moved to a new ID, so that a move interrupted by a
+// crash can be finished or rolled back the next time the app starts.
+type notebookRenameJournal struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// syncDir flushes a directory's entries to disk so that files created, renamed or removed in it survive a crash.
+func syncDir(dir string) error {
+	// Directories cannot be opened for syncing on Windows, where renames are already durable once they return
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+/*
+WriteFileAtomic replaces a file's contents without ever leaving it partly written. The data is written to a temporary
+file in the same directory and synced to disk, then renamed over the destination.
+
+	path:    the file's path.
+	data:    the file's new contents.
+
+	returns: an error, if one occurs.
+*/
+func WriteFileAtomic(path string, data []byte) error {
+	return writeFileAtomicFunc(path, func(w io.Writer) error {
+		_, err := w.Write(data)
+		return err
+	})
+}
+
+/*
+writeFileAtomicFunc replaces a file's contents without ever leaving it partly written, like WriteFileAtomic, but lets
+the contents be produced a piece at a time rather than held in memory all at once.
+
+	path:    the file's path.
+	write:   writes the file's new contents.
+
+	returns: an error, if one occurs.
+*/
+func writeFileAtomicFunc(path string, write func(w io.Writer) error) error {
+	dir := filepath.Dir(path)
+
+	tempFile, err := os.CreateTemp(dir, "."+filepath.Base(path)+".*"+tempFileExt)
+	if err != nil {
+		return err
+	}
+	tempPath := tempFile.Name()
+
+	buffered := bufio.NewWriter(tempFile)
+	err = write(buffered)
+	if err == nil {
+		err = buffered.Flush()
+	}
+	if err == nil {
+		err = tempFile.Sync()
+	}
+	closeErr := tempFile.Close()
+	if err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	err = os.Rename(tempPath, path)
+	if err != nil {
+		os.Remove(tempPath)
+		return err
+	}
+
+	return syncDir(dir)
+}
+
+/*
+moveNotebookDir moves one of the directories kept next to a notebook's file, for its attachments or entry files, along
+with the notebook, if the notebook has one. A directory already at the new path, such as one left by a move that
+stopped part way, is merged with rather than replaced.
+
+	dir:     the directory's current path.
+	newDir:  the directory's new path.
+
+	returns: an error, if one occurs.
+*/
+func moveNotebookDir(dir string, newDir string) error {
+	if _, err := os.Stat(dir); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	err := os.Rename(dir, newDir)
+	if err == nil {
+		return syncDir(filepath.Dir(newDir))
+	}
+	if _, statErr := os.Stat(newDir); statErr != nil {
+		return err
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		err = os.Rename(fmt.Sprintf("%s/%s", dir, file.Name()), fmt.Sprintf("%s/%s", newDir, file.Name()))
+		if err != nil {
+			return err
+		}
+	}
+
+	err = syncDir(newDir)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(dir)
+	if err != nil {
+		return err
+	}
+
+	return syncDir(filepath.Dir(dir))
+}
+
+// moveNotebookDirs moves the directories kept next to a notebook's file from one path to another.
+func moveNotebookDirs(attachmentsDir string, newAttachmentsDir string, entriesDir string, newEntriesDir string) error {
+	err := moveNotebookDir(entriesDir, newEntriesDir)
+	if err != nil {
+		return err
+	}
+
+	return moveNotebookDir(attachmentsDir, newAttachmentsDir)
+}
+
+// notebookRenameJournalPath gets the path to the journal for moving a notebook's file away from an ID.
+func notebookRenameJournalPath(id string) string {
+	return fmt.Sprintf("%s/%s%s%s", notebooksDir, id, notebookFileExt, notebookRenameJournalExt)
+}
+
+/*
+moveNotebook writes a notebook under a new ID and removes its file under the old one. If the app stops part way,
+recoverNotebookFiles either finishes the move or rolls it back, so the notebook is never left in both files or neither.
+
+	notebook: the encrypted notebook, with its new ID.
+	oldID:    the ID of the notebook's current file.
+
+	returns:  an error, if one occurs.
+*/
+func moveNotebook(notebook *EncryptedNotebook, oldID string) error {
+	oldFilepath := notebookFilepath(oldID)
+	newFilepath := notebookFilepath(notebook.ID)
+	journalPath := notebookRenameJournalPath(oldID)
+
+	journalJson, err := json.Marshal(notebookRenameJournal{
+		From: oldID,
+		To: notebook.ID,
+	})
+	if err != nil {
+		log.Printf("Error occurred stringifying notebook rename journal JSON (%s): %s", journalPath, err)
+		return fmt.Errorf("an unexpected error occurred while renaming the notebook, check the logs for more details")
+	}
+
+	err = WriteFileAtomic(journalPath, journalJson)
+	if err != nil {
+		log.Printf("Error occurred writing notebook rename journal (%s): %s", journalPath, err)
+		return fmt.Errorf("an unexpected error occurred while renaming the notebook, check the logs for more details")
+	}
+
+	// Entry files are not tied to the notebook's ID, so changed ones are written next to the existing ones and moved
+	// with them, rather than starting a directory under the new ID that the existing one could not be moved onto
+	err = writeNotebookWithEntriesIn(notebook, oldID)
+	if err != nil {
+		os.Remove(journalPath)
+		return err
+	}
+
+	err = os.Remove(oldFilepath)
+	if err != nil {
+		log.Printf("Error occurred deleting old notebook file (%s): %s", oldFilepath, err)
+
+		rollbackErr := os.Remove(newFilepath)
+		if rollbackErr != nil {
+			// Leave the journal in place so the move is finished the next time the app starts
+			log.Printf("Error occurred rolling back renamed notebook file (%s): %s", newFilepath, rollbackErr)
+		} else {
+			os.Remove(journalPath)
+		}
+
+		return fmt.Errorf("an unexpected error occurred while renaming the notebook, check the logs for more details")
+	}
+
+	err = syncDir(notebooksDir)
+	if err != nil {
+		log.Printf("Error occurred syncing notebooks directory after renaming (%s): %s", newFilepath, err)
+	}
+
+	err = moveNotebookDirs(notebookAttachmentsDir(oldID), notebookAttachmentsDir(notebook.ID), notebookEntriesDir(oldID), notebookEntriesDir(notebook.ID))
+	if err != nil {
+		// Leave the journal in place so the entry files and attachments are moved the next time the app starts
+		log.Printf("Error occurred moving renamed notebook's entry files and attachments (%s): %s", newFilepath, err)
+		return fmt.Errorf("an unexpected error occurred while renaming the notebook, check the logs for more details")
+	}
+
+	err = os.Remove(journalPath)
+	if err != nil {
+		log.Printf("Error occurred deleting notebook rename journal (%s): %s", journalPath, err)
+	}
+
+	return nil
+}
+
+// recoverNotebookRename finishes or rolls back a notebook move that was interrupted, then removes its journal.
+func recoverNotebookRename(journalPath string) {
+	journalJson, err := os.ReadFile(journalPath)
+	if err != nil {
+		log.Printf("Error occurred reading notebook rename journal (%s): %s", journalPath, err)
+		return
+	}
+
+	var journal notebookRenameJournal
+	err = json.Unmarshal(journalJson, &journal)
+	if err != nil || journal.From == "" || journal.To == "" {
+		log.Printf("Discarding unreadable notebook rename journal (%s): %v", journalPath, err)
+		os.Remove(journalPath)
+		return
+	}
+
+	oldFilepath := notebookFilepath(journal.From)
+	newFilepath := notebookFilepath(journal.To)
+
+	// The new file only appears once it has been completely written, so if it exists the move can be finished,
+	// otherwise the old file is still the only copy and is kept
+	if _, err := os.Stat(newFilepath); err == nil {
+		err = os.Remove(oldFilepath)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Error occurred finishing interrupted notebook rename (%s): %s", oldFilepath, err)
+			return
+		}
+
+		err = moveNotebookDirs(notebookAttachmentsDir(journal.From), notebookAttachmentsDir(journal.To), notebookEntriesDir(journal.From), notebookEntriesDir(journal.To))
+		if err != nil {
+			log.Printf("Error occurred moving entry files and attachments while finishing interrupted notebook rename (%s): %s", oldFilepath, err)
+			return
+		}
+		log.Printf("Finished interrupted notebook rename (%s -> %s)", oldFilepath, newFilepath)
+	} else {
+		log.Printf("Rolled back interrupted notebook rename (%s -> %s)", oldFilepath, newFilepath)
+	}
+
+	err = syncDir(notebooksDir)
+	if err != nil {
+		log.Printf("Error occurred syncing notebooks directory after recovering a rename: %s", err)
+	}
+
+	os.Remove(journalPath)
+}
+
+// recoverNotebookFiles cleans up after writes and renames that were interrupted the last time the app ran.
+func recoverNotebookFiles() {
+	files, err := os.ReadDir(notebooksDir)
+	if err != nil {
+		log.Printf("Error occurred checking notebooks directory for interrupted writes: %s", err)
+		return
+	}
+
+	for _, file := range files {
+		if file.IsDir() {
+			if strings.HasSuffix(file.Name(), notebookAttachmentsExt) || strings.HasSuffix(file.Name(), notebookEntriesExt) {
+				removeTempFiles(fmt.Sprintf("%s/%s", notebooksDir, file.Name()))
+			}
+			continue
+		}
+
+		path := fmt.Sprintf("%s/%s", notebooksDir, file.Name())
+
+		switch {
+		case strings.HasSuffix(file.Name(), notebookRenameJournalExt):
+			recoverNotebookRename(path)
+		case isTempFile(file.Name()):
+			err = os.Remove(path)
+			if err != nil {
+				log.Printf("Error occurred deleting leftover temporary notebook file (%s): %s", path, err)
+			}
+		}
+	}
+}
+
+// isTempFile reports whether a file name is one given to temporary files by WriteFileAtomic.
+func isTempFile(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, tempFileExt)
+}
+
+// removeTempFiles deletes temporary files left in a directory by writes that were interrupted.
+func removeTempFiles(dir string) {
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		log.Printf("Error occurred checking directory for interrupted writes (%s): %s", dir, err)
+		return
+	}
+
+	for _, file := range files {
+		if !file.IsDir() && isTempFile(file.Name()) {
+			path := fmt.Sprintf("%s/%s", dir, file.Name())
+			err = os.Remove(path)
+			if err != nil {
+				log.Printf("Error occurred deleting leftover temporary file (%s): %s", path, err)
+			}
+		}
+	}
+}
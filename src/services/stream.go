@@ -0,0 +1,307 @@
+package services
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const (
+	streamMagic = "ENOS"
+	streamVersion = 1
+	streamSaltLength = 16
+	streamHeaderLength = len(streamMagic) + 1 + streamSaltLength
+	streamSegmentSize = 64 * 1024
+	streamKeyLabel = "eno stream key"
+	streamLastSegment = 1
+)
+
+// streamCipher derives a stream's subkey from its salt and creates the AEAD cipher used for its segments. Every stream
+// is sealed under its own subkey, so segment nonces can simply count up from zero.
+func streamCipher(key []byte, salt []byte) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(streamKeyLabel))
+	mac.Write(salt)
+	subkey := mac.Sum(nil)
+	defer wipeBytes(subkey)
+
+	block, err := aes.NewCipher(subkey)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// streamNonce builds the nonce for a segment from its position in the stream and whether it is the final segment.
+// Marking the final segment means segments cannot be reordered or dropped, and a stream cannot be truncated at a
+// segment boundary, without failing to decrypt.
+func streamNonce(nonce []byte, counter uint64, last bool) []byte {
+	for i := range nonce {
+		nonce[i] = 0
+	}
+
+	binary.BigEndian.PutUint64(nonce[len(nonce) - 9:len(nonce) - 1], counter)
+	if last {
+		nonce[len(nonce) - 1] = streamLastSegment
+	}
+
+	return nonce
+}
+
+/*
+streamWriter encrypts everything written to it into a stream container, which follows the STREAM construction by
+sealing each segment of streamSegmentSize bytes separately, so data of any size is handled a segment at a time. Every
+segment but the final one is full, and the final one may be empty.
+
+	magic (4) | version (1) | salt (16) | segment 0 | segment 1 | ... | final segment
+*/
+type streamWriter struct {
+	w              io.Writer
+	aead           cipher.AEAD
+	additionalData []byte
+	nonce          []byte
+	buffer         *secureBuffer
+	plaintext      []byte
+	ciphertext     []byte
+	counter        uint64
+	closed         bool
+}
+
+/*
+newStreamWriter starts a stream container, writing its header straight away. Close must be called once everything has
+been written, to seal the final segment, and Destroy must be called if the stream is abandoned before then.
+
+	w:              where the container is written.
+	key:            the key the stream's subkey is derived from.
+	additionalData: data to authenticate along with every segment, which must be the same when the stream is read.
+
+	returns:        the stream writer, or an error.
+*/
+func newStreamWriter(w io.Writer, key []byte, additionalData []byte) (*streamWriter, error) {
+	salt := make([]byte, streamSaltLength)
+	_, err := io.ReadFull(rand.Reader, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := streamCipher(key, salt)
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, streamHeaderLength)
+	header = append(header, streamMagic...)
+	header = append(header, streamVersion)
+	header = append(header, salt...)
+
+	_, err = w.Write(header)
+	if err != nil {
+		return nil, err
+	}
+
+	buffer := newSecureBuffer(streamSegmentSize)
+
+	return &streamWriter{
+		w: w,
+		aead: aead,
+		additionalData: additionalData,
+		nonce: make([]byte, aead.NonceSize()),
+		buffer: buffer,
+		plaintext: buffer.Bytes()[:0],
+		ciphertext: make([]byte, 0, streamSegmentSize + aead.Overhead()),
+	}, nil
+}
+
+// sealSegment encrypts and writes the buffered plaintext as the next segment.
+func (s *streamWriter) sealSegment(last bool) error {
+	if !last && s.counter == ^uint64(0) {
+		return fmt.Errorf("stream is too long")
+	}
+
+	s.ciphertext = s.aead.Seal(s.ciphertext[:0], streamNonce(s.nonce, s.counter, last), s.plaintext, s.additionalData)
+	wipeBytes(s.plaintext)
+	s.plaintext = s.plaintext[:0]
+	s.counter++
+
+	_, err := s.w.Write(s.ciphertext)
+	return err
+}
+
+// Write buffers plaintext, sealing a segment whenever a full one is followed by more data.
+func (s *streamWriter) Write(p []byte) (int, error) {
+	if s.closed {
+		return 0, fmt.Errorf("stream is already closed")
+	}
+
+	n := 0
+	for len(p) > 0 {
+		// A full segment is only sealed once more data arrives, since until then it might be the final one
+		if len(s.plaintext) == streamSegmentSize {
+			err := s.sealSegment(false)
+			if err != nil {
+				return n, err
+			}
+		}
+
+		copied := copy(s.plaintext[len(s.plaintext):streamSegmentSize], p)
+		s.plaintext = s.plaintext[:len(s.plaintext) + copied]
+		p = p[copied:]
+		n += copied
+	}
+
+	return n, nil
+}
+
+// Close seals whatever is left as the final segment and wipes the plaintext buffer. It does not close the underlying
+// writer.
+func (s *streamWriter) Close() error {
+	if s.closed {
+		return nil
+	}
+	defer s.Destroy()
+
+	return s.sealSegment(true)
+}
+
+// Destroy wipes the plaintext buffer without sealing the final segment, leaving the stream incomplete.
+func (s *streamWriter) Destroy() {
+	s.closed = true
+	s.plaintext = nil
+	s.buffer.Destroy()
+}
+
+// streamReader decrypts a stream container, only ever returning plaintext from segments that have been authenticated.
+type streamReader struct {
+	r              io.Reader
+	aead           cipher.AEAD
+	additionalData []byte
+	nonce          []byte
+	ciphertext     []byte
+	buffer         *secureBuffer
+	plaintext      []byte
+	unread         []byte
+	counter        uint64
+	done           bool
+}
+
+/*
+newStreamReader reads a stream container's header, ready for its segments to be decrypted as they are read. Destroy
+must be called once the stream has been read.
+
+	r:              where the container is read from.
+	key:            the key the stream's subkey is derived from.
+	additionalData: the data that was authenticated along with every segment when the stream was written.
+
+	returns:        the stream reader, or an error.
+*/
+func newStreamReader(r io.Reader, key []byte, additionalData []byte) (*streamReader, error) {
+	header := make([]byte, streamHeaderLength)
+	_, err := io.ReadFull(r, header)
+	if err != nil {
+		return nil, fmt.Errorf("stream header is incomplete: %w", err)
+	}
+
+	if string(header[:len(streamMagic)]) != streamMagic {
+		return nil, fmt.Errorf("data is not a stream container")
+	}
+	if header[len(streamMagic)] != streamVersion {
+		return nil, fmt.Errorf("unsupported stream container version %d", header[len(streamMagic)])
+	}
+
+	aead, err := streamCipher(key, header[len(streamMagic) + 1:])
+	if err != nil {
+		return nil, err
+	}
+
+	buffer := newSecureBuffer(streamSegmentSize)
+
+	// One byte more than a full segment is read at a time, which is how a full segment is told apart from the final one
+	return &streamReader{
+		r: r,
+		aead: aead,
+		additionalData: additionalData,
+		nonce: make([]byte, aead.NonceSize()),
+		ciphertext: make([]byte, 0, streamSegmentSize + aead.Overhead() + 1),
+		buffer: buffer,
+		plaintext: buffer.Bytes()[:0],
+	}, nil
+}
+
+// openSegment reads and decrypts the next segment.
+func (s *streamReader) openSegment() error {
+	segmentLength := streamSegmentSize + s.aead.Overhead()
+
+	carried := len(s.ciphertext)
+	s.ciphertext = s.ciphertext[:segmentLength + 1]
+	n, err := io.ReadFull(s.r, s.ciphertext[carried:])
+	n += carried
+
+	last := false
+	switch {
+	case err == nil:
+	case errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF):
+		last = true
+	default:
+		return err
+	}
+
+	segment := s.ciphertext[:n]
+	if !last {
+		segment = s.ciphertext[:segmentLength]
+	}
+
+	wipeBytes(s.plaintext)
+	s.plaintext, err = s.aead.Open(s.plaintext[:0], streamNonce(s.nonce, s.counter, last), segment, s.additionalData)
+	if err != nil {
+		return fmt.Errorf("stream segment %d failed to decrypt, it has been tampered with or truncated", s.counter)
+	}
+	s.unread = s.plaintext
+	s.counter++
+
+	if last {
+		s.done = true
+		s.ciphertext = s.ciphertext[:0]
+	} else {
+		s.ciphertext[0] = s.ciphertext[segmentLength]
+		s.ciphertext = s.ciphertext[:1]
+	}
+
+	return nil
+}
+
+// Read returns decrypted plaintext, reaching io.EOF only once the final segment has been authenticated.
+func (s *streamReader) Read(p []byte) (int, error) {
+	if s.buffer.Bytes() == nil {
+		return 0, fmt.Errorf("stream has already been destroyed")
+	}
+
+	for len(s.unread) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+
+		err := s.openSegment()
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, s.unread)
+	s.unread = s.unread[n:]
+
+	return n, nil
+}
+
+// Destroy wipes the plaintext buffer, after which nothing more can be read from the stream.
+func (s *streamReader) Destroy() {
+	s.plaintext = nil
+	s.unread = nil
+	s.buffer.Destroy()
+}
@@ -0,0 +1,300 @@
+package services
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	tagMinLength = 1
+	tagMaxLength = 64
+	entryMaxTags = 32
+)
+
+// NotebookTag represents a tag used in a notebook, along with how many entries it is on.
+type NotebookTag struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+// cleanTags trims and deduplicates tags, making sure each one is a valid length.
+func cleanTags(tags []string) ([]string, error) {
+	cleaned := make([]string, 0, len(tags))
+	seen := make(map[string]bool)
+
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if len(tag) < tagMinLength || len(tag) > tagMaxLength {
+			return nil, fmt.Errorf("tags must be between %d and %d characters in length", tagMinLength, tagMaxLength)
+		}
+
+		if !seen[tag] {
+			seen[tag] = true
+			cleaned = append(cleaned, tag)
+		}
+	}
+
+	return cleaned, nil
+}
+
+// entryHasTag reports whether an entry is tagged with a specified tag.
+func entryHasTag(entry *NotebookEntry, tag string) bool {
+	for _, entryTag := range entry.Tags {
+		if entryTag == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+// entryHasTags reports whether an entry is tagged with every one of the specified tags.
+func entryHasTags(entry *NotebookEntry, tags []string) bool {
+	for _, tag := range tags {
+		if !entryHasTag(entry, tag) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// filterEntriesByTags removes entries that are not tagged with every one of the specified tags.
+func filterEntriesByTags(entries map[string]*NotebookEntry, tags []string) {
+	if len(tags) == 0 {
+		return
+	}
+
+	for entryID, entry := range entries {
+		if !entryHasTags(entry, tags) {
+			delete(entries, entryID)
+		}
+	}
+}
+
+// setEntryTags replaces an entry's tags, keeping them sorted.
+func setEntryTags(entry *NotebookEntry, tags []string) error {
+	if len(tags) > entryMaxTags {
+		return fmt.Errorf("entries cannot have more than %d tags", entryMaxTags)
+	}
+
+	sort.Strings(tags)
+	entry.Tags = tags
+	if len(entry.Tags) == 0 {
+		entry.Tags = nil
+	}
+
+	return nil
+}
+
+/*
+AddNotebookEntryTags tags an entry in a notebook.
+
+	notebookName:     the notebook's name.
+	credentials:      the notebook key or session token used to encrypt/decrypt the notebook.
+	entryID:          the ID of the entry.
+	tags:             the tags to add. Tags the entry already has are ignored.
+	expectedRevision: the entry revision the caller last read, or nil to skip the check.
+
+	returns:          the updated entry without its content, which is left undecrypted, or an error.
+*/
+func AddNotebookEntryTags(notebookName string, credentials NotebookCredentials, entryID string, tags []string, expectedRevision *int) (*NotebookEntry, error) {
+	tags, err := cleanTags(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry *NotebookEntry
+
+	err = updateNotebook(notebookName, credentials, func(notebook *DecryptedNotebook) error {
+		var ok bool
+		if entry, ok = notebook.Content.Entries[entryID]; !ok {
+			return fmt.Errorf("an entry with the specified ID does not exist in this notebook")
+		}
+
+		err := checkUnloadedEntryRevision(notebook, entry, expectedRevision)
+		if err != nil {
+			return err
+		}
+
+		newTags := append([]string(nil), entry.Tags...)
+		for _, tag := range tags {
+			if !entryHasTag(entry, tag) {
+				newTags = append(newTags, tag)
+			}
+		}
+
+		err = setEntryTags(entry, newTags)
+		if err != nil {
+			return err
+		}
+		updateNotebookEntryEditTime(notebook, entryID)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entryWithoutContent(entry), nil
+}
+
+/*
+RemoveNotebookEntryTags removes tags from an entry in a notebook.
+
+	notebookName:     the notebook's name.
+	credentials:      the notebook key or session token used to encrypt/decrypt the notebook.
+	entryID:          the ID of the entry.
+	tags:             the tags to remove. Tags the entry does not have are ignored.
+	expectedRevision: the entry revision the caller last read, or nil to skip the check.
+
+	returns:          the updated entry without its content, which is left undecrypted, or an error.
+*/
+func RemoveNotebookEntryTags(notebookName string, credentials NotebookCredentials, entryID string, tags []string, expectedRevision *int) (*NotebookEntry, error) {
+	tags, err := cleanTags(tags)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry *NotebookEntry
+
+	err = updateNotebook(notebookName, credentials, func(notebook *DecryptedNotebook) error {
+		var ok bool
+		if entry, ok = notebook.Content.Entries[entryID]; !ok {
+			return fmt.Errorf("an entry with the specified ID does not exist in this notebook")
+		}
+
+		err := checkUnloadedEntryRevision(notebook, entry, expectedRevision)
+		if err != nil {
+			return err
+		}
+
+		removed := make(map[string]bool)
+		for _, tag := range tags {
+			removed[tag] = true
+		}
+
+		newTags := make([]string, 0, len(entry.Tags))
+		for _, tag := range entry.Tags {
+			if !removed[tag] {
+				newTags = append(newTags, tag)
+			}
+		}
+
+		err = setEntryTags(entry, newTags)
+		if err != nil {
+			return err
+		}
+		updateNotebookEntryEditTime(notebook, entryID)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entryWithoutContent(entry), nil
+}
+
+/*
+ListNotebookTags lists every tag used in a notebook.
+
+	notebookName: the notebook's name.
+	credentials:  the notebook key or session token used to encrypt/decrypt the notebook.
+
+	returns:      the tags in alphabetical order with the number of entries using each, or an error.
+*/
+func ListNotebookTags(notebookName string, credentials NotebookCredentials) ([]*NotebookTag, error) {
+	counts := make(map[string]int)
+
+	err := viewNotebook(notebookName, credentials, func(notebook *DecryptedNotebook) error {
+		for _, entry := range notebook.Content.Entries {
+			for _, tag := range entry.Tags {
+				counts[tag]++
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	tags := make([]*NotebookTag, 0, len(counts))
+	for tag, count := range counts {
+		tags = append(tags, &NotebookTag{
+			Name: tag,
+			Count: count,
+		})
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		return tags[i].Name < tags[j].Name
+	})
+
+	return tags, nil
+}
+
+/*
+SetNotebookTagName renames a tag on every entry in a notebook. Renaming a tag to one that is already in use merges
+the two tags.
+
+	notebookName: the notebook's name.
+	credentials:  the notebook key or session token used to encrypt/decrypt the notebook.
+	tag:          the tag's current name.
+	newTag:       the tag's new name.
+
+	returns:      the renamed tag with the number of entries now using it, or an error.
+*/
+func SetNotebookTagName(notebookName string, credentials NotebookCredentials, tag string, newTag string) (*NotebookTag, error) {
+	tags, err := cleanTags([]string{tag, newTag})
+	if err != nil {
+		return nil, err
+	}
+	tag = tags[0]
+	newTag = tags[len(tags) - 1]
+
+	renamedTag := &NotebookTag{
+		Name: newTag,
+	}
+
+	err = updateNotebook(notebookName, credentials, func(notebook *DecryptedNotebook) error {
+		renamed := false
+
+		for _, entry := range notebook.Content.Entries {
+			if entryHasTag(entry, tag) {
+				newTags := make([]string, 0, len(entry.Tags))
+				for _, entryTag := range entry.Tags {
+					if entryTag != tag && entryTag != newTag {
+						newTags = append(newTags, entryTag)
+					}
+				}
+				newTags = append(newTags, newTag)
+
+				err := setEntryTags(entry, newTags)
+				if err != nil {
+					return err
+				}
+				renamed = true
+			}
+
+			if entryHasTag(entry, newTag) {
+				renamedTag.Count++
+			}
+		}
+
+		if !renamed {
+			return fmt.Errorf("the specified tag is not used in this notebook")
+		}
+
+		updateNotebookEditTime(notebook)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return renamedTag, nil
+}
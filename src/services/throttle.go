@@ -0,0 +1,206 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"math"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	unlockAttemptsFile = "unlock-attempts.json"
+	unlockFreeAttemptsSetting = "unlockFreeAttempts"
+	unlockBaseDelaySetting = "unlockBaseDelay"
+	unlockMaxDelaySetting = "unlockMaxDelay"
+	defaultUnlockFreeAttempts = 5
+	defaultUnlockBaseDelaySeconds = 1
+	defaultUnlockMaxDelaySeconds = 60 * 60
+)
+
+var errIncorrectNotebookKey = errors.New("incorrect notebook key")
+
+// TooManyAttemptsError is returned when a notebook key is tried again before the delay after failed attempts is over.
+type TooManyAttemptsError struct {
+	RetryAfter int
+}
+
+// Error gets the error message, including how long the caller has to wait.
+func (err *TooManyAttemptsError) Error() string {
+	return fmt.Sprintf("too many incorrect notebook key attempts, retry after %d seconds", err.RetryAfter)
+}
+
+// unlockAttempts represents a notebook's failed attempts since a correct key was last used. The records are kept on disk
+// so restarting the app does not reset them.
+type unlockAttempts struct {
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"lastFailure"`
+}
+
+var (
+	notebookUnlockAttempts map[string]*unlockAttempts
+	unlockAttemptsMutex sync.Mutex
+	unlockAttemptLocks = make(map[string]*sync.Mutex)
+)
+
+// readUnlockAttempts reads the failed attempt records into memory, if they have not been read already. The unlock
+// attempts mutex must be held.
+func readUnlockAttempts() {
+	if notebookUnlockAttempts != nil {
+		return
+	}
+	notebookUnlockAttempts = make(map[string]*unlockAttempts)
+
+	attemptsJson, err := os.ReadFile(unlockAttemptsFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error occurred reading unlock attempts file (%s): %s", unlockAttemptsFile, err)
+		return
+	}
+
+	err = json.Unmarshal(attemptsJson, &notebookUnlockAttempts)
+	if err != nil {
+		log.Printf("Error occurred parsing unlock attempts file JSON (%s): %s", unlockAttemptsFile, err)
+		notebookUnlockAttempts = make(map[string]*unlockAttempts)
+	}
+}
+
+// writeUnlockAttempts writes the failed attempt records to disk. The unlock attempts mutex must be held.
+func writeUnlockAttempts() {
+	attemptsJson, err := json.Marshal(notebookUnlockAttempts)
+	if err != nil {
+		log.Printf("Error occurred stringifying unlock attempts file JSON (%s): %s", unlockAttemptsFile, err)
+		return
+	}
+
+	err = WriteFileAtomic(unlockAttemptsFile, attemptsJson)
+	if err != nil {
+		log.Printf("Error occurred writing unlock attempts file (%s): %s", unlockAttemptsFile, err)
+	}
+}
+
+/*
+unlockDelay gets how long to wait after a number of failed attempts in a row before a notebook key can be tried again.
+Once there have been as many failures as the unlockFreeAttempts setting allows, the delay starts at unlockBaseDelay
+seconds and doubles with every further failure, up to unlockMaxDelay seconds.
+
+	failures: the number of failed attempts in a row.
+
+	returns:  the delay.
+*/
+func unlockDelay(failures int) time.Duration {
+	if failures == 0 {
+		return 0
+	}
+
+	// The settings are read once, so an attempt does not read the settings file for each option
+	settings, err := readSettings()
+	if err != nil {
+		settings = map[string]string{}
+	}
+
+	freeAttempts := settingsCount(settings, unlockFreeAttemptsSetting, defaultUnlockFreeAttempts)
+	if failures < freeAttempts {
+		return 0
+	}
+
+	baseDelay := float64(settingsCount(settings, unlockBaseDelaySetting, defaultUnlockBaseDelaySeconds))
+	maxDelay := float64(settingsCount(settings, unlockMaxDelaySetting, defaultUnlockMaxDelaySeconds))
+	delay := math.Min(baseDelay * math.Pow(2, float64(failures - freeAttempts)), maxDelay)
+
+	return time.Duration(delay) * time.Second
+}
+
+// unlockAttemptLock gets the mutex that makes attempts on a notebook one at a time.
+func unlockAttemptLock(notebookID string) *sync.Mutex {
+	unlockAttemptsMutex.Lock()
+	defer unlockAttemptsMutex.Unlock()
+
+	lock, ok := unlockAttemptLocks[notebookID]
+	if !ok {
+		lock = &sync.Mutex{}
+		unlockAttemptLocks[notebookID] = lock
+	}
+
+	return lock
+}
+
+/*
+beginUnlockAttempt starts an attempt to use a notebook key, unless the notebook is waiting out the delay after failed
+attempts. Only one attempt can be made on a notebook at a time, so concurrent guesses cannot all slip in before the
+first failure is recorded, and the attempt must be finished.
+
+	notebookID: the notebook's ID.
+
+	returns:    the function that finishes the attempt with the error it ended in, if any, or a TooManyAttemptsError.
+*/
+func beginUnlockAttempt(notebookID string) (func(err error), error) {
+	lock := unlockAttemptLock(notebookID)
+	lock.Lock()
+
+	unlockAttemptsMutex.Lock()
+	readUnlockAttempts()
+	attempts, ok := notebookUnlockAttempts[notebookID]
+	unlockAttemptsMutex.Unlock()
+
+	if ok {
+		wait := time.Until(attempts.LastFailure.Add(unlockDelay(attempts.Failures)))
+		if wait > 0 {
+			lock.Unlock()
+			return nil, &TooManyAttemptsError{
+				RetryAfter: int(math.Ceil(wait.Seconds())),
+			}
+		}
+	}
+
+	return func(err error) {
+		defer lock.Unlock()
+		finishUnlockAttempt(notebookID, err)
+	}, nil
+}
+
+// finishUnlockAttempt records a failed attempt if an incorrect key was used, or clears the record if the key was correct.
+func finishUnlockAttempt(notebookID string, err error) {
+	unlockAttemptsMutex.Lock()
+	defer unlockAttemptsMutex.Unlock()
+
+	attempts, ok := notebookUnlockAttempts[notebookID]
+
+	switch {
+	case errors.Is(err, errIncorrectNotebookKey):
+		if !ok {
+			attempts = &unlockAttempts{}
+			notebookUnlockAttempts[notebookID] = attempts
+		}
+		attempts.Failures++
+		attempts.LastFailure = time.Now()
+
+		log.Printf("Incorrect notebook key attempt %d in a row (%s)", attempts.Failures, notebookFilepath(notebookID))
+	case err == nil && ok:
+		delete(notebookUnlockAttempts, notebookID)
+	default:
+		return
+	}
+
+	writeUnlockAttempts()
+}
+
+// clearUnlockAttempts removes a notebook's record of failed attempts, such as when the notebook is deleted.
+func clearUnlockAttempts(notebookID string) {
+	unlockAttemptsMutex.Lock()
+	defer unlockAttemptsMutex.Unlock()
+
+	readUnlockAttempts()
+	if _, ok := notebookUnlockAttempts[notebookID]; !ok {
+		return
+	}
+
+	delete(notebookUnlockAttempts, notebookID)
+	writeUnlockAttempts()
+}
@@ -0,0 +1,185 @@
+package services
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// setUnlockDelaySettings overrides the unlock delay settings for a test, restoring the defaults once it is over.
+func setUnlockDelaySettings(t *testing.T, freeAttempts string, baseDelay string, maxDelay string) {
+	t.Helper()
+
+	settings := map[string]string{
+		unlockFreeAttemptsSetting: freeAttempts,
+		unlockBaseDelaySetting: baseDelay,
+		unlockMaxDelaySetting: maxDelay,
+	}
+	for key, value := range settings {
+		err := SetSettingsOption(key, value)
+		if err != nil {
+			t.Fatalf("setting %s: %s", key, err)
+		}
+	}
+
+	t.Cleanup(func() {
+		for key := range settings {
+			SetSettingsOption(key, "")
+		}
+	})
+}
+
+// restartUnlockAttempts drops the failed attempt records held in memory, so they are read from disk again as they
+// would be after a restart.
+func restartUnlockAttempts() {
+	unlockAttemptsMutex.Lock()
+	defer unlockAttemptsMutex.Unlock()
+
+	notebookUnlockAttempts = nil
+}
+
+// unlockAttemptsFor gets a copy of a notebook's failed attempt record, reading the records from disk if needed.
+func unlockAttemptsFor(notebookID string) (unlockAttempts, bool) {
+	unlockAttemptsMutex.Lock()
+	defer unlockAttemptsMutex.Unlock()
+
+	readUnlockAttempts()
+	attempts, ok := notebookUnlockAttempts[notebookID]
+	if !ok {
+		return unlockAttempts{}, false
+	}
+
+	return *attempts, true
+}
+
+// TestUnlockDelay checks that the delay doubles after the free attempts and stops at the maximum.
+func TestUnlockDelay(t *testing.T) {
+	tests := []struct {
+		name         string
+		freeAttempts string
+		baseDelay    string
+		maxDelay     string
+		failures     int
+		expected     time.Duration
+	}{
+		{"no failures", "0", "1", "60", 0, 0},
+		{"within the free attempts", "3", "1", "60", 2, 0},
+		{"first delayed attempt", "3", "1", "60", 3, time.Second},
+		{"doubles with each failure", "3", "1", "60", 5, 4 * time.Second},
+		{"doubles the base delay", "3", "5", "60", 4, 10 * time.Second},
+		{"capped at the maximum", "3", "1", "60", 20, time.Minute},
+		{"defaults for unset settings", "", "", "", defaultUnlockFreeAttempts + 1, 2 * defaultUnlockBaseDelaySeconds * time.Second},
+		{"defaults for invalid settings", "many", "-1", "", defaultUnlockFreeAttempts, defaultUnlockBaseDelaySeconds * time.Second},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			setUnlockDelaySettings(t, test.freeAttempts, test.baseDelay, test.maxDelay)
+
+			delay := unlockDelay(test.failures)
+			if delay != test.expected {
+				t.Errorf("expected a delay of %s after %d failures, found %s", test.expected, test.failures, delay)
+			}
+		})
+	}
+}
+
+// TestUnlockAttemptsThrottle checks that failed attempts delay the next one, across restarts, until a correct key is
+// used.
+func TestUnlockAttemptsThrottle(t *testing.T) {
+	const (
+		notebookName = "Throttle Test"
+		notebookKey = "throttle-test-key"
+		wrongKey = "wrong-throttle-test-key"
+	)
+
+	setUnlockDelaySettings(t, "2", "60", "3600")
+
+	_, err := CreateNotebook(notebookName, "", notebookKey, false)
+	if err != nil {
+		t.Fatalf("creating notebook: %s", err)
+	}
+	notebookID := cleanFileName(notebookName)
+
+	for i := 0; i < 2; i++ {
+		_, err = UnlockNotebook(notebookName, wrongKey)
+		if !errors.Is(err, errIncorrectNotebookKey) {
+			t.Fatalf("expected attempt %d with the wrong key to be incorrect, got %v", i + 1, err)
+		}
+	}
+
+	var tooMany *TooManyAttemptsError
+	_, err = UnlockNotebook(notebookName, notebookKey)
+	if !errors.As(err, &tooMany) {
+		t.Fatalf("expected the correct key to be delayed after the free attempts, got %v", err)
+	}
+	if tooMany.RetryAfter <= 0 || tooMany.RetryAfter > 60 {
+		t.Errorf("expected to retry within the base delay of 60 seconds, found %d", tooMany.RetryAfter)
+	}
+
+	restartUnlockAttempts()
+
+	_, err = UnlockNotebook(notebookName, notebookKey)
+	if !errors.As(err, &tooMany) {
+		t.Fatalf("expected the delay to still apply after a restart, got %v", err)
+	}
+	attempts, ok := unlockAttemptsFor(notebookID)
+	if !ok || attempts.Failures != 2 {
+		t.Fatalf("expected 2 failures to be read back after a restart, found %+v", attempts)
+	}
+
+	// Waiting out the delay is simulated by moving the last failure back past it
+	unlockAttemptsMutex.Lock()
+	notebookUnlockAttempts[notebookID].LastFailure = time.Now().Add(-2 * time.Minute)
+	unlockAttemptsMutex.Unlock()
+
+	session, err := UnlockNotebook(notebookName, notebookKey)
+	if err != nil {
+		t.Fatalf("unlocking with the correct key after the delay: %s", err)
+	}
+	LockNotebook(session.Token)
+
+	restartUnlockAttempts()
+
+	if attempts, ok := unlockAttemptsFor(notebookID); ok {
+		t.Errorf("expected the correct key to clear the failures, found %+v", attempts)
+	}
+}
+
+// TestDeleteNotebookClearsUnlockAttempts checks that deleting a notebook removes its failed attempt record.
+func TestDeleteNotebookClearsUnlockAttempts(t *testing.T) {
+	const (
+		notebookName = "Throttle Delete Test"
+		notebookKey = "throttle-delete-test-key"
+	)
+
+	_, err := CreateNotebook(notebookName, "", notebookKey, false)
+	if err != nil {
+		t.Fatalf("creating notebook: %s", err)
+	}
+	notebookID := cleanFileName(notebookName)
+
+	session, err := UnlockNotebook(notebookName, notebookKey)
+	if err != nil {
+		t.Fatalf("unlocking notebook: %s", err)
+	}
+
+	_, err = UnlockNotebook(notebookName, "wrong-throttle-delete-test-key")
+	if !errors.Is(err, errIncorrectNotebookKey) {
+		t.Fatalf("expected the wrong key to be incorrect, got %v", err)
+	}
+	if _, ok := unlockAttemptsFor(notebookID); !ok {
+		t.Fatalf("expected the wrong key to be recorded")
+	}
+
+	err = DeleteNotebook(notebookName, NotebookCredentials{SessionToken: session.Token}, nil)
+	if err != nil {
+		t.Fatalf("deleting notebook: %s", err)
+	}
+
+	restartUnlockAttempts()
+
+	if attempts, ok := unlockAttemptsFor(notebookID); ok {
+		t.Errorf("expected deleting the notebook to clear its failures, found %+v", attempts)
+	}
+}
@@ -0,0 +1,426 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	notebookTrashDir = notebooksDir + "/trash"
+	trashRetentionSetting = "trashRetentionDays"
+	defaultTrashRetentionDays = 30
+)
+
+// TrashedNotebookEntry represents an entry that has been deleted from a notebook but can still be restored. A trashed
+// entry's history stays in its entry file, so History is only set when reading notebooks from before entry files.
+type TrashedNotebookEntry struct {
+	ID         string                   `json:"id"`
+	Entry      *NotebookEntry           `json:"entry"`
+	History    []*NotebookEntryRevision `json:"history,omitempty"`
+	DeleteTime time.Time                `json:"deleteTime"`
+}
+
+// TrashedNotebook represents a notebook that has been deleted but can still be restored.
+type TrashedNotebook struct {
+	TrashID     string    `json:"trashId"`
+	ID          string    `json:"id"`
+	Hidden      bool      `json:"hidden"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	DeleteTime  time.Time `json:"deleteTime"`
+}
+
+// ensureNotebookTrashDirExists will create the notebook trash directory if it does not exist.
+func ensureNotebookTrashDirExists() {
+	if _, err := os.Stat(notebookTrashDir); errors.Is(err, fs.ErrNotExist) {
+		err := os.Mkdir(notebookTrashDir, 0700)
+		if err != nil {
+			log.Printf("Error occurred creating notebook trash directory (%s): %s", notebookTrashDir, err)
+		}
+	}
+}
+
+/*
+trashRetention gets how long deleted entries and notebooks are kept in the trash before they are purged, from the
+trashRetentionDays setting. A retention of zero days means items are kept until the trash is emptied.
+
+	returns: the retention period, or zero if items are never purged.
+*/
+func trashRetention() time.Duration {
+	days := getSettingsCount(trashRetentionSetting, defaultTrashRetentionDays)
+
+	return time.Duration(days) * 24 * time.Hour
+}
+
+// trashExpired reports whether an item deleted at a specified time has been in the trash for longer than the retention period.
+func trashExpired(deleteTime time.Time, retention time.Duration) bool {
+	return retention > 0 && time.Since(deleteTime) > retention
+}
+
+// trashNotebookEntry moves an entry into its notebook's trash. Its content and history stay in its entry file.
+func trashNotebookEntry(notebook *DecryptedNotebook, entryID string) error {
+	trashID, err := newNotebookID()
+	if err != nil {
+		log.Printf("Error occurred generating trash ID for entry (%s): %s", notebookFilepath(notebook.ID), err)
+		return fmt.Errorf("an unexpected error occurred while deleting the entry, check the logs for more details")
+	}
+
+	if notebook.Content.Trash == nil {
+		notebook.Content.Trash = make(map[string]*TrashedNotebookEntry)
+	}
+
+	notebook.Content.Trash[trashID] = &TrashedNotebookEntry{
+		ID: trashID,
+		Entry: notebook.Content.Entries[entryID],
+		DeleteTime: time.Now(),
+	}
+
+	delete(notebook.Content.Entries, entryID)
+
+	return nil
+}
+
+// purgeExpiredNotebookEntries permanently removes entries that have been in a notebook's trash for too long, along
+// with their entry files and attachments.
+func purgeExpiredNotebookEntries(notebook *DecryptedNotebook) {
+	retention := trashRetention()
+
+	for trashID, trashed := range notebook.Content.Trash {
+		if trashExpired(trashed.DeleteTime, retention) {
+			deleteEntryAttachments(notebook, trashed.Entry.ID)
+			forgetEntryBody(notebook, trashed.Entry.ID)
+			delete(notebook.Content.Trash, trashID)
+		}
+	}
+}
+
+/*
+ListTrashedNotebookEntries lists the entries in a notebook's trash.
+
+	notebookName: the notebook's name.
+	credentials:  the notebook key or session token used to encrypt/decrypt the notebook.
+
+	returns:      the trashed entries from most to least recently deleted, or an error.
+*/
+func ListTrashedNotebookEntries(notebookName string, credentials NotebookCredentials) ([]*TrashedNotebookEntry, error) {
+	var trashedEntries []*TrashedNotebookEntry
+
+	err := viewNotebook(notebookName, credentials, func(notebook *DecryptedNotebook) error {
+		purgeExpiredNotebookEntries(notebook)
+
+		for _, trashed := range notebook.Content.Trash {
+			// Trashed entries are listed from the notebook's index, so like other entry listings they are left
+			// without their content
+			trashedCopy := *trashed
+			entryCopy := *trashed.Entry
+			entryCopy.Content = ""
+			trashedCopy.Entry = &entryCopy
+			trashedEntries = append(trashedEntries, &trashedCopy)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(trashedEntries, func(i, j int) bool {
+		return trashedEntries[i].DeleteTime.After(trashedEntries[j].DeleteTime)
+	})
+
+	return trashedEntries, nil
+}
+
+/*
+RestoreTrashedNotebookEntry moves an entry out of a notebook's trash and back into the notebook, along with its history,
+which never left its entry file. If the folder the entry was in has since been deleted, it is created again.
+
+	notebookName: the notebook's name.
+	credentials:  the notebook key or session token used to encrypt/decrypt the notebook.
+	trashID:      the ID of the trashed entry.
+
+	returns:      the restored entry, or an error.
+*/
+func RestoreTrashedNotebookEntry(notebookName string, credentials NotebookCredentials, trashID string) (*NotebookEntry, error) {
+	var entry *NotebookEntry
+
+	err := updateNotebook(notebookName, credentials, func(notebook *DecryptedNotebook) error {
+		trashed, ok := notebook.Content.Trash[trashID]
+		if !ok {
+			return fmt.Errorf("the specified entry does not exist in this notebook's trash")
+		}
+
+		entry = trashed.Entry
+		err := loadEntryBody(notebook, entry.ID)
+		if err != nil {
+			return err
+		}
+
+		ensureFolderExists(notebook, entry.Folder)
+		notebook.Content.Entries[entry.ID] = entry
+		delete(notebook.Content.Trash, trashID)
+		updateNotebookEditTime(notebook)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return entry, nil
+}
+
+/*
+EmptyNotebookEntryTrash permanently removes every entry in a notebook's trash, along with their entry files and
+attachments.
+
+	notebookName: the notebook's name.
+	credentials:  the notebook key or session token used to encrypt/decrypt the notebook.
+
+	returns:      an error, if one occurs.
+*/
+func EmptyNotebookEntryTrash(notebookName string, credentials NotebookCredentials) error {
+	return updateNotebook(notebookName, credentials, func(notebook *DecryptedNotebook) error {
+		for _, trashed := range notebook.Content.Trash {
+			deleteEntryAttachments(notebook, trashed.Entry.ID)
+			forgetEntryBody(notebook, trashed.Entry.ID)
+		}
+		notebook.Content.Trash = nil
+		updateNotebookEditTime(notebook)
+
+		return nil
+	})
+}
+
+// trashedNotebookFilepath gets the path to a trashed notebook's file from its trash ID.
+func trashedNotebookFilepath(trashID string) string {
+	return fmt.Sprintf("%s/%s%s", notebookTrashDir, trashID, notebookFileExt)
+}
+
+// parseNotebookTrashID splits a trashed notebook's ID into the time it was deleted and the notebook's own ID.
+func parseNotebookTrashID(trashID string) (time.Time, string, error) {
+	parts := strings.SplitN(trashID, "-", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		return time.Time{}, "", fmt.Errorf("the specified notebook does not exist in the trash")
+	}
+
+	deleteTime, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("the specified notebook does not exist in the trash")
+	}
+
+	return time.Unix(0, deleteTime), parts[1], nil
+}
+
+// trashNotebook moves a notebook's file, entry files and attachments into the trash directory. The trash ID records
+// when it was deleted.
+func trashNotebook(notebookID string) error {
+	trashID := fmt.Sprintf("%d-%s", time.Now().UnixNano(), notebookID)
+	filepath := notebookFilepath(notebookID)
+	trashedFilepath := trashedNotebookFilepath(trashID)
+
+	ensureNotebookTrashDirExists()
+
+	err := os.Rename(filepath, trashedFilepath)
+	if err != nil {
+		log.Printf("Error occurred moving notebook file to the trash (%s): %s", filepath, err)
+		return fmt.Errorf("an unexpected error occurred while deleting the notebook, check the logs for more details")
+	}
+
+	err = moveNotebookDirs(notebookAttachmentsDir(notebookID), trashedNotebookAttachmentsDir(trashID), notebookEntriesDir(notebookID), trashedNotebookEntriesDir(trashID))
+	if err != nil {
+		log.Printf("Error occurred moving notebook entry files and attachments to the trash (%s): %s", filepath, err)
+	}
+
+	err = syncDir(notebooksDir)
+	if err == nil {
+		err = syncDir(notebookTrashDir)
+	}
+	if err != nil {
+		log.Printf("Error occurred syncing notebook directories after moving a notebook to the trash (%s): %s", filepath, err)
+	}
+
+	return nil
+}
+
+// purgeExpiredNotebooks permanently removes notebooks that have been in the trash for too long.
+func purgeExpiredNotebooks() {
+	retention := trashRetention()
+	if retention == 0 {
+		return
+	}
+
+	files, err := os.ReadDir(notebookTrashDir)
+	if err != nil {
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Error occurred checking the notebook trash for expired notebooks: %s", err)
+		}
+		return
+	}
+
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), notebookFileExt) {
+			continue
+		}
+
+		deleteTime, _, err := parseNotebookTrashID(strings.TrimSuffix(file.Name(), notebookFileExt))
+		if err != nil || !trashExpired(deleteTime, retention) {
+			continue
+		}
+
+		filepath := fmt.Sprintf("%s/%s", notebookTrashDir, file.Name())
+		err = os.Remove(filepath)
+		if err != nil {
+			log.Printf("Error occurred purging expired notebook from the trash (%s): %s", filepath, err)
+			continue
+		}
+
+		trashID := strings.TrimSuffix(file.Name(), notebookFileExt)
+		for _, dir := range []string{trashedNotebookEntriesDir(trashID), trashedNotebookAttachmentsDir(trashID)} {
+			err = os.RemoveAll(dir)
+			if err != nil {
+				log.Printf("Error occurred purging expired notebook files from the trash (%s): %s", dir, err)
+			}
+		}
+	}
+}
+
+/*
+ListTrashedNotebooks lists the notebooks in the trash, purging any that have been there for too long.
+
+	returns: the trashed notebooks from most to least recently deleted, or an error.
+*/
+func ListTrashedNotebooks() ([]*TrashedNotebook, error) {
+	purgeExpiredNotebooks()
+
+	trashedNotebooks := make([]*TrashedNotebook, 0)
+
+	files, err := os.ReadDir(notebookTrashDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return trashedNotebooks, nil
+	}
+	if err != nil {
+		log.Printf("Error occurred fetching list of trashed notebooks: %s", err)
+		return nil, fmt.Errorf("an unexpected error occurred while locating trashed notebooks, check the logs for more details")
+	}
+
+	for _, file := range files {
+		if file.IsDir() || !strings.HasSuffix(file.Name(), notebookFileExt) {
+			continue
+		}
+
+		trashID := strings.TrimSuffix(file.Name(), notebookFileExt)
+		deleteTime, notebookID, err := parseNotebookTrashID(trashID)
+		if err != nil {
+			continue
+		}
+
+		notebook, err := readNotebookFile(trashedNotebookFilepath(trashID))
+		if err != nil {
+			return nil, err
+		}
+
+		trashedNotebook := &TrashedNotebook{
+			TrashID: trashID,
+			ID: notebookID,
+			Hidden: notebook.Hidden,
+			Name: notebook.Name,
+			Description: notebook.Description,
+			DeleteTime: deleteTime,
+		}
+		if notebook.Hidden {
+			trashedNotebook.Name = hiddenNotebookPlaceholderName
+		}
+
+		trashedNotebooks = append(trashedNotebooks, trashedNotebook)
+	}
+
+	sort.Slice(trashedNotebooks, func(i, j int) bool {
+		return trashedNotebooks[i].DeleteTime.After(trashedNotebooks[j].DeleteTime)
+	})
+
+	return trashedNotebooks, nil
+}
+
+/*
+RestoreTrashedNotebook moves a notebook, its entry files and its attachments out of the trash and back into the notebooks directory.
+
+	trashID: the ID of the trashed notebook.
+
+	returns: the restored notebook's ID, or an error.
+*/
+func RestoreTrashedNotebook(trashID string) (string, error) {
+	_, notebookID, err := parseNotebookTrashID(trashID)
+	if err != nil || cleanFileName(trashID) != trashID {
+		return "", fmt.Errorf("the specified notebook does not exist in the trash")
+	}
+
+	unlock := lockNotebookForWrite(notebookID)
+	defer unlock()
+
+	trashedFilepath := trashedNotebookFilepath(trashID)
+	if _, err := os.Stat(trashedFilepath); errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("the specified notebook does not exist in the trash")
+	}
+
+	filepath := notebookFilepath(notebookID)
+	if _, err := os.Stat(filepath); !errors.Is(err, fs.ErrNotExist) {
+		return "", fmt.Errorf("a notebook with the same name already exists, rename it before restoring this one")
+	}
+
+	err = os.Rename(trashedFilepath, filepath)
+	if err != nil {
+		log.Printf("Error occurred moving notebook file out of the trash (%s): %s", trashedFilepath, err)
+		return "", fmt.Errorf("an unexpected error occurred while restoring the notebook, check the logs for more details")
+	}
+
+	err = moveNotebookDirs(trashedNotebookAttachmentsDir(trashID), notebookAttachmentsDir(notebookID), trashedNotebookEntriesDir(trashID), notebookEntriesDir(notebookID))
+	if err != nil {
+		log.Printf("Error occurred moving notebook entry files and attachments out of the trash (%s): %s", trashedFilepath, err)
+	}
+
+	err = syncDir(notebooksDir)
+	if err != nil {
+		log.Printf("Error occurred syncing notebooks directory after restoring a notebook (%s): %s", filepath, err)
+	}
+
+	return notebookID, nil
+}
+
+/*
+EmptyNotebookTrash permanently removes every notebook in the trash, along with their entry files and attachments.
+
+	returns: an error, if one occurs.
+*/
+func EmptyNotebookTrash() error {
+	files, err := os.ReadDir(notebookTrashDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		log.Printf("Error occurred fetching list of trashed notebooks: %s", err)
+		return fmt.Errorf("an unexpected error occurred while emptying the trash, check the logs for more details")
+	}
+
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), notebookFileExt) && !strings.HasSuffix(file.Name(), notebookAttachmentsExt) && !strings.HasSuffix(file.Name(), notebookEntriesExt) {
+			continue
+		}
+
+		filepath := fmt.Sprintf("%s/%s", notebookTrashDir, file.Name())
+		err = os.RemoveAll(filepath)
+		if err != nil {
+			log.Printf("Error occurred deleting trashed notebook (%s): %s", filepath, err)
+			return fmt.Errorf("an unexpected error occurred while emptying the trash, check the logs for more details")
+		}
+	}
+
+	return nil
+}
@@ -1,6 +1,44 @@
 package services
 
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
 // SetWindowTitle sets the title of the webview window.
 func SetWindowTitle(title string) {
 	WindowHandle.SetTitle(title)
 }
+
+/*
+dispatchWindowEvent pushes an event to the UI by dispatching it on the webview window's DOM window, where it can be
+listened for like any other event. Nothing is dispatched when there is no window, such as in tests.
+
+	name:   the event's type.
+	detail: the event's details, which are serialized as JSON.
+*/
+func dispatchWindowEvent(name string, detail interface{}) {
+	if WindowHandle == nil {
+		return
+	}
+
+	nameJson, err := json.Marshal(name)
+	if err != nil {
+		log.Printf("Error occurred stringifying window event name (%s): %s", name, err)
+		return
+	}
+
+	detailJson, err := json.Marshal(detail)
+	if err != nil {
+		log.Printf("Error occurred stringifying window event details (%s): %s", name, err)
+		return
+	}
+
+	script := fmt.Sprintf("window.dispatchEvent(new CustomEvent(%s, { detail: %s }));", nameJson, detailJson)
+
+	// The webview can only be used from its own thread
+	WindowHandle.Dispatch(func() {
+		WindowHandle.Eval(script)
+	})
+}
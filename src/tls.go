@@ -0,0 +1,206 @@
+package src
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"eno/src/services"
+)
+
+const (
+	tlsCertificateFileSetting = "tlsCertificateFile"
+	tlsKeyFileSetting = "tlsKeyFile"
+	generatedCertificateFile = "tls/cert.pem"
+	generatedKeyFile = "tls/key.pem"
+	generatedCertificateLifetime = 825 * 24 * time.Hour
+	generatedCertificateRenewal = 30 * 24 * time.Hour
+	serialNumberBits = 128
+)
+
+/*
+LoadTLSCertificate loads the certificate the server is served with. The certificate comes from the tlsCertificateFile
+and tlsKeyFile settings when both are set, which lets a certificate the system already trusts be used. Otherwise a
+self-signed certificate for the loopback hosts is generated and kept in the tls folder, and is generated again when it
+is close to expiring or cannot be loaded.
+
+	hosts:   the host names and IP addresses the app is served from, which a generated certificate is valid for.
+
+	returns: the certificate, the PEM encoding of its leaf for the webview to trust, or an error.
+*/
+func LoadTLSCertificate(hosts ...string) (*tls.Certificate, []byte, error) {
+	certificateFile, err := services.GetSettingsOption(tlsCertificateFileSetting)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyFile, err := services.GetSettingsOption(tlsKeyFileSetting)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var certificate tls.Certificate
+	if certificateFile != "" && keyFile != "" {
+		certificate, err = tls.LoadX509KeyPair(certificateFile, keyFile)
+		if err != nil {
+			return nil, nil, fmt.Errorf("the TLS certificate could not be loaded (%s): %w", certificateFile, err)
+		}
+	} else {
+		if certificateFile != "" || keyFile != "" {
+			log.Printf("Only one of the %s and %s settings is set, using a generated certificate", tlsCertificateFileSetting, tlsKeyFileSetting)
+		}
+
+		certificate, err = loadGeneratedCertificate(hosts)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	leafPem := pem.EncodeToMemory(&pem.Block{
+		Type: "CERTIFICATE",
+		Bytes: certificate.Certificate[0],
+	})
+
+	return &certificate, leafPem, nil
+}
+
+// loadGeneratedCertificate loads the generated certificate, generating a new one if it is missing, out of date, or
+// cannot be loaded, such as when the app stopped between writing the key and the certificate.
+func loadGeneratedCertificate(hosts []string) (tls.Certificate, error) {
+	if generatedCertificateValid(hosts) {
+		certificate, err := tls.LoadX509KeyPair(generatedCertificateFile, generatedKeyFile)
+		if err == nil {
+			return certificate, nil
+		}
+		log.Printf("Error occurred loading generated TLS certificate, generating a new one (%s): %s", generatedCertificateFile, err)
+	}
+
+	err := generateCertificate(hosts)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("the TLS certificate could not be generated: %w", err)
+	}
+
+	certificate, err := tls.LoadX509KeyPair(generatedCertificateFile, generatedKeyFile)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf("the TLS certificate could not be loaded (%s): %w", generatedCertificateFile, err)
+	}
+
+	return certificate, nil
+}
+
+// generatedCertificateValid checks that a previously generated certificate exists, covers every host and is not close
+// to expiring.
+func generatedCertificateValid(hosts []string) bool {
+	certificatePem, err := os.ReadFile(generatedCertificateFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false
+	}
+	if err != nil {
+		log.Printf("Error occurred reading generated TLS certificate (%s): %s", generatedCertificateFile, err)
+		return false
+	}
+
+	block, _ := pem.Decode(certificatePem)
+	if block == nil {
+		log.Printf("Generated TLS certificate is not valid PEM (%s), generating a new one", generatedCertificateFile)
+		return false
+	}
+
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		log.Printf("Error occurred parsing generated TLS certificate (%s): %s", generatedCertificateFile, err)
+		return false
+	}
+
+	if time.Until(certificate.NotAfter) < generatedCertificateRenewal {
+		log.Printf("Generated TLS certificate expires soon (%s), generating a new one", generatedCertificateFile)
+		return false
+	}
+
+	for _, host := range hosts {
+		if certificate.VerifyHostname(host) != nil {
+			return false
+		}
+	}
+
+	_, err = os.Stat(generatedKeyFile)
+	return err == nil
+}
+
+// generateCertificate generates a self-signed certificate for the given hosts and writes it and its key to the tls
+// folder, where only the current user can read them.
+func generateCertificate(hosts []string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), serialNumberBits))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serialNumber,
+		Subject: pkix.Name{
+			Organization: []string{"Encrypted Notebook"},
+			CommonName: "Encrypted Notebook local server",
+		},
+		NotBefore: now.Add(-time.Hour),
+		NotAfter: now.Add(generatedCertificateLifetime),
+		KeyUsage: x509.KeyUsageDigitalSignature,
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	certificateDer, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(generatedKeyFile), 0700)
+	if err != nil {
+		return err
+	}
+
+	// Each file is written to a new temporary file that only the current user can read, then renamed into place, so
+	// neither is ever left partly written or with the permissions of one left behind
+	err = services.WriteFileAtomic(generatedKeyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}))
+	if err != nil {
+		return err
+	}
+
+	err = services.WriteFileAtomic(generatedCertificateFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificateDer}))
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Generated a self-signed TLS certificate (%s)", generatedCertificateFile)
+
+	return nil
+}
@@ -0,0 +1,57 @@
+//go:build linux && cgo
+
+package src
+
+/*
+#cgo pkg-config: gtk+-3.0 webkit2gtk-4.0
+#include <stdlib.h>
+#include <string.h>
+#include <gtk/gtk.h>
+#include <webkit2/webkit2.h>
+
+// trust_certificate adds an exception for the certificate to the default web context, which the webview's page uses.
+// It returns an error message that must be freed, or NULL.
+static char *trust_certificate(const char *pem, const char *host) {
+	GError *error = NULL;
+	GTlsCertificate *certificate;
+
+	if (!gtk_init_check(NULL, NULL)) {
+		return strdup("GTK could not be initialized");
+	}
+
+	certificate = g_tls_certificate_new_from_pem(pem, -1, &error);
+	if (certificate == NULL) {
+		char *message = strdup(error->message);
+		g_error_free(error);
+		return message;
+	}
+
+	webkit_web_context_allow_tls_certificate_for_host(webkit_web_context_get_default(), certificate, host);
+	g_object_unref(certificate);
+
+	return NULL;
+}
+*/
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// TrustCertificate makes the webview accept a certificate for a host, even though it is not signed by a trusted
+// authority. WebKitGTK pages use the default web context, so it must be called before the webview is created.
+func TrustCertificate(certificatePem []byte, host string) error {
+	cPem := C.CString(string(certificatePem))
+	defer C.free(unsafe.Pointer(cPem))
+	cHost := C.CString(host)
+	defer C.free(unsafe.Pointer(cHost))
+
+	message := C.trust_certificate(cPem, cHost)
+	if message != nil {
+		defer C.free(unsafe.Pointer(message))
+		return fmt.Errorf("the webview could not be made to trust the certificate: %s", C.GoString(message))
+	}
+
+	return nil
+}
@@ -0,0 +1,13 @@
+//go:build !windows && !(linux && cgo)
+
+package src
+
+import (
+	"fmt"
+)
+
+// TrustCertificate is not supported on this platform, where the webview only accepts certificates the system trusts,
+// so the certificate has to be trusted in the system's certificate store or provided through the settings instead.
+func TrustCertificate(certificatePem []byte, host string) error {
+	return fmt.Errorf("the webview cannot be made to trust the certificate on this platform")
+}
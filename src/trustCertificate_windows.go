@@ -0,0 +1,39 @@
+package src
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"os"
+)
+
+const (
+	webView2ArgumentsEnv = "WEBVIEW2_ADDITIONAL_BROWSER_ARGUMENTS"
+	ignoreCertificateErrorsSpkiFlag = "--ignore-certificate-errors-spki-list="
+)
+
+// TrustCertificate makes the webview accept a certificate, even though it is not signed by a trusted authority.
+// WebView2 is told which public key to accept when its browser process starts, so it must be called before the
+// webview is created. The key is accepted for any host, but only the local server holds its private key.
+func TrustCertificate(certificatePem []byte, host string) error {
+	block, _ := pem.Decode(certificatePem)
+	if block == nil {
+		return fmt.Errorf("the certificate is not valid PEM")
+	}
+
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return err
+	}
+
+	spkiHash := sha256.Sum256(certificate.RawSubjectPublicKeyInfo)
+	argument := ignoreCertificateErrorsSpkiFlag + base64.StdEncoding.EncodeToString(spkiHash[:])
+
+	if arguments := os.Getenv(webView2ArgumentsEnv); arguments != "" {
+		argument = arguments + " " + argument
+	}
+
+	return os.Setenv(webView2ArgumentsEnv, argument)
+}
@@ -0,0 +1,163 @@
+package src
+
+import (
+	"strings"
+)
+
+const (
+	DiffEqual = "equal"
+	DiffInsert = "insert"
+	DiffDelete = "delete"
+	diffMaxEdits = 1024
+)
+
+// DiffLine represents a single line of a line-by-line diff.
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// splitLines splits text into lines, treating empty text as having no lines.
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+
+	return strings.Split(text, "\n")
+}
+
+/*
+DiffLines computes a line-by-line diff that turns one text into another. Texts that differ in more than a thousand or
+so lines are shown as every differing line being deleted and then inserted, rather than finding the shortest diff.
+
+	oldText: the original text.
+	newText: the changed text.
+
+	returns: the diff's lines, in order.
+*/
+func DiffLines(oldText string, newText string) []DiffLine {
+	a := splitLines(oldText)
+	b := splitLines(newText)
+
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(a) - prefix && suffix < len(b) - prefix && a[len(a) - 1 - suffix] == b[len(b) - 1 - suffix] {
+		suffix++
+	}
+
+	diff := make([]DiffLine, 0, len(a) + len(b))
+
+	for _, line := range a[:prefix] {
+		diff = append(diff, DiffLine{Op: DiffEqual, Text: line})
+	}
+
+	middleA := a[prefix:len(a) - suffix]
+	middleB := b[prefix:len(b) - suffix]
+	if middle, ok := shortestDiff(middleA, middleB); ok {
+		diff = append(diff, middle...)
+	} else {
+		for _, line := range middleA {
+			diff = append(diff, DiffLine{Op: DiffDelete, Text: line})
+		}
+		for _, line := range middleB {
+			diff = append(diff, DiffLine{Op: DiffInsert, Text: line})
+		}
+	}
+
+	for _, line := range a[len(a) - suffix:] {
+		diff = append(diff, DiffLine{Op: DiffEqual, Text: line})
+	}
+
+	return diff
+}
+
+// shortestDiff finds the shortest diff between two lists of lines using Myers' algorithm, giving up if it needs too many edits.
+func shortestDiff(a []string, b []string) ([]DiffLine, bool) {
+	n, m := len(a), len(b)
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2 * max + 3)
+
+	// trace[d] holds the furthest reaching x for each diagonal k in [-d-1, d+1] before edit d, indexed by k+d+1
+	var trace [][]int
+
+	for d := 0; d <= max; d++ {
+		if d > diffMaxEdits {
+			return nil, false
+		}
+
+		trace = append(trace, append([]int(nil), v[offset - d - 1:offset + d + 2]...))
+
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset + k - 1] < v[offset + k + 1]) {
+				x = v[offset + k + 1]
+			} else {
+				x = v[offset + k - 1] + 1
+			}
+			y := x - k
+
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset + k] = x
+
+			if x >= n && y >= m {
+				return backtrackDiff(trace, a, b), true
+			}
+		}
+	}
+
+	return nil, false
+}
+
+// backtrackDiff walks back through the trace recorded by shortestDiff to recover the edits it found.
+func backtrackDiff(trace [][]int, a []string, b []string) []DiffLine {
+	x, y := len(a), len(b)
+	reversed := make([]DiffLine, 0, len(a) + len(b))
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		at := func(k int) int {
+			return v[k + d + 1]
+		}
+
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && at(k - 1) < at(k + 1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			reversed = append(reversed, DiffLine{Op: DiffEqual, Text: a[x - 1]})
+			x--
+			y--
+		}
+
+		if d > 0 {
+			if x == prevX {
+				reversed = append(reversed, DiffLine{Op: DiffInsert, Text: b[y - 1]})
+			} else {
+				reversed = append(reversed, DiffLine{Op: DiffDelete, Text: a[x - 1]})
+			}
+		}
+
+		x, y = prevX, prevY
+	}
+
+	diff := make([]DiffLine, len(reversed))
+	for i, line := range reversed {
+		diff[len(reversed) - 1 - i] = line
+	}
+
+	return diff
+}
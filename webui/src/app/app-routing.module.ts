@@ -14,7 +14,7 @@ const routes: Routes = [
   { path: '', component: HomeComponent },
   { path: 'notebook/:notebookName', component: NotebookComponent },
   {
-    path: 'notebook/:notebookName/entry/:entryName',
+    path: 'notebook/:notebookName/entry/:entryId',
     component: EntryComponent,
   },
   { path: 'notebook/:notebookName/search', component: NotebookSearchComponent },
@@ -10,7 +10,7 @@ import { notebookConstants, formAppearance } from '../../util';
  */
 export interface CreateEntryDialogData {
   notebookName: string;
-  notebookKey: string;
+  sessionToken: string;
 }
 
 /**
@@ -68,7 +68,7 @@ export class CreateEntryDialogComponent {
     try {
       const entry = await this.entryService.createNotebookEntry(
         this.data.notebookName,
-        this.data.notebookKey,
+        this.data.sessionToken,
         form.entryName
       );
 
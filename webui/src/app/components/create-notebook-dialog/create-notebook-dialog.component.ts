@@ -2,6 +2,7 @@ import { Component } from '@angular/core';
 import { MatDialogRef } from '@angular/material/dialog';
 import { NotebookService } from '../../services/notebook/notebook.service';
 import { ErrorService } from '../../services/error/error.service';
+import { DialogService } from '../../services/dialog/dialog.service';
 import { notebookConstants, formAppearance } from '../../util';
 
 /**
@@ -12,6 +13,7 @@ interface CreateNotebookForm {
   notebookDescription: string;
   notebookKey: string;
   notebookKeyConfirm: string;
+  notebookHidden: boolean;
 }
 
 /**
@@ -31,7 +33,8 @@ export class CreateNotebookDialogComponent {
   constructor(
     private readonly dialogRef: MatDialogRef<CreateNotebookDialogComponent, {}>,
     private readonly notebookService: NotebookService,
-    private readonly errorService: ErrorService
+    private readonly errorService: ErrorService,
+    private readonly dialogService: DialogService
   ) {}
 
   /**
@@ -54,12 +57,23 @@ export class CreateNotebookDialogComponent {
     }
 
     try {
-      await this.notebookService.createNotebook(
+      const notebook = await this.notebookService.createNotebook(
         form.notebookName,
         form.notebookDescription,
-        form.notebookKey
+        form.notebookKey,
+        !!form.notebookHidden
       );
 
+      await this.dialogService.showConfirmationDialog({
+        data: {
+          title: 'Recovery key',
+          text: `This recovery key can unlock the notebook if its key is forgotten. Write it down and keep it somewhere safe, it will not be shown again: ${notebook.recoveryKey}`,
+          cancelLabel: 'Close',
+          confirmLabel: 'I have saved it',
+        },
+        disableClose: true,
+      });
+
       this.close(true);
     } catch (err) {
       this.errorService.showError({
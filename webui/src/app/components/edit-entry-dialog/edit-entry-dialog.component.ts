@@ -2,6 +2,7 @@ import { Component, Inject } from '@angular/core';
 import { MatDialogRef, MAT_DIALOG_DATA } from '@angular/material/dialog';
 import { EntryService } from '../../services/entry/entry.service';
 import { ErrorService } from '../../services/error/error.service';
+import { NotebookEntry } from '../../services/notebook/notebook.interface';
 import { notebookConstants, formAppearance } from '../../util';
 
 /**
@@ -9,7 +10,8 @@ import { notebookConstants, formAppearance } from '../../util';
  */
 export interface EditEntryDialogData {
   notebookName: string;
-  notebookKey: string;
+  sessionToken: string;
+  entryId: string;
   entryName: string;
 }
 
@@ -17,7 +19,7 @@ export interface EditEntryDialogData {
  * The data returned from the edit entry dialog.
  */
 export interface EditEntryDialogReturn {
-  entryName: string;
+  entry: NotebookEntry;
 }
 
 /**
@@ -69,14 +71,14 @@ export class EditEntryDialogComponent {
    */
   public async editEntry(form: EditEntryForm): Promise<void> {
     try {
-      await this.entryService.setNotebookEntryName(
+      const entry = await this.entryService.setNotebookEntryName(
         this.data.notebookName,
-        this.data.notebookKey,
-        this.data.entryName,
+        this.data.sessionToken,
+        this.data.entryId,
         form.entryName
       );
 
-      this.close({ entryName: form.entryName });
+      this.close({ entry });
     } catch (err) {
       this.errorService.showError({
         message: String(err),
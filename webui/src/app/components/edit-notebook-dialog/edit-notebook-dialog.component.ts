@@ -8,17 +8,17 @@ import { notebookConstants, formAppearance } from '../../util';
  * The data passed to the edit notebook dialog.
  */
 export interface EditNotebookDialogData {
+  notebookID: string;
   notebookName: string;
   notebookDescription: string;
-  notebookKey: string;
+  sessionToken: string;
 }
 
 /**
  * The data returned from the edit notebook dialog.
  */
 export interface EditNotebookDialogReturn {
-  notebookName: string;
-  notebookKey: string;
+  notebookID: string;
 }
 
 /**
@@ -44,6 +44,7 @@ export class EditNotebookDialogComponent {
   public notebookName: string;
   public notebookDescription: string;
   public newNotebookName: string | undefined;
+  public newNotebookID: string | undefined;
   public hideOldKey = true;
   public hideNewKey = true;
   public hideConfirmNewKey = true;
@@ -79,26 +80,28 @@ export class EditNotebookDialogComponent {
    * @param form The edit notebook form.
    */
   public async editNotebook(form: EditNotebookForm): Promise<void> {
-    let notebookName = this.data.notebookName;
-    let notebookKey = this.data.notebookKey;
+    let notebookID = this.data.notebookID;
 
     try {
       if (
         form.notebookName &&
         form.notebookName !== (this.newNotebookName ?? this.data.notebookName)
       ) {
-        await this.notebookService.setNotebookName(
-          this.data.notebookName,
+        const notebook = await this.notebookService.setNotebookName(
+          this.newNotebookID ?? this.data.notebookID,
+          this.data.sessionToken,
           form.notebookName
         );
 
-        notebookName = form.notebookName;
+        notebookID = notebook.id;
+        this.newNotebookID = notebook.id;
         this.newNotebookName = form.notebookName;
       }
 
       if (form.notebookDescription !== this.data.notebookDescription) {
         await this.notebookService.setNotebookDescription(
-          this.newNotebookName ?? notebookName,
+          this.newNotebookID ?? notebookID,
+          this.data.sessionToken,
           form.notebookDescription
         );
       }
@@ -114,17 +117,21 @@ export class EditNotebookDialogComponent {
         }
 
         await this.notebookService.setNotebookKey(
-          this.newNotebookName ?? notebookName,
+          this.newNotebookID ?? notebookID,
           form.oldNotebookKey,
           form.newNotebookKey
         );
 
-        notebookKey = form.newNotebookKey;
+        // Changing the key locks the notebook, so it is unlocked again with
+        // the new one
+        await this.notebookService.unlockNotebook(
+          this.newNotebookID ?? notebookID,
+          form.newNotebookKey
+        );
       }
 
       this.close({
-        notebookName: this.newNotebookName ?? notebookName,
-        notebookKey,
+        notebookID: this.newNotebookID ?? notebookID,
       });
     } catch (err) {
       this.errorService.showError({
@@ -1,6 +1,7 @@
-import { Component, OnInit, HostListener } from '@angular/core';
+import { Component, OnInit, OnDestroy, HostListener } from '@angular/core';
 import { Router, ActivatedRoute } from '@angular/router';
 import { Location } from '@angular/common';
+import { Subscription } from 'rxjs';
 import { NotebookService } from '../../services/notebook/notebook.service';
 import { EntryService } from '../../services/entry/entry.service';
 import { ErrorService } from '../../services/error/error.service';
@@ -9,6 +10,7 @@ import {
   NotebookEntry,
   NotebookDetails,
   DecryptedNotebook,
+  NotebookLockedNotification,
 } from '../../services/notebook/notebook.interface';
 import {
   OpenNotebookDialogComponent,
@@ -29,15 +31,16 @@ import {
   templateUrl: './entry.component.html',
   styleUrls: ['./entry.component.scss'],
 })
-export class EntryComponent implements OnInit {
+export class EntryComponent implements OnInit, OnDestroy {
   public loading = true;
   private notebookName = '';
-  private notebookKey = '';
-  private entryName = '';
+  private sessionToken = '';
+  private entryId = '';
   public notebookDetails: NotebookDetails | undefined;
   public notebook: DecryptedNotebook | undefined;
   public entry: NotebookEntry | undefined;
   public entryEditorContent: string | undefined;
+  private notebookLockedSubscription: Subscription | undefined;
 
   constructor(
     private readonly router: Router,
@@ -50,9 +53,14 @@ export class EntryComponent implements OnInit {
   ) {}
 
   public ngOnInit(): void {
+    this.notebookLockedSubscription =
+      this.notebookService.notebookLocked.subscribe((notification) =>
+        this.onNotebookLocked(notification)
+      );
+
     this.activatedRoute.paramMap.subscribe(async (paramMap) => {
       this.notebookName = paramMap.get('notebookName') || '';
-      this.entryName = paramMap.get('entryName') || '';
+      this.entryId = paramMap.get('entryId') || '';
 
       try {
         this.notebookDetails = await this.notebookService.getNotebookDetails(
@@ -68,35 +76,41 @@ export class EntryComponent implements OnInit {
         return;
       }
 
-      this.activatedRoute.queryParamMap.subscribe(async (queryParamMap) => {
-        this.notebookKey = queryParamMap.get('key') || '';
+      await this.unlockNotebook();
+    });
+  }
 
-        if (this.notebookKey !== '') {
-          await this.getEntry();
-        } else {
-          try {
-            const result = await this.dialogService.showDialog<
-              OpenNotebookDialogComponent,
-              OpenNotebookDialogData,
-              OpenNotebookDialogReturn
-            >(OpenNotebookDialogComponent, {
-              data: {
-                notebookDetails: this.notebookDetails as NotebookDetails,
-              },
-            });
+  public ngOnDestroy(): void {
+    this.notebookLockedSubscription?.unsubscribe();
+  }
+
+  /**
+   * Open the entry with the session held for its notebook, asking for the
+   * notebook's key first if it is not unlocked.
+   */
+  private async unlockNotebook(): Promise<void> {
+    const notebookDetails = this.notebookDetails as NotebookDetails;
+    this.sessionToken =
+      this.notebookService.getSessionToken(notebookDetails.id) ?? '';
 
-            await this.router.navigate(
-              ['notebook', this.notebookName, 'entry', this.entryName],
-              { queryParams: { key: result.notebookKey } }
-            );
-          } catch (_) {
-            this.location.back();
-          }
+    if (this.sessionToken === '') {
+      try {
+        const result = await this.dialogService.showDialog<
+          OpenNotebookDialogComponent,
+          OpenNotebookDialogData,
+          OpenNotebookDialogReturn
+        >(OpenNotebookDialogComponent, {
+          data: { notebookDetails },
+        });
 
-          this.loading = false;
-        }
-      });
-    });
+        this.sessionToken = result.sessionToken;
+      } catch (_) {
+        this.location.back();
+        return;
+      }
+    }
+
+    await this.getEntry();
   }
 
   /**
@@ -108,8 +122,8 @@ export class EntryComponent implements OnInit {
     try {
       this.entry = await this.entryService.getNotebookEntry(
         this.notebookName,
-        this.notebookKey,
-        this.entryName
+        this.sessionToken,
+        this.entryId
       );
       this.entryEditorContent = this.entry.content;
       this.errorService.close();
@@ -135,9 +149,7 @@ export class EntryComponent implements OnInit {
    * Open the notebook associated with the current entry.
    */
   public async openNotebook(): Promise<void> {
-    await this.router.navigate(['notebook', this.notebookName], {
-      queryParams: { key: this.notebookKey },
-    });
+    await this.router.navigate(['notebook', this.notebookName]);
   }
 
   /**
@@ -192,9 +204,10 @@ export class EntryComponent implements OnInit {
     try {
       this.entry = await this.entryService.setNotebookEntryContent(
         this.notebookName,
-        this.notebookKey,
-        this.entryName,
-        this.entryEditorContent ?? ''
+        this.sessionToken,
+        this.entryId,
+        this.entryEditorContent ?? '',
+        this.entry?.revision
       );
       this.errorService.close();
     } catch (err) {
@@ -216,15 +229,14 @@ export class EntryComponent implements OnInit {
       >(EditEntryDialogComponent, {
         data: {
           notebookName: this.notebookName,
-          notebookKey: this.notebookKey,
-          entryName: this.entryName,
+          sessionToken: this.sessionToken,
+          entryId: this.entryId,
+          entryName: this.entry?.name ?? '',
         },
       });
 
-      await this.router.navigate(
-        ['notebook', this.notebookName, 'entry', result.entryName],
-        { queryParams: { key: this.notebookKey } }
-      );
+      // Renaming an entry leaves its content as it was, so it is not returned
+      this.entry = { ...result.entry, content: this.entry?.content ?? '' };
     } catch (_) {}
   }
 
@@ -243,8 +255,8 @@ export class EntryComponent implements OnInit {
       try {
         await this.entryService.deleteNotebookEntry(
           this.notebookName,
-          this.notebookKey,
-          this.entryName
+          this.sessionToken,
+          this.entryId
         );
 
         this.errorService.close();
@@ -256,4 +268,33 @@ export class EntryComponent implements OnInit {
       }
     }
   }
+
+  /**
+   * Close the entry once the backend has locked its notebook, so the key has
+   * to be entered again. Locks from changing or deleting the notebook are left to the
+   * dialogs that made those changes.
+   *
+   * @param notification The lock notification.
+   */
+  private async onNotebookLocked(
+    notification: NotebookLockedNotification
+  ): Promise<void> {
+    if (
+      this.sessionToken === '' ||
+      notification.reason === 'keyChanged' ||
+      notification.reason === 'deleted' ||
+      (notification.notebookId !== '' &&
+        notification.notebookId !== this.notebookDetails?.id)
+    ) {
+      return;
+    }
+
+    this.sessionToken = '';
+    this.entry = undefined;
+    this.errorService.showError({
+      message: 'The notebook has been locked',
+      includeErrorPrefix: false,
+    });
+    await this.unlockNotebook();
+  }
 }
@@ -1,4 +1,6 @@
 import { Component } from '@angular/core';
+import { NotebookService } from '../../services/notebook/notebook.service';
+import { ErrorService } from '../../services/error/error.service';
 
 /**
  * The app header.
@@ -8,4 +10,23 @@ import { Component } from '@angular/core';
   templateUrl: './header.component.html',
   styleUrls: ['./header.component.scss'],
 })
-export class HeaderComponent {}
+export class HeaderComponent {
+  constructor(
+    private readonly notebookService: NotebookService,
+    private readonly errorService: ErrorService
+  ) {}
+
+  /**
+   * Lock every unlocked notebook. Open notebooks ask for their keys again once
+   * the backend reports them locked.
+   */
+  public async lockAllNotebooks(): Promise<void> {
+    try {
+      await this.notebookService.lockAllNotebooks();
+    } catch (err) {
+      this.errorService.showError({
+        message: String(err),
+      });
+    }
+  }
+}
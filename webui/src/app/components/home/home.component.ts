@@ -102,9 +102,9 @@ export class HomeComponent implements OnInit {
   /**
    * Open a notebook.
    *
-   * @param notebookName The name of the notebook.
+   * @param notebookID The ID of the notebook.
    */
-  public async openNotebook(notebookName: string): Promise<void> {
-    await this.router.navigate(['notebook', notebookName]);
+  public async openNotebook(notebookID: string): Promise<void> {
+    await this.router.navigate(['notebook', notebookID]);
   }
 }
@@ -1,7 +1,8 @@
-import { Component, OnInit } from '@angular/core';
+import { Component, OnInit, OnDestroy } from '@angular/core';
 import { Router, ActivatedRoute } from '@angular/router';
 import { Location } from '@angular/common';
 import { Sort } from '@angular/material/sort';
+import { Subscription } from 'rxjs';
 import { NotebookService } from '../../services/notebook/notebook.service';
 import { EntryService } from '../../services/entry/entry.service';
 import { ErrorService } from '../../services/error/error.service';
@@ -15,6 +16,7 @@ import {
   DecryptedNotebook,
   NotebookDetails,
   NotebookEntry,
+  NotebookLockedNotification,
 } from '../../services/notebook/notebook.interface';
 import { NotebookEntryMap } from '../../services/entry/entry.interface';
 import { sortData, notebookConstants, formAppearance } from '../../util';
@@ -35,10 +37,10 @@ interface NotebookSearchForm {
   templateUrl: './notebook-search.component.html',
   styleUrls: ['./notebook-search.component.scss'],
 })
-export class NotebookSearchComponent implements OnInit {
+export class NotebookSearchComponent implements OnInit, OnDestroy {
   public loading = true;
   private notebookName = '';
-  private notebookKey = '';
+  private sessionToken = '';
   public notebookDetails: NotebookDetails | undefined;
   public notebook: DecryptedNotebook | undefined;
   public searchResults: NotebookEntryMap = {};
@@ -47,6 +49,7 @@ export class NotebookSearchComponent implements OnInit {
   public searched = false;
   public notebookConstants = notebookConstants;
   public formAppearance = formAppearance;
+  private notebookLockedSubscription: Subscription | undefined;
 
   constructor(
     private readonly router: Router,
@@ -59,6 +62,11 @@ export class NotebookSearchComponent implements OnInit {
   ) {}
 
   public ngOnInit(): void {
+    this.notebookLockedSubscription =
+      this.notebookService.notebookLocked.subscribe((notification) =>
+        this.onNotebookLocked(notification)
+      );
+
     this.activatedRoute.paramMap.subscribe(async (paramMap) => {
       this.notebookName = paramMap.get('notebookName') || '';
 
@@ -76,39 +84,43 @@ export class NotebookSearchComponent implements OnInit {
         return;
       }
 
-      this.activatedRoute.queryParamMap.subscribe(async (queryParamMap) => {
-        this.notebookKey = queryParamMap.get('key') || '';
-
-        if (this.notebookKey !== '') {
-          await this.getNotebook();
-        } else {
-          try {
-            const result = await this.dialogService.showDialog<
-              OpenNotebookDialogComponent,
-              OpenNotebookDialogData,
-              OpenNotebookDialogReturn
-            >(OpenNotebookDialogComponent, {
-              data: {
-                notebookDetails: this.notebookDetails as NotebookDetails,
-              },
-            });
-
-            await this.router.navigate(
-              ['notebook', this.notebookName, 'search'],
-              {
-                queryParams: { key: result.notebookKey },
-              }
-            );
-          } catch (_) {
-            this.location.back();
-          }
-
-          this.loading = false;
-        }
-      });
+      await this.unlockNotebook();
     });
   }
 
+  public ngOnDestroy(): void {
+    this.notebookLockedSubscription?.unsubscribe();
+  }
+
+  /**
+   * Open the notebook with the session held for it, asking for its key first
+   * if it is not unlocked.
+   */
+  private async unlockNotebook(): Promise<void> {
+    const notebookDetails = this.notebookDetails as NotebookDetails;
+    this.sessionToken =
+      this.notebookService.getSessionToken(notebookDetails.id) ?? '';
+
+    if (this.sessionToken === '') {
+      try {
+        const result = await this.dialogService.showDialog<
+          OpenNotebookDialogComponent,
+          OpenNotebookDialogData,
+          OpenNotebookDialogReturn
+        >(OpenNotebookDialogComponent, {
+          data: { notebookDetails },
+        });
+
+        this.sessionToken = result.sessionToken;
+      } catch (_) {
+        this.location.back();
+        return;
+      }
+    }
+
+    await this.getNotebook();
+  }
+
   /**
    * Retrieve the notebook.
    */
@@ -118,7 +130,7 @@ export class NotebookSearchComponent implements OnInit {
     try {
       this.notebook = await this.notebookService.openNotebook(
         this.notebookName,
-        this.notebookKey
+        this.sessionToken
       );
       this.errorService.close();
     } catch (err) {
@@ -148,21 +160,21 @@ export class NotebookSearchComponent implements OnInit {
    * Return to the notebook.
    */
   public async openNotebook(): Promise<void> {
-    await this.router.navigate(['notebook', this.notebookName], {
-      queryParams: { key: this.notebookKey },
-    });
+    await this.router.navigate(['notebook', this.notebookName]);
   }
 
   /**
    * Open a notebook entry.
    *
-   * @param entryName The name of the notebook entry.
+   * @param entryId The ID of the notebook entry.
    */
-  public async openEntry(entryName: string): Promise<void> {
-    await this.router.navigate(
-      ['notebook', this.notebookName, 'entry', entryName],
-      { queryParams: { key: this.notebookKey } }
-    );
+  public async openEntry(entryId: string): Promise<void> {
+    await this.router.navigate([
+      'notebook',
+      this.notebookName,
+      'entry',
+      entryId,
+    ]);
   }
 
   /**
@@ -175,7 +187,7 @@ export class NotebookSearchComponent implements OnInit {
       try {
         this.searchResults = await this.entryService.searchNotebookEntries(
           this.notebookName,
-          this.notebookKey,
+          this.sessionToken,
           form.query,
           form.regexSearch
         );
@@ -195,4 +207,37 @@ export class NotebookSearchComponent implements OnInit {
       this.searched = false;
     }
   }
+
+  /**
+   * Clear the search once the backend has locked the notebook, so its key has
+   * to be entered again. Locks from changing or deleting the notebook are left
+   * to the dialogs that made those changes.
+   *
+   * @param notification The lock notification.
+   */
+  private async onNotebookLocked(
+    notification: NotebookLockedNotification
+  ): Promise<void> {
+    if (
+      this.sessionToken === '' ||
+      notification.reason === 'keyChanged' ||
+      notification.reason === 'deleted' ||
+      (notification.notebookId !== '' &&
+        notification.notebookId !== this.notebookDetails?.id)
+    ) {
+      return;
+    }
+
+    this.sessionToken = '';
+    this.notebook = undefined;
+    this.searchResults = {};
+    this.sortedSearchResults = [];
+    this.numResults = 0;
+    this.searched = false;
+    this.errorService.showError({
+      message: 'The notebook has been locked',
+      includeErrorPrefix: false,
+    });
+    await this.unlockNotebook();
+  }
 }
@@ -1,7 +1,8 @@
-import { Component, OnInit } from '@angular/core';
+import { Component, OnInit, OnDestroy } from '@angular/core';
 import { Router, ActivatedRoute } from '@angular/router';
 import { Location } from '@angular/common';
 import { Sort } from '@angular/material/sort';
+import { Subscription } from 'rxjs';
 import { NotebookService } from '../../services/notebook/notebook.service';
 import { ErrorService } from '../../services/error/error.service';
 import { DialogService } from '../../services/dialog/dialog.service';
@@ -25,6 +26,7 @@ import {
   DecryptedNotebook,
   NotebookDetails,
   NotebookEntry,
+  NotebookLockedNotification,
 } from '../../services/notebook/notebook.interface';
 import { sortData } from '../../util';
 
@@ -36,10 +38,10 @@ import { sortData } from '../../util';
   templateUrl: './notebook.component.html',
   styleUrls: ['./notebook.component.scss'],
 })
-export class NotebookComponent implements OnInit {
+export class NotebookComponent implements OnInit, OnDestroy {
   public loading = true;
   private notebookName = '';
-  private notebookKey = '';
+  private sessionToken = '';
   public notebookDetails: NotebookDetails | undefined;
   public notebook: DecryptedNotebook | undefined;
   public sortedEntries: NotebookEntry[] = [];
@@ -48,6 +50,7 @@ export class NotebookComponent implements OnInit {
     active: 'editTime',
     direction: 'desc',
   };
+  private notebookLockedSubscription: Subscription | undefined;
 
   constructor(
     private readonly router: Router,
@@ -60,6 +63,11 @@ export class NotebookComponent implements OnInit {
   ) {}
 
   public ngOnInit(): void {
+    this.notebookLockedSubscription =
+      this.notebookService.notebookLocked.subscribe((notification) =>
+        this.onNotebookLocked(notification)
+      );
+
     this.activatedRoute.paramMap.subscribe(async (paramMap) => {
       this.notebookName = paramMap.get('notebookName') || '';
 
@@ -77,45 +85,52 @@ export class NotebookComponent implements OnInit {
         return;
       }
 
-      this.activatedRoute.queryParamMap.subscribe(async (queryParamMap) => {
-        this.notebookKey = queryParamMap.get('key') || '';
-
-        if (this.notebookKey !== '') {
-          const sort = await this.settingsService.getSettingsOption<Sort>(
-            'EntrySort'
-          );
-
-          if (sort) {
-            this.sort = sort;
-          }
-
-          await this.getNotebook();
-          await this.sortEntries();
-        } else {
-          try {
-            const result = await this.dialogService.showDialog<
-              OpenNotebookDialogComponent,
-              OpenNotebookDialogData,
-              OpenNotebookDialogReturn
-            >(OpenNotebookDialogComponent, {
-              data: {
-                notebookDetails: this.notebookDetails as NotebookDetails,
-              },
-            });
-
-            await this.router.navigate(['notebook', this.notebookName], {
-              queryParams: { key: result.notebookKey },
-            });
-          } catch (_) {
-            this.location.back();
-          }
-
-          this.loading = false;
-        }
-      });
+      await this.unlockNotebook();
     });
   }
 
+  public ngOnDestroy(): void {
+    this.notebookLockedSubscription?.unsubscribe();
+  }
+
+  /**
+   * Open the notebook with the session held for it, asking for its key first
+   * if it is not unlocked.
+   */
+  private async unlockNotebook(): Promise<void> {
+    const notebookDetails = this.notebookDetails as NotebookDetails;
+    this.sessionToken =
+      this.notebookService.getSessionToken(notebookDetails.id) ?? '';
+
+    if (this.sessionToken === '') {
+      try {
+        const result = await this.dialogService.showDialog<
+          OpenNotebookDialogComponent,
+          OpenNotebookDialogData,
+          OpenNotebookDialogReturn
+        >(OpenNotebookDialogComponent, {
+          data: { notebookDetails },
+        });
+
+        this.sessionToken = result.sessionToken;
+      } catch (_) {
+        this.location.back();
+        return;
+      }
+    }
+
+    const sort = await this.settingsService.getSettingsOption<Sort>(
+      'EntrySort'
+    );
+
+    if (sort) {
+      this.sort = sort;
+    }
+
+    await this.getNotebook();
+    await this.sortEntries();
+  }
+
   /**
    * Retrieve the notebook.
    */
@@ -125,7 +140,7 @@ export class NotebookComponent implements OnInit {
     try {
       this.notebook = await this.notebookService.openNotebook(
         this.notebookName,
-        this.notebookKey
+        this.sessionToken
       );
       this.sortedEntries = Object.values(this.notebook.content.entries);
       this.numEntries = Object.keys(this.notebook.content.entries).length;
@@ -161,13 +176,15 @@ export class NotebookComponent implements OnInit {
   /**
    * Open a notebook entry.
    *
-   * @param entryName The name of the notebook entry.
+   * @param entryId The ID of the notebook entry.
    */
-  public async openEntry(entryName: string): Promise<void> {
-    await this.router.navigate(
-      ['notebook', this.notebookName, 'entry', entryName],
-      { queryParams: { key: this.notebookKey } }
-    );
+  public async openEntry(entryId: string): Promise<void> {
+    await this.router.navigate([
+      'notebook',
+      this.notebookName,
+      'entry',
+      entryId,
+    ]);
   }
 
   /**
@@ -182,11 +199,11 @@ export class NotebookComponent implements OnInit {
       >(CreateEntryDialogComponent, {
         data: {
           notebookName: this.notebookName,
-          notebookKey: this.notebookKey,
+          sessionToken: this.sessionToken,
         },
       });
 
-      await this.openEntry(result.entry.name);
+      await this.openEntry(result.entry.id);
     } catch (_) {}
   }
 
@@ -194,9 +211,7 @@ export class NotebookComponent implements OnInit {
    * Go to the notebook search page.
    */
   public async openSearchEntriesPage(): Promise<void> {
-    await this.router.navigate(['notebook', this.notebookName, 'search'], {
-      queryParams: { key: this.notebookKey },
-    });
+    await this.router.navigate(['notebook', this.notebookName, 'search']);
   }
 
   /**
@@ -210,16 +225,23 @@ export class NotebookComponent implements OnInit {
         EditNotebookDialogReturn
       >(EditNotebookDialogComponent, {
         data: {
-          notebookName: this.notebookName,
+          notebookID: this.notebookName,
+          notebookName: (this.notebook?.name ||
+            this.notebookDetails?.name) as string,
           notebookDescription: (this.notebook?.description ||
             this.notebookDetails?.description) as string,
-          notebookKey: this.notebookKey,
+          sessionToken: this.sessionToken,
         },
       });
 
-      await this.router.navigate(['notebook', result.notebookName], {
-        queryParams: { key: result.notebookKey },
-      });
+      if (result.notebookID !== this.notebookName) {
+        await this.router.navigate(['notebook', result.notebookID]);
+      } else {
+        this.notebookDetails = await this.notebookService.getNotebookDetails(
+          this.notebookName
+        );
+        await this.unlockNotebook();
+      }
     } catch (_) {}
   }
 
@@ -238,7 +260,7 @@ export class NotebookComponent implements OnInit {
       try {
         await this.notebookService.deleteNotebook(
           this.notebookName,
-          this.notebookKey
+          this.sessionToken
         );
 
         this.errorService.close();
@@ -250,4 +272,34 @@ export class NotebookComponent implements OnInit {
       }
     }
   }
+
+  /**
+   * Close the notebook once the backend has locked it, so its key has to be
+   * entered again. Locks from changing or deleting the notebook are left to the
+   * dialogs that made those changes.
+   *
+   * @param notification The lock notification.
+   */
+  private async onNotebookLocked(
+    notification: NotebookLockedNotification
+  ): Promise<void> {
+    if (
+      this.sessionToken === '' ||
+      notification.reason === 'keyChanged' ||
+      notification.reason === 'deleted' ||
+      (notification.notebookId !== '' &&
+        notification.notebookId !== this.notebookDetails?.id)
+    ) {
+      return;
+    }
+
+    this.sessionToken = '';
+    this.notebook = undefined;
+    this.sortedEntries = [];
+    this.errorService.showError({
+      message: 'The notebook has been locked',
+      includeErrorPrefix: false,
+    });
+    await this.unlockNotebook();
+  }
 }
@@ -2,10 +2,7 @@ import { Component, Inject } from '@angular/core';
 import { MatDialogRef, MAT_DIALOG_DATA } from '@angular/material/dialog';
 import { NotebookService } from '../../services/notebook/notebook.service';
 import { ErrorService } from '../../services/error/error.service';
-import {
-  DecryptedNotebook,
-  NotebookDetails,
-} from '../../services/notebook/notebook.interface';
+import { NotebookDetails } from '../../services/notebook/notebook.interface';
 import { notebookConstants, formAppearance } from '../../util';
 
 /**
@@ -19,8 +16,7 @@ export interface OpenNotebookDialogData {
  * The data returned from the open notebook dialog.
  */
 export interface OpenNotebookDialogReturn {
-  notebook: DecryptedNotebook;
-  notebookKey: string;
+  sessionToken: string;
 }
 
 /**
@@ -64,16 +60,16 @@ export class OpenNotebookDialogComponent {
   }
 
   /**
-   * Attempt to open a notebook.
+   * Attempt to unlock a notebook.
    */
   public async openNotebook(form: OpenNotebookForm): Promise<void> {
     try {
-      const notebook = await this.notebookService.openNotebook(
-        this.data.notebookDetails.name,
+      const session = await this.notebookService.unlockNotebook(
+        this.data.notebookDetails.id,
         form.notebookKey
       );
 
-      this.close({ notebook, notebookKey: form.notebookKey });
+      this.close({ sessionToken: session.token });
     } catch (err) {
       this.errorService.showError({
         message: String(err),
@@ -1,15 +1,30 @@
 import { Injectable } from '@angular/core';
-import { HttpClient } from '@angular/common/http';
+import {
+  HttpClient,
+  HttpHeaders,
+  HttpStatusCode,
+} from '@angular/common/http';
+import { Subject } from 'rxjs';
 
 /**
  * The API subpath.
  */
 const apiPath = '/api/';
 
+declare global {
+  interface Window {
+    /**
+     * The token the backend injects into the webview on every launch, which
+     * has to be sent with every API request.
+     */
+    enoApiToken?: string;
+  }
+}
+
 /**
  * Query or body parameters.
  */
-interface Params {
+export interface Params {
   [param: string]: any;
 }
 
@@ -33,6 +48,12 @@ export interface APIResponse<T> {
   providedIn: 'root',
 })
 export class APIService {
+  /**
+   * Emits the parameters of every request refused because the notebook it
+   * accessed is locked.
+   */
+  public readonly notebookLocked = new Subject<Params>();
+
   constructor(private readonly http: HttpClient) {}
 
   /**
@@ -48,15 +69,25 @@ export class APIService {
     path: string,
     params: Params = {}
   ): Promise<T> {
+    const headers = new HttpHeaders({
+      Authorization: `Bearer ${window.enoApiToken ?? ''}`,
+    });
+
     return new Promise((resolve, reject) => {
       this.http
-        .request<APIResponse<T>>(method, apiPath + path, { params })
+        .request<APIResponse<T>>(method, apiPath + path, { params, headers })
         .subscribe({
           next: (res) =>
             res.error === undefined || res.error === null
               ? resolve(res.data as T)
               : reject(res.error),
-          error: (err) => reject(err.error.error),
+          error: (err) => {
+            if (err.status === HttpStatusCode.Locked) {
+              this.notebookLocked.next(params);
+            }
+
+            reject(err.error.error);
+          },
         });
     });
   }
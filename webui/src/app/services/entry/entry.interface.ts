@@ -4,5 +4,5 @@ import { NotebookEntry } from '../notebook/notebook.interface';
  * A map of entries in a notebook.
  */
 export interface NotebookEntryMap {
-  [entryName: string]: NotebookEntry;
+  [entryId: string]: NotebookEntry;
 }
@@ -18,18 +18,18 @@ export class EntryService {
    * Create an entry in a notebook.
    *
    * @param notebookName The notebook's name.
-   * @param notebookKey The key to decrypt/encrypt the notebook.
+   * @param sessionToken The token of the session that unlocked the notebook.
    * @param entryName The name of the new entry.
    * @returns The new notebook entry.
    */
   public async createNotebookEntry(
     notebookName: string,
-    notebookKey: string,
+    sessionToken: string,
     entryName: string
   ): Promise<NotebookEntry> {
     return this.api.post<NotebookEntry>(this.subPath, {
       notebookName,
-      notebookKey,
+      sessionToken,
       entryName,
     });
   }
@@ -38,16 +38,16 @@ export class EntryService {
    * List all entries in a notebook.
    *
    * @param notebookName The notebook's name.
-   * @param notebookKey The key to encrypt/decrypt the notebook.
-   * @returns The list of notebook entries as a mapping with entry names as keys.
+   * @param sessionToken The token of the session that unlocked the notebook.
+   * @returns The list of notebook entries as a mapping with entry IDs as keys.
    */
   public async listNotebookEntries(
     notebookName: string,
-    notebookKey: string
+    sessionToken: string
   ): Promise<NotebookEntryMap> {
     return this.api.get<NotebookEntryMap>(this.subPath + '/all', {
       notebookName,
-      notebookKey,
+      sessionToken,
     });
   }
 
@@ -55,19 +55,19 @@ export class EntryService {
    * Get an entry from the notebook.
    *
    * @param notebookName The notebook's name.
-   * @param notebookKey The key to encrypt/decrypt the notebook.
-   * @param entryName The name of the entry.
+   * @param sessionToken The token of the session that unlocked the notebook.
+   * @param entryId The ID of the entry.
    * @returns The notebook entry.
    */
   public async getNotebookEntry(
     notebookName: string,
-    notebookKey: string,
-    entryName: string
+    sessionToken: string,
+    entryId: string
   ): Promise<NotebookEntry> {
     return this.api.get<NotebookEntry>(this.subPath, {
       notebookName,
-      notebookKey,
-      entryName,
+      sessionToken,
+      entryId,
     });
   }
 
@@ -75,21 +75,21 @@ export class EntryService {
    * Set the name of an entry in a notebook.
    *
    * @param notebookName The notebook's name.
-   * @param notebookKey The key to encrypt/decrypt the notebook.
-   * @param entryName The name of the entry.
+   * @param sessionToken The token of the session that unlocked the notebook.
+   * @param entryId The ID of the entry.
    * @param newEntryName The new name of the entry.
-   * @returns The updated notebook entry.
+   * @returns The updated notebook entry, without its content.
    */
   public async setNotebookEntryName(
     notebookName: string,
-    notebookKey: string,
-    entryName: string,
+    sessionToken: string,
+    entryId: string,
     newEntryName: string
   ): Promise<NotebookEntry> {
     return this.api.patch<NotebookEntry>(this.subPath + '/name', {
       notebookName,
-      notebookKey,
-      entryName,
+      sessionToken,
+      entryId,
       newEntryName,
     });
   }
@@ -98,22 +98,25 @@ export class EntryService {
    * Set the content of an entry in a notebook.
    *
    * @param notebookName The notebook's name.
-   * @param notebookKey The key to encrypt/decrypt the notebook.
-   * @param entryName The name of the entry.
+   * @param sessionToken The token of the session that unlocked the notebook.
+   * @param entryId The ID of the entry.
    * @param newContent The new entry content.
+   * @param expectedRevision The entry revision the content was edited from.
    * @returns The updated entry.
    */
   public async setNotebookEntryContent(
     notebookName: string,
-    notebookKey: string,
-    entryName: string,
-    newContent: string
+    sessionToken: string,
+    entryId: string,
+    newContent: string,
+    expectedRevision?: number
   ): Promise<NotebookEntry> {
     return this.api.patch<NotebookEntry>(this.subPath + '/content', {
       notebookName,
-      notebookKey,
-      entryName,
+      sessionToken,
+      entryId,
       newContent,
+      ...(expectedRevision !== undefined && { expectedRevision }),
     });
   }
 
@@ -121,20 +124,20 @@ export class EntryService {
    * Search through a notebook's entries for query matches.
    *
    * @param notebookName The notebook's name.
-   * @param notebookKey The key to encrypt/decrypt the notebook.
+   * @param sessionToken The token of the session that unlocked the notebook.
    * @param query The query string.
    * @param regexSearch Whether the search is a regex search.
-   * @returns The matched notebook entries as a mapping with entry names as keys.
+   * @returns The matched notebook entries as a mapping with entry IDs as keys.
    */
   public async searchNotebookEntries(
     notebookName: string,
-    notebookKey: string,
+    sessionToken: string,
     query: string,
     regexSearch: boolean
   ): Promise<NotebookEntryMap> {
     return this.api.get<NotebookEntryMap>(this.subPath + '/search', {
       notebookName,
-      notebookKey,
+      sessionToken,
       query,
       regexSearch,
     });
@@ -144,18 +147,18 @@ export class EntryService {
    * Delete an entry in a notebook.
    *
    * @param notebookName The notebook's name.
-   * @param notebookKey The key to encrypt/decrypt the notebook.
-   * @param entryName The name of the entry.
+   * @param sessionToken The token of the session that unlocked the notebook.
+   * @param entryId The ID of the entry.
    */
   public async deleteNotebookEntry(
     notebookName: string,
-    notebookKey: string,
-    entryName: string
+    sessionToken: string,
+    entryId: string
   ): Promise<void> {
     return this.api.delete(this.subPath, {
       notebookName,
-      notebookKey,
-      entryName,
+      sessionToken,
+      entryId,
     });
   }
 }
@@ -2,9 +2,13 @@
  * An entry in a notebook.
  */
 export interface NotebookEntry {
+  id: string;
   name: string;
+  folder: string;
   createTime: string;
   editTime: string;
+  revision: number;
+  tags?: string[];
   content: string;
 }
 
@@ -13,7 +17,7 @@ export interface NotebookEntry {
  */
 export interface NotebookContent {
   entries: {
-    [entryName: string]: NotebookEntry;
+    [entryId: string]: NotebookEntry;
   };
 }
 
@@ -21,6 +25,8 @@ export interface NotebookContent {
  * An encrypted notebook.
  */
 export interface EncryptedNotebook {
+  id: string;
+  hidden?: boolean;
   name: string;
   description: string;
   createTime: Date;
@@ -32,19 +38,52 @@ export interface EncryptedNotebook {
  * A decrypted notebook.
  */
 export interface DecryptedNotebook {
+  id: string;
+  hidden: boolean;
   name: string;
   description: string;
   createTime: Date;
   editTime: Date;
+  revision: number;
   content: NotebookContent;
 }
 
+/**
+ * A newly created notebook, along with the recovery key generated for it.
+ */
+export interface CreatedNotebook extends DecryptedNotebook {
+  recoveryKey: string;
+}
+
 /**
  * A notebook's details.
  */
 export interface NotebookDetails {
+  id: string;
+  hidden: boolean;
   name: string;
   description: string;
   createTime: Date;
   editTime: Date;
+  revision: number;
+}
+
+/**
+ * A session started by unlocking a notebook. The idle timeout is in seconds,
+ * and is 0 when sessions never expire.
+ */
+export interface NotebookSession {
+  token: string;
+  notebookId: string;
+  idleTimeout: number;
+}
+
+/**
+ * A notification pushed by the backend when a notebook is locked. The notebook
+ * ID is empty when every notebook has been locked at once. Requests refused
+ * because their session has ended are reported with the sessionEnded reason.
+ */
+export interface NotebookLockedNotification {
+  notebookId: string;
+  reason: 'idle' | 'requested' | 'keyChanged' | 'deleted' | 'sessionEnded';
 }
@@ -1,11 +1,20 @@
 import { Injectable } from '@angular/core';
+import { Observable, Subject, filter, fromEvent, map, merge } from 'rxjs';
 import { APIService } from '../api/api.service';
 import {
+  CreatedNotebook,
   DecryptedNotebook,
   EncryptedNotebook,
   NotebookDetails,
+  NotebookLockedNotification,
+  NotebookSession,
 } from './notebook.interface';
 
+/**
+ * The window event the backend dispatches when a notebook is locked.
+ */
+const notebookLockedEvent = 'notebooklocked';
+
 /**
  * Notebook service.
  */
@@ -15,7 +24,56 @@ import {
 export class NotebookService {
   private readonly subPath = 'notebook';
 
-  constructor(private readonly api: APIService) {}
+  /**
+   * The tokens of the sessions this window holds, by notebook ID.
+   */
+  private readonly sessionTokens = new Map<string, string>();
+
+  /**
+   * Notebooks found locked when a request using their session was refused.
+   */
+  private readonly sessionsEnded = new Subject<NotebookLockedNotification>();
+
+  /**
+   * Emits whenever the backend locks a notebook, or a session held for one
+   * turns out to have ended.
+   */
+  public readonly notebookLocked: Observable<NotebookLockedNotification> =
+    merge(
+      fromEvent<CustomEvent<NotebookLockedNotification>>(
+        window,
+        notebookLockedEvent
+      ).pipe(map((event) => event.detail)),
+      this.sessionsEnded
+    );
+
+  constructor(private readonly api: APIService) {
+    this.api.notebookLocked
+      .pipe(
+        map((params) => this.sessionNotebookId(params['sessionToken'])),
+        filter((notebookId): notebookId is string => notebookId !== undefined)
+      )
+      .subscribe((notebookId) =>
+        this.sessionsEnded.next({ notebookId, reason: 'sessionEnded' })
+      );
+
+    this.notebookLocked.subscribe((notification) => {
+      // Key changes and deletions drop their sessions where they are made, so
+      // a session unlocked again right after is not dropped by a late event
+      if (
+        notification.reason === 'keyChanged' ||
+        notification.reason === 'deleted'
+      ) {
+        return;
+      }
+
+      if (notification.notebookId === '') {
+        this.sessionTokens.clear();
+      } else {
+        this.sessionTokens.delete(notification.notebookId);
+      }
+    });
+  }
 
   /**
    * Create a new notebook.
@@ -23,17 +81,20 @@ export class NotebookService {
    * @param name The name of the new notebook.
    * @param description The notebook's description.
    * @param key The key to use to encrypt the notebook.
-   * @returns The created notebook.
+   * @param hidden Whether the notebook's name and description should be encrypted.
+   * @returns The created notebook and its recovery key, which is only returned this once.
    */
   public async createNotebook(
     name: string,
     description: string,
-    key: string
-  ): Promise<DecryptedNotebook> {
-    return this.api.post<DecryptedNotebook>(this.subPath, {
+    key: string,
+    hidden = false
+  ): Promise<CreatedNotebook> {
+    return this.api.post<CreatedNotebook>(this.subPath, {
       name,
       description,
       key,
+      hidden,
     });
   }
 
@@ -52,65 +113,137 @@ export class NotebookService {
   /**
    * Get a notebook's details.
    *
-   * @param name The notebook's name.
+   * @param name The notebook's name or ID.
    * @returns The notebook's details.
    */
   public async getNotebookDetails(name: string): Promise<NotebookDetails> {
     return this.api.get<NotebookDetails>(this.subPath + '/details', { name });
   }
 
+  /**
+   * Unlock a notebook, starting a session that later requests use instead of
+   * the key.
+   *
+   * @param name The notebook's name or ID.
+   * @param key The key to decrypt the notebook.
+   * @returns The session.
+   */
+  public async unlockNotebook(
+    name: string,
+    key: string
+  ): Promise<NotebookSession> {
+    const session = await this.api.post<NotebookSession>(
+      this.subPath + '/unlock',
+      { name, key }
+    );
+    this.sessionTokens.set(session.notebookId, session.token);
+    return session;
+  }
+
+  /**
+   * Get the token of the session this window holds for a notebook.
+   *
+   * @param notebookId The notebook's ID.
+   * @returns The session token, or undefined if the notebook is not unlocked.
+   */
+  public getSessionToken(notebookId: string): string | undefined {
+    return this.sessionTokens.get(notebookId);
+  }
+
+  /**
+   * Find the notebook a session token was held for.
+   *
+   * @param sessionToken The session token.
+   * @returns The notebook's ID, or undefined if no such session is held.
+   */
+  private sessionNotebookId(sessionToken?: string): string | undefined {
+    for (const [notebookId, token] of this.sessionTokens) {
+      if (token === sessionToken) {
+        return notebookId;
+      }
+    }
+
+    return undefined;
+  }
+
+  /**
+   * Forget the session held for a notebook, without ending it.
+   *
+   * @param notebookId The notebook's ID.
+   */
+  public forgetSession(notebookId: string): void {
+    this.sessionTokens.delete(notebookId);
+  }
+
   /**
    * Open a specified notebook.
    *
    * @param name The notebook's name.
-   * @param key The key to decrypt the notebook.
+   * @param sessionToken The token of the session that unlocked the notebook.
    * @returns The decrypted notebook.
    */
   public async openNotebook(
     name: string,
-    key: string
+    sessionToken: string
   ): Promise<DecryptedNotebook> {
-    return this.api.get<DecryptedNotebook>(this.subPath, { name, key });
+    return this.api.get<DecryptedNotebook>(this.subPath, {
+      name,
+      sessionToken,
+    });
   }
 
   /**
    * Set a notebook's name.
    *
    * @param name The notebook's current name.
+   * @param sessionToken The token of the session that unlocked the notebook.
    * @param newName The notebook's new name.
    * @returns The updated notebook.
    */
   public async setNotebookName(
     name: string,
+    sessionToken: string,
     newName: string
   ): Promise<EncryptedNotebook> {
-    return this.api.patch<EncryptedNotebook>(this.subPath + '/name', {
-      name,
-      newName,
-    });
+    const notebook = await this.api.patch<EncryptedNotebook>(
+      this.subPath + '/name',
+      { name, sessionToken, newName }
+    );
+
+    // The session follows the notebook to its new ID
+    if (notebook.id !== name && this.sessionTokens.has(name)) {
+      this.sessionTokens.set(notebook.id, sessionToken);
+      this.sessionTokens.delete(name);
+    }
+
+    return notebook;
   }
 
   /**
    * Set a notebook's description.
    *
    * @param name The notebook's name.
+   * @param sessionToken The token of the session that unlocked the notebook.
    * @param newDescription The notebook's new description.
    * @returns The updated notebook.
    */
   public async setNotebookDescription(
     name: string,
+    sessionToken: string,
     newDescription: string
   ): Promise<EncryptedNotebook> {
     return this.api.patch<EncryptedNotebook>(this.subPath + '/description', {
       name,
+      sessionToken,
       newDescription,
     });
   }
 
   /**
-   * Set a notebook's key.
+   * Set a notebook's key. This locks the notebook, so it has to be unlocked
+   * again with the new key.
    *
-   * @param name The notebook's name.
+   * @param name The notebook's name or ID.
    * @param key The notebook's key.
    * @param newKey The notebook's new key.
    */
@@ -119,16 +252,29 @@ export class NotebookService {
     key: string,
     newKey: string
   ): Promise<void> {
-    return this.api.patch(this.subPath + '/key', { name, key, newKey });
+    await this.api.patch(this.subPath + '/key', { name, key, newKey });
+    this.forgetSession(name);
+  }
+
+  /**
+   * Lock every unlocked notebook.
+   */
+  public async lockAllNotebooks(): Promise<void> {
+    await this.api.post(this.subPath + '/lock/all');
+    this.sessionTokens.clear();
   }
 
   /**
    * Delete a notebook.
    *
-   * @param name The notebook's name.
-   * @param key The notebook key, used as deletion confirmation.
+   * @param name The notebook's name or ID.
+   * @param sessionToken The token of the session that unlocked the notebook.
    */
-  public async deleteNotebook(name: string, key: string): Promise<void> {
-    return this.api.delete(this.subPath, { name, key });
+  public async deleteNotebook(
+    name: string,
+    sessionToken: string
+  ): Promise<void> {
+    await this.api.delete(this.subPath, { name, sessionToken });
+    this.forgetSession(name);
   }
 }